@@ -0,0 +1,67 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ArrayArg 把slice包装为postgresql数组参数，用于自定义条件内的 col = ANY(?)
+// 与sqlx.In展开为IN (?, ?, ...)相比，无论slice有多长都只占用一个参数
+//
+//	entity.ExistsWhere(ctx, ent, db, "id = ANY(?)", entity.ArrayArg(ids))
+//
+// 支持元素类型为整数、浮点数、布尔值以及字符串的slice，nil slice对应NULL
+func ArrayArg(v interface{}) driver.Valuer {
+	return arrayArg{v: v}
+}
+
+type arrayArg struct {
+	v interface{}
+}
+
+// Value implements driver.Valuer
+func (a arrayArg) Value() (driver.Value, error) {
+	rv := reflect.ValueOf(a.v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("array arg requires slice, got %T", a.v)
+	} else if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return nil, nil
+	}
+
+	elems := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		s, err := arrayElem(rv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, s)
+	}
+	return "{" + strings.Join(elems, ",") + "}", nil
+}
+
+func arrayElem(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "NULL", nil
+		}
+		return arrayElem(v.Elem())
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.String:
+		s := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v.String())
+		return `"` + s + `"`, nil
+	}
+	return "", fmt.Errorf("unsupported array element type %s", v.Type())
+}
@@ -0,0 +1,36 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayArg(t *testing.T) {
+	foo := "foo"
+	cases := []struct {
+		arg      interface{}
+		expected interface{}
+	}{
+		{[]int{1, 2, 3}, "{1,2,3}"},
+		{[]int64{}, "{}"},
+		{[]uint8{1, 2}, "{1,2}"},
+		{[]float64{1.5, 2}, "{1.5,2}"},
+		{[]bool{true, false}, "{true,false}"},
+		{[]string{"a", `b"c`, `d\e`, "f,g"}, `{"a","b\"c","d\\e","f,g"}`},
+		{[]*string{&foo, nil}, `{"foo",NULL}`},
+		{[2]int{1, 2}, "{1,2}"},
+		{[]int(nil), nil},
+	}
+
+	for _, c := range cases {
+		v, err := ArrayArg(c.arg).Value()
+		require.NoError(t, err)
+		require.Equal(t, c.expected, v, "%#v", c.arg)
+	}
+
+	_, err := ArrayArg(1).Value()
+	require.Error(t, err)
+	_, err = ArrayArg([]struct{}{{}}).Value()
+	require.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrAsyncWriterFull 异步写入队列已满，entity被丢弃
+	ErrAsyncWriterFull = errors.New("async writer queue is full")
+	// ErrAsyncWriterClosed 异步写入已经关闭
+	ErrAsyncWriterClosed = errors.New("async writer is closed")
+)
+
+// AsyncWriterOptions 异步写入参数
+type AsyncWriterOptions struct {
+	// 每批最多写入的记录数，默认100
+	BatchSize int
+	// 定时写入的间隔，不足一批的记录也会在间隔到达时写入，默认1秒
+	FlushInterval time.Duration
+	// 队列长度，默认1000
+	QueueSize int
+	// 队列满时是否阻塞等待，默认不等待，直接丢弃并返回ErrAsyncWriterFull
+	Block bool
+	// 批量写入失败时的回调，ents为这一批没有写入的entity
+	OnError func(ents []Entity, err error)
+}
+
+// AsyncWriter 异步批量插入entity，适用于允许丢失数据的场景，例如埋点、日志
+//
+// Insert只是把entity放入内存队列，由后台goroutine按批次写入数据库，返回nil不代表已经写入成功
+// 进程崩溃或者没有调用Close就退出时，队列内还没有写入的数据会丢失
+// 写入失败的数据也不会重试，只会通过OnError通知
+//
+//	w := entity.NewAsyncWriter(db, entity.AsyncWriterOptions{BatchSize: 500})
+//	defer w.Close(context.Background())
+//
+//	w.Insert(ctx, &Event{...})
+type AsyncWriter struct {
+	db  DB
+	opt AsyncWriterOptions
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Entity
+	done   chan struct{}
+
+	dropped int64
+}
+
+// NewAsyncWriter 构造AsyncWriter并启动后台写入
+// db是*sqlx.DB时每一批在一个事务内写入，否则认为db已经是事务
+func NewAsyncWriter(db DB, opt AsyncWriterOptions) *AsyncWriter {
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 100
+	}
+	if opt.FlushInterval <= 0 {
+		opt.FlushInterval = time.Second
+	}
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = 1000
+	}
+
+	w := &AsyncWriter{
+		db:    db,
+		opt:   opt,
+		queue: make(chan Entity, opt.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+
+	return w
+}
+
+// Insert 把entity放入写入队列
+// 队列满时按照Block参数等待或者丢弃，等待时ctx结束返回ctx.Err()
+func (w *AsyncWriter) Insert(ctx context.Context, ent Entity) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrAsyncWriterClosed
+	}
+
+	if w.opt.Block {
+		select {
+		case w.queue <- ent:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case w.queue <- ent:
+		return nil
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+		return ErrAsyncWriterFull
+	}
+}
+
+// Dropped 因为队列已满被丢弃的entity数量
+func (w *AsyncWriter) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// Close 停止接收新的entity，等待队列内剩余的entity写入完成
+// ctx结束时不再等待，返回ctx.Err()，没有写入的数据会丢失
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opt.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Entity, 0, w.opt.BatchSize)
+	for {
+		select {
+		case ent, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+
+			batch = append(batch, ent)
+			if len(batch) >= w.opt.BatchSize {
+				w.flush(batch)
+				batch = make([]Entity, 0, w.opt.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = make([]Entity, 0, w.opt.BatchSize)
+			}
+		}
+	}
+}
+
+func (w *AsyncWriter) flush(batch []Entity) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	fn := func(db DB) error {
+		for _, ent := range batch {
+			if _, err := Insert(ctx, ent, db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if db, ok := w.db.(*sqlx.DB); ok {
+		err = Transaction(db, func(tx *sqlx.Tx) error {
+			return fn(tx)
+		})
+	} else {
+		err = fn(w.db)
+	}
+
+	if err != nil && w.opt.OnError != nil {
+		w.opt.OnError(batch, err)
+	}
+}
@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncWriter(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`)
+	ctx := context.Background()
+
+	count := func() int64 {
+		n, err := Select[*ScoreEntity]().Count(ctx, db)
+		require.NoError(t, err)
+		return n
+	}
+
+	w := NewAsyncWriter(db, AsyncWriterOptions{BatchSize: 2, FlushInterval: time.Hour})
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, w.Insert(ctx, &ScoreEntity{ID: i, Team: "a"}))
+	}
+
+	// 满一批立即写入，不足一批的等待定时或者关闭时写入
+	waitFor(t, func() bool { return count() == 2 })
+	require.Equal(t, int64(2), count())
+
+	require.NoError(t, w.Close(ctx))
+	require.Equal(t, int64(3), count())
+	require.NoError(t, w.Close(ctx))
+
+	err := w.Insert(ctx, &ScoreEntity{ID: 4})
+	require.True(t, errors.Is(err, ErrAsyncWriterClosed))
+}
+
+func TestAsyncWriterFlushInterval(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`)
+	ctx := context.Background()
+
+	var (
+		mu     sync.Mutex
+		failed []Entity
+	)
+	w := NewAsyncWriter(db, AsyncWriterOptions{
+		BatchSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+	})
+
+	require.NoError(t, w.Insert(ctx, &ScoreEntity{ID: 1, Team: "a"}))
+	waitFor(t, func() bool {
+		n, err := Select[*ScoreEntity]().Count(ctx, db)
+		return err == nil && n == 1
+	})
+	require.NoError(t, w.Close(ctx))
+
+	// 主键冲突，整批回滚并通知OnError
+	w = NewAsyncWriter(db, AsyncWriterOptions{
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		OnError: func(ents []Entity, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, ents...)
+		},
+	})
+	require.NoError(t, w.Insert(ctx, &ScoreEntity{ID: 2, Team: "a"}))
+	require.NoError(t, w.Insert(ctx, &ScoreEntity{ID: 1, Team: "a"}))
+	require.NoError(t, w.Close(ctx))
+	require.Len(t, failed, 2)
+
+	n, err := Select[*ScoreEntity]().Count(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
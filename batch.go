@@ -0,0 +1,335 @@
+package entity
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// BatchInsertSize BatchInsert每条语句最多插入的记录数，避免超过数据库的参数数量限制
+var BatchInsertSize = 500
+
+// BatchInsert每条语句的最大字节数，0表示不限制
+var maxStatementBytes int
+
+// SetMaxStatementBytes 限制BatchInsert每条语句的字节数，包括语句本身以及参数值，n小于等于0时不限制
+// 用于避免超过mysql的max_allowed_packet等限制，语句大小按照生成时的估算值判断
+// 单条记录超过限制时仍然单独执行，应该在程序初始化阶段设置
+func SetMaxStatementBytes(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxStatementBytes = n
+}
+
+// InsertMissing 逐条插入entity，已经存在(违反主键或唯一索引)的记录会被跳过，返回实际插入的记录的主键
+// 所有entity必须是同一个类型，并且只有一个主键字段
+// 依赖ON CONFLICT DO NOTHING以及RETURNING，不支持mysql
+func InsertMissing(ctx context.Context, ents []Entity, db DB) ([]interface{}, error) {
+	insertedKeys := []interface{}{}
+	if len(ents) == 0 {
+		return insertedKeys, nil
+	}
+
+	md, err := getMetadata(ents[0])
+	if err != nil {
+		return nil, fmt.Errorf("get metadata, %w", err)
+	} else if len(md.PrimaryKeys) != 1 {
+		return nil, fmt.Errorf("entity %q, insert missing requires single primary key", md.Type)
+	}
+
+	for _, ent := range ents[1:] {
+		if t := reflectx.Deref(reflect.TypeOf(ent)); t != md.Type {
+			return nil, fmt.Errorf("entity type mismatch, expected %q, got %q", md.Type, t)
+		}
+	}
+
+	driver := dbDriver(db)
+	if !SupportsReturning(driver) || driver == driverSqlserver {
+		return nil, fmt.Errorf("driver %q does not support insert missing", driver)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	db = withLogger(db)
+	err = handle(ctx, db, OpInsert, md.TableName, func(ctx context.Context) error {
+		var err error
+		insertedKeys, err = insertMissing(ctx, ents, md, db)
+		return err
+	})
+	return insertedKeys, err
+}
+
+func insertMissing(ctx context.Context, ents []Entity, md *Metadata, db DB) ([]interface{}, error) {
+	driver := dbDriver(db)
+	insertedKeys := []interface{}{}
+
+	stmt := insertMissingStatement(ents[0], md, driver)
+	for i, ent := range ents {
+		if err := ctx.Err(); err != nil {
+			return insertedKeys, &BatchError{Processed: int64(i), Err: err}
+		}
+
+		if err := ent.OnEntityEvent(ctx, EventBeforeInsert); err != nil {
+			return insertedKeys, fmt.Errorf("before insert, %w", err)
+		} else if err := validate(ent); err != nil {
+			return insertedKeys, err
+		}
+
+		allocEmbedded(ent, md)
+		touchTimestamps(ent, md, true)
+		if err := checkValues(ent, md); err != nil {
+			return insertedKeys, err
+		}
+		if err := checkFKEnums(ctx, ent, md, db); err != nil {
+			return insertedKeys, err
+		}
+
+		// 与batchInsert相同，nullPolicy决定插入的字段，每条记录的语句可能不同
+		query, arg := stmt, interface{}(ent)
+		if md.hasNullPolicy {
+			var omd *Metadata
+			omd, arg = nullPolicyValues(ent, md)
+			query = insertMissingStatement(ent, omd, driver)
+		}
+
+		inserted, err := queryReturning(ctx, ent, db, query, arg)
+		if err != nil {
+			return insertedKeys, &BatchError{Processed: int64(i), Err: err}
+		} else if !inserted {
+			continue
+		}
+
+		v := reflect.Indirect(reflect.ValueOf(ent))
+		insertedKeys = append(insertedKeys, mapper.FieldByName(v, md.PrimaryKeys[0].DBField).Interface())
+
+		if err := ent.OnEntityEvent(ctx, EventAfterInsert); err != nil {
+			return insertedKeys, fmt.Errorf("after insert, %w", err)
+		}
+	}
+
+	return insertedKeys, nil
+}
+
+// BatchInsert 使用多行INSERT语句批量插入entity，超过BatchInsertSize的记录分成多条语句执行
+// 设置了SetMaxStatementBytes时，语句超过字节数限制也会分成多条语句执行
+// 所有entity必须是同一个类型，RETURNING字段(包括postgresql的自增主键)会按顺序写回每个entity
+// 中途失败时返回*BatchError，Processed为已经插入的记录数，db不是事务时已经插入的记录不会回滚
+func BatchInsert(ctx context.Context, ents []Entity, db DB) error {
+	if len(ents) == 0 {
+		return nil
+	}
+
+	md, err := getMetadata(ents[0])
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	for _, ent := range ents[1:] {
+		if t := reflectx.Deref(reflect.TypeOf(ent)); t != md.Type {
+			return fmt.Errorf("entity type mismatch, expected %q, got %q", md.Type, t)
+		}
+	}
+
+	if err := checkReturning(md, dbDriver(db), md.hasReturningInsert); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	for _, ent := range ents {
+		if err := ent.OnEntityEvent(ctx, EventBeforeInsert); err != nil {
+			return fmt.Errorf("before insert, %w", err)
+		} else if err := validate(ent); err != nil {
+			return err
+		}
+
+		allocEmbedded(ent, md)
+		touchTimestamps(ent, md, true)
+		if err := checkValues(ent, md); err != nil {
+			return err
+		}
+		if err := checkFKEnums(ctx, ent, md, db); err != nil {
+			return err
+		}
+	}
+
+	if err := handle(ctx, db, OpInsert, md.TableName, func(ctx context.Context) error {
+		return batchInsert(ctx, ents, md, db)
+	}); err != nil {
+		return err
+	}
+
+	for _, ent := range ents {
+		if err := ent.OnEntityEvent(ctx, EventAfterInsert); err != nil {
+			return fmt.Errorf("after insert, %w", err)
+		}
+	}
+	return nil
+}
+
+func batchInsert(ctx context.Context, ents []Entity, md *Metadata, db DB) error {
+	db = withLogger(db)
+	driver := dbDriver(db)
+	returnings := insertReturnings(md, driver)
+
+	var (
+		processed int64
+		columns   []string
+		tuples    []string
+		args      []interface{}
+		chunk     []Entity
+		// 当前语句的估算字节数
+		size int
+	)
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+
+		stmt := rebind(db, newInsert(md, driver).
+			column(columns...).
+			tuple(tuples...).
+			returning(returnings...).
+			String())
+
+		if err := execBatch(ctx, db, stmt, args, chunk, len(returnings) > 0); err != nil {
+			return &BatchError{Processed: processed, Err: err}
+		}
+
+		processed += int64(len(chunk))
+		tuples, args, chunk, size = nil, nil, nil, 0
+		return nil
+	}
+
+	for _, ent := range ents {
+		omd, arg := md, interface{}(ent)
+		if md.hasNullPolicy {
+			omd, arg = nullPolicyValues(ent, md)
+		}
+
+		arg, err := encodeArg(ent, md, arg)
+		if err != nil {
+			return err
+		}
+
+		cols, placeholder, _ := insertColumns(omd, driver)
+		// nullPolicy=omit时每条记录的字段可能不同，字段不同的记录不能放在同一条语句内
+		if len(chunk) >= BatchInsertSize || (len(chunk) > 0 && strings.Join(cols, ",") != strings.Join(columns, ",")) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		tuple, tupleArgs, err := sqlx.Named("("+strings.Join(placeholder, ", ")+")", arg)
+		if err != nil {
+			return fmt.Errorf("bind named, %w", err)
+		}
+
+		tupleSize := len(tuple) + len(", ") + argsBytes(tupleArgs)
+		if maxStatementBytes > 0 && len(chunk) > 0 && size+tupleSize > maxStatementBytes {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if len(chunk) == 0 {
+			size = len(newInsert(md, driver).column(cols...).returning(returnings...).String())
+		}
+		size += tupleSize
+
+		columns = cols
+		tuples = append(tuples, tuple)
+		args = append(args, tupleArgs...)
+		chunk = append(chunk, ent)
+	}
+
+	return flush()
+}
+
+// 估算参数值的字节数，字符串及二进制按实际长度，其它类型按8字节计算
+func argsBytes(args []interface{}) int {
+	n := 0
+	for _, arg := range args {
+		if v, ok := arg.(driver.Valuer); ok {
+			if dv, err := v.Value(); err == nil {
+				arg = dv
+			}
+		}
+
+		switch v := arg.(type) {
+		case nil:
+		case string:
+			n += len(v)
+		case []byte:
+			n += len(v)
+		default:
+			n += 8
+		}
+	}
+	return n
+}
+
+func execBatch(ctx context.Context, db DB, stmt string, args []interface{}, ents []Entity, returning bool) error {
+	if !returning {
+		_, err := db.ExecContext(ctx, stmt, args...)
+		return err
+	}
+
+	rows, err := db.QueryxContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for _, ent := range ents {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("expect %d returning rows", len(ents))
+		}
+
+		if err := scanEntity(rows, ent); err != nil {
+			return fmt.Errorf("scan struct, %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+// BatchError 批量操作中途停止时返回的错误，Processed为停止之前已经处理完成的记录数
+// 可以用errors.Is(err, context.Canceled)或errors.Is(err, context.DeadlineExceeded)判断停止原因
+type BatchError struct {
+	Processed int64
+	Err       error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch stopped after %d rows, %v", e.Processed, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+func insertMissingStatement(ent Entity, md *Metadata, driver string) string {
+	columns, placeholder, returnings := insertColumns(md, driver)
+
+	pk := md.PrimaryKeys[0]
+	if !pk.ReturningInsert {
+		returnings = append([]string{pk.DBField}, returnings...)
+	}
+
+	b := newInsert(md, driver).onConflict("ON CONFLICT DO NOTHING")
+	for i, name := range columns {
+		b.value(name, placeholder[i])
+	}
+	return b.returning(returnings...).String()
+}
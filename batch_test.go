@@ -0,0 +1,194 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertMissing(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE upsert (code TEXT PRIMARY KEY, name TEXT, create_at INTEGER DEFAULT 100)`,
+		`INSERT INTO upsert (code, name) VALUES ('b', 'exists')`,
+	)
+
+	ents := []Entity{
+		&UpsertEntity{Code: "a", Name: "foo"},
+		&UpsertEntity{Code: "b", Name: "bar"},
+		&UpsertEntity{Code: "c", Name: "baz"},
+	}
+
+	keys, err := InsertMissing(context.Background(), ents, db)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"a", "c"}, keys)
+	require.Equal(t, int64(100), ents[0].(*UpsertEntity).CreateAt)
+
+	var name string
+	require.NoError(t, db.Get(&name, `SELECT name FROM upsert WHERE code = 'b'`))
+	require.Equal(t, "exists", name)
+
+	_, err = InsertMissing(context.Background(), []Entity{&UpsertEntity{Code: "d"}, &MirrorEntity{}}, db)
+	require.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = InsertMissing(ctx, []Entity{&UpsertEntity{Code: "d"}}, db)
+	require.True(t, errors.Is(err, context.Canceled))
+
+	var be *BatchError
+	require.True(t, errors.As(err, &be))
+	require.Equal(t, int64(0), be.Processed)
+}
+
+// InsertMissing同样执行中间件，并且按照nullPolicy决定插入的字段
+func TestInsertMissingNullPolicy(t *testing.T) {
+	defer resetMiddlewares()
+
+	var ops []string
+	Use(func(next Handler) Handler {
+		return func(ctx context.Context, op string, exec func() error) error {
+			ops = append(ops, op)
+			return next(ctx, op, exec)
+		}
+	})
+
+	db := newTestDB(t, `CREATE TABLE null_policy (
+		id INTEGER PRIMARY KEY,
+		as_null TEXT DEFAULT 'default',
+		as_zero TEXT DEFAULT 'default',
+		as_omit TEXT DEFAULT 'default'
+	)`)
+
+	keys, err := InsertMissing(context.Background(), []Entity{&NullPolicyEntity{}, &NullPolicyEntity{AsOmit: "c"}}, db)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{1, 2}, keys)
+	require.Equal(t, []string{OpInsert}, ops)
+
+	var r struct {
+		AsNull sql.NullString `db:"as_null"`
+		AsZero sql.NullString `db:"as_zero"`
+		AsOmit sql.NullString `db:"as_omit"`
+	}
+	require.NoError(t, db.Get(&r, `SELECT as_null, as_zero, as_omit FROM null_policy WHERE id = 1`))
+	require.False(t, r.AsNull.Valid)
+	require.Equal(t, sql.NullString{String: "", Valid: true}, r.AsZero)
+	require.Equal(t, sql.NullString{String: "default", Valid: true}, r.AsOmit)
+}
+
+func TestInsertMissingStatement(t *testing.T) {
+	md, _ := newTestMetadata(&MirrorEntity{})
+
+	stmt := insertMissingStatement(&MirrorEntity{}, md, driverPostgres)
+	expected := `INSERT INTO "mirror" ("email", "email_copy") VALUES (:email, :email) ON CONFLICT DO NOTHING RETURNING "id"`
+	if stmt != expected {
+		t.Fatalf("MirrorEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+
+	md, _ = newTestMetadata(&UpsertEntity{})
+
+	stmt = insertMissingStatement(&UpsertEntity{}, md, driverPostgres)
+	expected = `INSERT INTO "upsert" ("code", "name") VALUES (:code, :name) ON CONFLICT DO NOTHING RETURNING "code", "create_at"`
+	if stmt != expected {
+		t.Fatalf("UpsertEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+}
+
+func TestBatchInsert(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE upsert (code TEXT PRIMARY KEY, name TEXT, create_at INTEGER DEFAULT 100)`)
+	ctx := context.Background()
+
+	defer func(size int) { BatchInsertSize = size }(BatchInsertSize)
+	BatchInsertSize = 2
+
+	ents := []Entity{
+		&UpsertEntity{Code: "a", Name: "foo"},
+		&UpsertEntity{Code: "b", Name: "bar"},
+		&UpsertEntity{Code: "c", Name: "baz"},
+	}
+	require.NoError(t, BatchInsert(ctx, ents, db))
+
+	// RETURNING字段按顺序写回每个entity
+	for _, ent := range ents {
+		require.Equal(t, int64(100), ent.(*UpsertEntity).CreateAt)
+	}
+
+	var names []string
+	require.NoError(t, db.Select(&names, `SELECT name FROM upsert ORDER BY code`))
+	require.Equal(t, []string{"foo", "bar", "baz"}, names)
+
+	err := BatchInsert(ctx, []Entity{
+		&UpsertEntity{Code: "d"},
+		&UpsertEntity{Code: "e"},
+		&UpsertEntity{Code: "a"},
+	}, db)
+	require.True(t, errors.Is(err, ErrConflict))
+
+	var be *BatchError
+	require.True(t, errors.As(err, &be))
+	require.Equal(t, int64(2), be.Processed)
+
+	require.Error(t, BatchInsert(ctx, []Entity{&UpsertEntity{Code: "f"}, &MirrorEntity{}}, db))
+	require.NoError(t, BatchInsert(ctx, nil, db))
+}
+
+func TestBatchInsertStatement(t *testing.T) {
+	stmt := newInsert(&Metadata{TableName: "upsert"}, driverPostgres).
+		column("code", "name").
+		tuple("(?, ?)", "(?, ?)").
+		returning("create_at").
+		String()
+	require.Equal(t, `INSERT INTO "upsert" ("code", "name") VALUES (?, ?), (?, ?) RETURNING "create_at"`, stmt)
+}
+
+func TestBatchInsertMaxStatementBytes(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE upsert (code TEXT PRIMARY KEY, name TEXT, create_at INTEGER DEFAULT 100)`)
+	ctx := context.Background()
+
+	var queries []string
+	Use(LoggingMiddleware(func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error) {
+		queries = append(queries, query)
+	}))
+	defer resetMiddlewares()
+
+	SetMaxStatementBytes(150)
+	defer SetMaxStatementBytes(0)
+
+	// 每条语句最多容纳两条记录
+	ents := []Entity{
+		&UpsertEntity{Code: "a", Name: strings.Repeat("a", 20)},
+		&UpsertEntity{Code: "b", Name: strings.Repeat("b", 20)},
+		&UpsertEntity{Code: "c", Name: strings.Repeat("c", 20)},
+		// 单条记录超过限制时单独执行
+		&UpsertEntity{Code: "d", Name: strings.Repeat("d", 200)},
+		&UpsertEntity{Code: "e", Name: "e"},
+	}
+	require.NoError(t, BatchInsert(ctx, ents, db))
+	require.Len(t, queries, 4)
+	require.Equal(t, 2, strings.Count(queries[0], "(?, ?)"))
+	require.Equal(t, 1, strings.Count(queries[1], "(?, ?)"))
+	require.Equal(t, 1, strings.Count(queries[2], "(?, ?)"))
+	require.Equal(t, 1, strings.Count(queries[3], "(?, ?)"))
+
+	for _, ent := range ents {
+		require.Equal(t, int64(100), ent.(*UpsertEntity).CreateAt)
+	}
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM upsert`))
+	require.Equal(t, 5, n)
+
+	// 不限制时合并为一条语句
+	queries = nil
+	SetMaxStatementBytes(0)
+	require.NoError(t, BatchInsert(ctx, []Entity{
+		&UpsertEntity{Code: "f", Name: strings.Repeat("f", 200)},
+		&UpsertEntity{Code: "g", Name: strings.Repeat("g", 200)},
+	}, db))
+	require.Len(t, queries, 1)
+}
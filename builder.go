@@ -0,0 +1,235 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 内部使用的SQL语句构造器，统一处理表名、字段名的引号以及子句的顺序
+// 表名和字段名在添加时按照数据库类型加上引号，条件、表达式以及占位符原样输出
+type sqlBuilder struct {
+	driver    string
+	verb      string
+	table     string
+	cols      []string
+	vals      []string
+	tuples    []string
+	sets      []string
+	conds     []string
+	conflict  string
+	orders    []string
+	rowLimit  int
+	rowOffset int
+	returns   []string
+}
+
+func newSelect(md *Metadata, driver string) *sqlBuilder {
+	return newSQLBuilder("SELECT", quoteTable(md, driver), driver)
+}
+
+func newInsert(md *Metadata, driver string) *sqlBuilder {
+	return newSQLBuilder("INSERT", quoteTable(md, driver), driver)
+}
+
+func newUpdate(md *Metadata, driver string) *sqlBuilder {
+	return newSQLBuilder("UPDATE", quoteTable(md, driver), driver)
+}
+
+func newDelete(md *Metadata, driver string) *sqlBuilder {
+	return newSQLBuilder("DELETE", quoteTable(md, driver), driver)
+}
+
+// table为已经加上引号的表名
+func newSQLBuilder(verb string, table string, driver string) *sqlBuilder {
+	return &sqlBuilder{
+		driver: driver,
+		verb:   verb,
+		table:  table,
+	}
+}
+
+// SELECT查询的字段
+func (b *sqlBuilder) column(names ...string) *sqlBuilder {
+	for _, name := range names {
+		b.cols = append(b.cols, quoteColumn(name, b.driver))
+	}
+	return b
+}
+
+// SELECT查询的表达式，不加引号
+func (b *sqlBuilder) expr(exprs ...string) *sqlBuilder {
+	b.cols = append(b.cols, exprs...)
+	return b
+}
+
+// INSERT的字段以及对应的值
+func (b *sqlBuilder) value(name string, value string) *sqlBuilder {
+	b.cols = append(b.cols, quoteColumn(name, b.driver))
+	b.vals = append(b.vals, value)
+	return b
+}
+
+// INSERT多行数据，每一项是一行完整的值，例如(?, ?)，设置以后忽略value()的值
+func (b *sqlBuilder) tuple(tuples ...string) *sqlBuilder {
+	b.tuples = append(b.tuples, tuples...)
+	return b
+}
+
+// UPDATE的字段以及对应的值
+func (b *sqlBuilder) set(name string, value string) *sqlBuilder {
+	b.sets = append(b.sets, fmt.Sprintf("%s = %s", quoteColumn(name, b.driver), value))
+	return b
+}
+
+// WHERE条件，多个条件之间使用AND连接
+func (b *sqlBuilder) where(conds ...string) *sqlBuilder {
+	b.conds = append(b.conds, conds...)
+	return b
+}
+
+// INSERT冲突时的处理子句，例如ON CONFLICT DO NOTHING
+func (b *sqlBuilder) onConflict(clause string) *sqlBuilder {
+	b.conflict = clause
+	return b
+}
+
+// ORDER BY的表达式，不加引号
+func (b *sqlBuilder) orderBy(exprs ...string) *sqlBuilder {
+	b.orders = append(b.orders, exprs...)
+	return b
+}
+
+func (b *sqlBuilder) limit(n int) *sqlBuilder {
+	b.rowLimit = n
+	return b
+}
+
+func (b *sqlBuilder) offset(n int) *sqlBuilder {
+	b.rowOffset = n
+	return b
+}
+
+func (b *sqlBuilder) returning(names ...string) *sqlBuilder {
+	for _, name := range names {
+		b.returns = append(b.returns, quoteColumn(name, b.driver))
+	}
+	return b
+}
+
+func (b *sqlBuilder) String() string {
+	if b.driver == driverSqlserver {
+		return b.sqlserverString()
+	}
+
+	var sb strings.Builder
+
+	switch b.verb {
+	case "SELECT":
+		fmt.Fprintf(&sb, "SELECT %s FROM %s", strings.Join(b.cols, ", "), b.table)
+	case "INSERT":
+		if len(b.tuples) > 0 {
+			fmt.Fprintf(&sb, "INSERT INTO %s (%s) VALUES %s", b.table, strings.Join(b.cols, ", "), strings.Join(b.tuples, ", "))
+		} else {
+			fmt.Fprintf(&sb, "INSERT INTO %s (%s) VALUES (%s)", b.table, strings.Join(b.cols, ", "), strings.Join(b.vals, ", "))
+		}
+	case "UPDATE":
+		fmt.Fprintf(&sb, "UPDATE %s SET", b.table)
+		if len(b.sets) > 0 {
+			sb.WriteString(" " + strings.Join(b.sets, ", "))
+		}
+	case "DELETE":
+		fmt.Fprintf(&sb, "DELETE FROM %s", b.table)
+	}
+
+	if len(b.conds) > 0 {
+		sb.WriteString(" WHERE " + strings.Join(b.conds, " AND "))
+	}
+	if b.conflict != "" {
+		sb.WriteString(" " + b.conflict)
+	}
+	if len(b.orders) > 0 {
+		sb.WriteString(" ORDER BY " + strings.Join(b.orders, ", "))
+	}
+	if b.rowLimit > 0 {
+		fmt.Fprintf(&sb, " LIMIT %d", b.rowLimit)
+	}
+	if b.rowOffset > 0 {
+		fmt.Fprintf(&sb, " OFFSET %d", b.rowOffset)
+	}
+	if len(b.returns) > 0 {
+		sb.WriteString(" RETURNING " + strings.Join(b.returns, ", "))
+	}
+
+	return sb.String()
+}
+
+// sqlserver没有LIMIT和RETURNING
+// LIMIT改为TOP，有OFFSET时改为OFFSET ... FETCH NEXT，RETURNING改为写在WHERE之前的OUTPUT子句
+func (b *sqlBuilder) sqlserverString() string {
+	var sb strings.Builder
+
+	top := ""
+	if b.rowLimit > 0 && b.rowOffset == 0 {
+		top = fmt.Sprintf("TOP (%d) ", b.rowLimit)
+	}
+
+	switch b.verb {
+	case "SELECT":
+		fmt.Fprintf(&sb, "SELECT %s%s FROM %s", top, strings.Join(b.cols, ", "), b.table)
+	case "INSERT":
+		fmt.Fprintf(&sb, "INSERT INTO %s (%s)", b.table, strings.Join(b.cols, ", "))
+		if len(b.returns) > 0 {
+			sb.WriteString(" " + outputClause("INSERTED", b.returns))
+		}
+		if len(b.tuples) > 0 {
+			sb.WriteString(" VALUES " + strings.Join(b.tuples, ", "))
+		} else {
+			fmt.Fprintf(&sb, " VALUES (%s)", strings.Join(b.vals, ", "))
+		}
+	case "UPDATE":
+		fmt.Fprintf(&sb, "UPDATE %s%s SET", top, b.table)
+		if len(b.sets) > 0 {
+			sb.WriteString(" " + strings.Join(b.sets, ", "))
+		}
+		if len(b.returns) > 0 {
+			sb.WriteString(" " + outputClause("INSERTED", b.returns))
+		}
+	case "DELETE":
+		fmt.Fprintf(&sb, "DELETE %sFROM %s", top, b.table)
+		if len(b.returns) > 0 {
+			sb.WriteString(" " + outputClause("DELETED", b.returns))
+		}
+	}
+
+	if len(b.conds) > 0 {
+		sb.WriteString(" WHERE " + strings.Join(b.conds, " AND "))
+	}
+	if b.conflict != "" {
+		sb.WriteString(" " + b.conflict)
+	}
+
+	if b.rowOffset > 0 {
+		// OFFSET必须和ORDER BY一起使用
+		orders := b.orders
+		if len(orders) == 0 {
+			orders = []string{"(SELECT NULL)"}
+		}
+		fmt.Fprintf(&sb, " ORDER BY %s OFFSET %d ROWS", strings.Join(orders, ", "), b.rowOffset)
+		if b.rowLimit > 0 {
+			fmt.Fprintf(&sb, " FETCH NEXT %d ROWS ONLY", b.rowLimit)
+		}
+	} else if len(b.orders) > 0 {
+		sb.WriteString(" ORDER BY " + strings.Join(b.orders, ", "))
+	}
+
+	return sb.String()
+}
+
+// sqlserver的OUTPUT子句，prefix为INSERTED或DELETED，cols为已经加上引号的字段名
+func outputClause(prefix string, cols []string) string {
+	result := make([]string, 0, len(cols))
+	for _, col := range cols {
+		result = append(result, prefix+"."+col)
+	}
+	return "OUTPUT " + strings.Join(result, ", ")
+}
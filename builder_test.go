@@ -0,0 +1,247 @@
+package entity
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// 所有语句构造方法的输出，重构语句构造时输出必须保持不变
+func TestStatementGolden(t *testing.T) {
+	ents := map[string]Entity{
+		"genernal":        &GenernalEntity{},
+		"generated":       &GeneratedEntity{},
+		"mirror":          &MirrorEntity{},
+		"nullable_key":    &NullableKeyEntity{},
+		"returning_extra": &ReturningExtraEntity{},
+		"upsert":          &UpsertEntity{},
+	}
+
+	actual := map[string]string{}
+	for name, ent := range ents {
+		md, err := newTestMetadata(ent)
+		if err != nil {
+			t.Fatalf("%s metadata, %v", name, err)
+		}
+
+		for _, driver := range []string{driverMysql, driverPostgres, driverSqlite3} {
+			key := func(kind string) string {
+				return name + "/" + driver + "/" + kind
+			}
+
+			actual[key("select")] = selectStatement(ent, md, driver)
+			actual[key("insert")] = insertStatement(ent, md, driver)
+			actual[key("update")] = updateStatement(ent, md, driver)
+			actual[key("delete")] = deleteStatement(ent, md, driver)
+			head, tail := insertUnlessStatement(ent, md, driver, "name = ?")
+			actual[key("insert_unless")] = head + tail
+			actual[key("insert_map")] = insertMapStatement(md.TableName, map[string]interface{}{"b": 1, "a": 2}, driver)
+			actual[key("upsert_insert")] = upsertInsertStatement(ent, md, driver)
+			actual[key("upsert")] = upsertStatement(ent, md, driver)
+			actual[key("exists")] = existsStatement(md, driver, "name = ?")
+			actual[key("delete_chunk")] = deleteChunkStatement(md, driver, "name = ?", 100)
+			actual[key("delete_where")] = deleteWhereStatement(md, driver, "name = ?")
+			if driver != driverMysql && len(md.PrimaryKeys) == 1 {
+				actual[key("insert_missing")] = insertMissingStatement(ent, md, driver)
+			}
+		}
+	}
+
+	file := filepath.Join("testdata", "statements.golden.json")
+	if *updateGolden {
+		data, err := json.MarshalIndent(actual, "", "\t")
+		if err != nil {
+			t.Fatalf("encode golden, %v", err)
+		}
+		if err := os.WriteFile(file, append(data, '\n'), 0o644); err != nil {
+			t.Fatalf("write golden, %v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read golden, %v", err)
+	}
+
+	expected := map[string]string{}
+	if err := json.Unmarshal(data, &expected); err != nil {
+		t.Fatalf("decode golden, %v", err)
+	}
+
+	keys := []string{}
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if actual[k] != expected[k] {
+			t.Errorf("%s, Expected=%s, Actual=%s", k, expected[k], actual[k])
+		}
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("golden statements, Expected=%d, Actual=%d", len(expected), len(actual))
+	}
+}
+
+// 生成字段只出现在查询语句内，插入及更新语句都不包含
+func TestGeneratedStatements(t *testing.T) {
+	ent := &GeneratedEntity{}
+	md, err := newTestMetadata(ent)
+	if err != nil {
+		t.Fatalf("metadata, %v", err)
+	}
+
+	for _, driver := range []string{driverMysql, driverPostgres, driverSqlite3, driverSqlserver} {
+		if stmt := selectStatement(ent, md, driver); !strings.Contains(stmt, "total") {
+			t.Fatalf("%s select, expected generated column, got %s", driver, stmt)
+		}
+
+		head, tail := insertUnlessStatement(ent, md, driver, "price = ?")
+		stmts := map[string]string{
+			"insert":        insertStatement(ent, md, driver),
+			"update":        updateStatement(ent, md, driver),
+			"insert_unless": head + tail,
+		}
+		if driver != driverSqlserver {
+			stmts["upsert"] = upsertStatement(ent, md, driver)
+		}
+		if driver != driverMysql && driver != driverSqlserver {
+			stmts["insert_missing"] = insertMissingStatement(ent, md, driver)
+		}
+
+		for kind, stmt := range stmts {
+			if strings.Contains(stmt, "total") {
+				t.Fatalf("%s %s, unexpected generated column, got %s", driver, kind, stmt)
+			}
+		}
+	}
+}
+
+type RawTableEntity struct {
+	ID   int    `db:"id,primaryKey"`
+	Name string `db:"name"`
+}
+
+func (rte RawTableEntity) TableName() string {
+	return "ONLY parent_table"
+}
+
+func (rte RawTableEntity) RawTableName() bool {
+	return true
+}
+
+func (rte *RawTableEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func TestRawTableName(t *testing.T) {
+	md, err := getMetadata(&RawTableEntity{})
+	if err != nil {
+		t.Fatalf("get metadata, %v", err)
+	}
+
+	expected := `SELECT "id", "name" FROM ONLY parent_table WHERE "id" = :id LIMIT 1`
+	if actual := selectStatement(&RawTableEntity{}, md, driverPostgres); actual != expected {
+		t.Fatalf("raw table, Expected=%s, Actual=%s", expected, actual)
+	}
+
+	// 同名但没有声明RawTableName的entity仍然加引号
+	qmd, err := getMetadata(&QuotedTableEntity{})
+	if err != nil {
+		t.Fatalf("get metadata, %v", err)
+	}
+
+	expected = `SELECT "id" FROM "ONLY parent_table"`
+	if actual := newSelect(qmd, driverPostgres).column("id").String(); actual != expected {
+		t.Fatalf("quoted table, Expected=%s, Actual=%s", expected, actual)
+	}
+}
+
+type QuotedTableEntity struct {
+	ID int `db:"id,primaryKey"`
+}
+
+func (qte QuotedTableEntity) TableName() string {
+	return "ONLY parent_table"
+}
+
+func (qte *QuotedTableEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func TestSqlserverStatements(t *testing.T) {
+	ent := &GenernalEntity{}
+	md, err := newTestMetadata(ent)
+	if err != nil {
+		t.Fatalf("get metadata, %v", err)
+	}
+
+	head, tail := insertUnlessStatement(ent, md, driverSqlserver, "name = ?")
+
+	cases := []struct {
+		name     string
+		actual   string
+		expected string
+	}{
+		{
+			name:     "select",
+			actual:   selectStatement(ent, md, driverSqlserver),
+			expected: "SELECT TOP (1) [create_at], [extra], [id], [id2], [name], [version] FROM [genernal] WHERE [id] = :id AND [id2] = :id2",
+		},
+		{
+			name:     "insert",
+			actual:   insertStatement(ent, md, driverSqlserver),
+			expected: "INSERT INTO [genernal] ([extra], [id2], [name]) OUTPUT INSERTED.[create_at], INSERTED.[id], INSERTED.[version] VALUES (:extra, :id2, :name)",
+		},
+		{
+			name:     "update",
+			actual:   updateStatement(ent, md, driverSqlserver),
+			expected: "UPDATE [genernal] SET [extra] = :extra, [name] = :name OUTPUT INSERTED.[version] WHERE [id] = :id AND [id2] = :id2",
+		},
+		{
+			name:     "delete",
+			actual:   deleteStatement(ent, md, driverSqlserver),
+			expected: "DELETE FROM [genernal] WHERE [id] = :id AND [id2] = :id2",
+		},
+		{
+			name:     "insert_unless",
+			actual:   head + tail,
+			expected: "INSERT INTO [genernal] ([extra], [id2], [name]) OUTPUT INSERTED.[create_at], INSERTED.[version] SELECT :extra, :id2, :name WHERE NOT EXISTS (SELECT 1 FROM [genernal] WHERE name = ?)",
+		},
+		{
+			name:     "delete_chunk",
+			actual:   deleteChunkStatement(md, driverSqlserver, "name = ?", 100),
+			expected: "DELETE TOP (100) FROM [genernal] WHERE name = ?",
+		},
+		{
+			name:     "delete_where",
+			actual:   deleteWhereStatement(md, driverSqlserver, "id = ?"),
+			expected: "DELETE FROM [genernal] OUTPUT DELETED.[create_at], DELETED.[extra], DELETED.[id], DELETED.[id2], DELETED.[name], DELETED.[version] WHERE id = ?",
+		},
+		{
+			name:     "offset",
+			actual:   newSelect(&Metadata{TableName: "dbo.genernal"}, driverSqlserver).column("id").orderBy("[id]").limit(10).offset(20).String(),
+			expected: "SELECT [id] FROM [dbo].[genernal] ORDER BY [id] OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY",
+		},
+		{
+			name:     "offset without order",
+			actual:   newSelect(md, driverSqlserver).column("id").offset(20).String(),
+			expected: "SELECT [id] FROM [genernal] ORDER BY (SELECT NULL) OFFSET 20 ROWS",
+		},
+	}
+
+	for _, c := range cases {
+		if c.actual != c.expected {
+			t.Fatalf("%s, Expected=%s, Actual=%s", c.name, c.expected, c.actual)
+		}
+	}
+}
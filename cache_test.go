@@ -1,7 +1,13 @@
 package entity
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -39,3 +45,111 @@ func TestRecursiveDecode(t *testing.T) {
 		require.Equal(t, c.expected, fixed)
 	}
 }
+
+type memoryCacher struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryCacher() *memoryCacher {
+	return &memoryCacher{data: map[string][]byte{}}
+}
+
+func (mc *memoryCacher) Get(key string) ([]byte, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return mc.data[key], nil
+}
+
+func (mc *memoryCacher) Put(key string, data []byte, expiration time.Duration) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.data[key] = data
+	return nil
+}
+
+func (mc *memoryCacher) Delete(key string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	delete(mc.data, key)
+	return nil
+}
+
+func (mc *memoryCacher) has(key string) bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	_, ok := mc.data[key]
+	return ok
+}
+
+type CachedTenantEntity struct {
+	TenantEntity
+
+	cacher *memoryCacher
+}
+
+func (cte *CachedTenantEntity) CacheOption() CacheOption {
+	return CacheOption{
+		Cacher:     cte.cacher,
+		Key:        fmt.Sprintf("tenant:%d", cte.ID),
+		Expiration: time.Minute,
+	}
+}
+
+func TestCacheDefaultScope(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT)`,
+		`INSERT INTO tenant (id, tenant_id, name) VALUES (1, 1, 'foo')`,
+	)
+	ctx := context.Background()
+	ctx2 := context.WithValue(ctx, tenantKey{}, 2)
+	cacher := newMemoryCacher()
+
+	// 没有默认条件时正常缓存
+	ent := &CachedTenantEntity{TenantEntity: TenantEntity{ID: 1}, cacher: cacher}
+	require.NoError(t, Load(ctx, ent, db))
+	require.True(t, cacher.has("tenant:1"))
+
+	// 其它租户不能读取缓存内的记录
+	ent = &CachedTenantEntity{TenantEntity: TenantEntity{ID: 1}, cacher: cacher}
+	require.True(t, errors.Is(Load(ctx2, ent, db), sql.ErrNoRows))
+	require.Equal(t, "", ent.Name)
+
+	// 有默认条件时不写入缓存
+	require.NoError(t, cacher.Delete("tenant:1"))
+	ent = &CachedTenantEntity{TenantEntity: TenantEntity{ID: 1}, cacher: cacher}
+	require.NoError(t, Load(context.WithValue(ctx, tenantKey{}, 1), ent, db))
+	require.Equal(t, "foo", ent.Name)
+	require.False(t, cacher.has("tenant:1"))
+}
+
+func TestCacheColumnMask(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT)`,
+		`INSERT INTO tenant (id, tenant_id, name) VALUES (1, 1, 'foo')`,
+	)
+	ctx := context.Background()
+	masked := WithColumnMask(ctx, []string{"id", "tenant_id"})
+	cacher := newMemoryCacher()
+
+	// 部分读取的结果不写入缓存
+	ent := &CachedTenantEntity{TenantEntity: TenantEntity{ID: 1}, cacher: cacher}
+	require.NoError(t, Load(masked, ent, db))
+	require.Equal(t, 1, ent.TenantID)
+	require.Equal(t, "", ent.Name)
+	require.False(t, cacher.has("tenant:1"))
+
+	ent = &CachedTenantEntity{TenantEntity: TenantEntity{ID: 1}, cacher: cacher}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo", ent.Name)
+	require.True(t, cacher.has("tenant:1"))
+
+	// 缓存内的完整记录不能绕过字段限制
+	ent = &CachedTenantEntity{TenantEntity: TenantEntity{ID: 1}, cacher: cacher}
+	require.NoError(t, Load(masked, ent, db))
+	require.Equal(t, "", ent.Name)
+}
@@ -0,0 +1,270 @@
+// entitygen 为entity生成Columns()、PrimaryKeyArgs()、ScanDests()方法，按主键读取时不再需要反射
+//
+// 在entity所在的文件内加上
+//
+//	//go:generate go run github.com/joyparty/entity/cmd/entitygen -type=User,Order
+//
+// 然后执行go generate，默认输出到entity_gen.go
+// 只支持没有匿名嵌入字段的struct，struct的字段或tag修改以后需要重新生成
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of entity type names; required")
+	output    = flag.String("output", "entity_gen.go", "output file name")
+)
+
+func main() {
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := generateDir(".", os.Getenv("GOPACKAGE"), strings.Split(*typeNames, ","))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "entitygen: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "entitygen: write %s, %v\n", *output, err)
+		os.Exit(1)
+	}
+}
+
+// 解析目录内的go文件，pkgName为空时使用目录内唯一的包
+func generateDir(dir string, pkgName string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != filepath.Base(*output)
+	}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s, %w", dir, err)
+	}
+
+	if pkgName == "" {
+		if len(pkgs) != 1 {
+			return nil, fmt.Errorf("expect one package in %s, got %d", dir, len(pkgs))
+		}
+		for name := range pkgs {
+			pkgName = name
+		}
+	}
+
+	pkg, ok := pkgs[pkgName]
+	if !ok {
+		return nil, fmt.Errorf("package %q not found in %s", pkgName, dir)
+	}
+
+	files := make([]*ast.File, 0, len(pkg.Files))
+	for _, f := range pkg.Files {
+		files = append(files, f)
+	}
+	return generate(pkgName, files, types)
+}
+
+type field struct {
+	name       string
+	column     string
+	primaryKey bool
+	// primaryKey=N指定的主键顺序，0表示没有指定
+	keyOrder int
+}
+
+// 生成代码，types的顺序决定输出顺序
+func generate(pkgName string, files []*ast.File, types []string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by entitygen. DO NOT EDIT.\n\npackage %s\n", pkgName)
+
+	for _, name := range types {
+		name = strings.TrimSpace(name)
+
+		st := findStruct(files, name)
+		if st == nil {
+			return nil, fmt.Errorf("struct %q not found", name)
+		}
+
+		fields, err := structFields(st)
+		if err != nil {
+			return nil, fmt.Errorf("struct %q, %w", name, err)
+		}
+		writeMethods(&buf, name, fields)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format source, %w", err)
+	}
+	return src, nil
+}
+
+func findStruct(files []*ast.File, name string) *ast.StructType {
+	// map遍历顺序不固定，按解析顺序(文件名顺序)查找保证结果稳定
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name.Pos() < files[j].Name.Pos()
+	})
+
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name != name {
+					continue
+				}
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					return st
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 与entity元数据一致的字段顺序及字段名，忽略未导出的字段以及db:"-"
+func structFields(st *ast.StructType) ([]field, error) {
+	fields := []field{}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("embedded field %s is not supported", exprString(f.Type))
+		}
+
+		var tag string
+		if f.Tag != nil {
+			v, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag %s, %w", f.Tag.Value, err)
+			}
+			tag = reflect.StructTag(v).Get("db")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		for _, ident := range f.Names {
+			if !ident.IsExported() {
+				continue
+			}
+
+			fd := field{name: ident.Name, column: parts[0]}
+			if fd.column == "" {
+				fd.column = ident.Name
+			}
+			for _, opt := range parts[1:] {
+				key, value, _ := strings.Cut(opt, "=")
+				if key == "primaryKey" || key == "primary_key" {
+					fd.primaryKey = true
+					if value != "" {
+						n, err := strconv.Atoi(value)
+						if err != nil || n <= 0 {
+							return nil, fmt.Errorf("field %s, invalid primary key order %q", ident.Name, value)
+						}
+						fd.keyOrder = n
+					}
+				}
+			}
+			fields = append(fields, fd)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	return fields, nil
+}
+
+func writeMethods(buf *bytes.Buffer, name string, fields []field) {
+	recv := receiverName(name)
+	columnsVar := string(unicode.ToLower(rune(name[0]))) + name[1:] + "Columns"
+
+	columns := make([]string, 0, len(fields))
+	pks := []field{}
+	for _, f := range fields {
+		columns = append(columns, strconv.Quote(f.column))
+		if f.primaryKey {
+			pks = append(pks, f)
+		}
+	}
+
+	// 与entity.Metadata.PrimaryKeys的顺序一致，指定了顺序的主键在前
+	sort.SliceStable(pks, func(i, j int) bool {
+		a, b := pks[i].keyOrder, pks[j].keyOrder
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+	keys := make([]string, 0, len(pks))
+	for _, f := range pks {
+		keys = append(keys, recv+"."+f.name)
+	}
+
+	fmt.Fprintf(buf, "\nvar %s = []string{%s}\n", columnsVar, strings.Join(columns, ", "))
+
+	fmt.Fprintf(buf, "\n// Columns implements entity.ColumnList\n")
+	fmt.Fprintf(buf, "func (%s *%s) Columns() []string {\n\treturn %s\n}\n", recv, name, columnsVar)
+
+	fmt.Fprintf(buf, "\n// PrimaryKeyArgs implements entity.PrimaryKeyArg\n")
+	fmt.Fprintf(buf, "func (%s *%s) PrimaryKeyArgs() []interface{} {\n\treturn []interface{}{%s}\n}\n", recv, name, strings.Join(keys, ", "))
+
+	fmt.Fprintf(buf, "\n// ScanDests implements entity.ScanDest\n")
+	fmt.Fprintf(buf, "func (%s *%s) ScanDests(cols []string) []interface{} {\n", recv, name)
+	fmt.Fprintf(buf, "\tdests := make([]interface{}, len(cols))\n")
+	fmt.Fprintf(buf, "\tfor i, col := range cols {\n\t\tswitch col {\n")
+	for _, f := range fields {
+		fmt.Fprintf(buf, "\t\tcase %q:\n\t\t\tdests[i] = &%s.%s\n", f.column, recv, f.name)
+	}
+	fmt.Fprintf(buf, "\t\tdefault:\n\t\t\tdests[i] = new(interface{})\n\t\t}\n\t}\n\treturn dests\n}\n")
+}
+
+// 类型名内大写字母的小写形式，例如OrderItem使用oi
+func receiverName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			sb.WriteRune(unicode.ToLower(r))
+		}
+	}
+
+	recv := sb.String()
+	switch recv {
+	case "", "i", "col", "cols", "dests":
+		// 避免与ScanDests内的变量同名
+		return "ent"
+	}
+	return recv
+}
+
+func exprString(expr ast.Expr) string {
+	switch v := expr.(type) {
+	case *ast.Ident:
+		return v.Name
+	case *ast.StarExpr:
+		return "*" + exprString(v.X)
+	case *ast.SelectorExpr:
+		return exprString(v.X) + "." + v.Sel.Name
+	}
+	return fmt.Sprintf("%T", expr)
+}
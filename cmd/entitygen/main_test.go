@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	src, err := generateDir("testdata", "", []string{"User", "OrderItem", "Item"})
+	if err != nil {
+		t.Fatalf("generate, %v", err)
+	}
+
+	golden := filepath.Join("testdata", "output.golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, src, 0o644); err != nil {
+			t.Fatalf("write golden file, %v", err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file, %v", err)
+	}
+	if !bytes.Equal(expected, src) {
+		t.Fatalf("generated code mismatch golden file, run go test -update\n%s", src)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	for _, name := range []string{"Embedded", "NotFound"} {
+		if _, err := generateDir("testdata", "", []string{name}); err == nil {
+			t.Fatalf("%s, Expected error", name)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+type User struct {
+	ID       int64     `db:"user_id,primaryKey,autoIncrement"`
+	Name     string    `db:"name,size=64"`
+	Email    string    `db:"email,mirror=email_copy"`
+	CreateAt time.Time `db:"create_at,refuseUpdate,returningInsert"`
+	Status   string
+	Other    bool `db:"-"`
+	internal int
+}
+
+func (u User) TableName() string {
+	return "users"
+}
+
+func (u *User) OnEntityEvent(ctx context.Context, ev int) error {
+	return nil
+}
+
+type OrderItem struct {
+	OrderID int64 `db:"order_id,primaryKey=2"`
+	ItemID  int64 `db:"item_id,primary_key=1"`
+	Amount  int   `db:"amount"`
+}
+
+type Item struct {
+	ID int64 `db:"id,primaryKey"`
+}
+
+type Embedded struct {
+	User
+	Extra string `db:"extra"`
+}
@@ -0,0 +1,176 @@
+package entity
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// ColumnCodec 字段编解码器，写入前编码字段值，读取后解码
+// 只用于string及[]byte类型的字段，数据库字段类型应该是bytea或blob
+type ColumnCodec interface {
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+var (
+	codecs   = map[string]ColumnCodec{"gzip": gzipCodec{}}
+	codecsMu sync.RWMutex
+)
+
+// RegisterCodec 注册字段编解码器，通过`db:"content,codec=name"`使用
+// 编解码器应该在程序初始化阶段，声明entity metadata之前注册
+func RegisterCodec(name string, c ColumnCodec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[name] = c
+}
+
+func getCodec(name string) (ColumnCodec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// gzip压缩，空值原样保存，不会产生只有头部的gzip数据
+type gzipCodec struct{}
+
+func (gzipCodec) Encode(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// 返回编码之后的绑定参数，没有编码字段、网络地址字段以及转换器字段时原样返回
+// arg为entity时转换为map，arg为map时直接修改
+func encodeArg(ent Entity, md *Metadata, arg interface{}) (interface{}, error) {
+	if !md.hasCodec && !md.hasInet && !md.hasConverter {
+		return arg, nil
+	}
+
+	args, ok := arg.(map[string]interface{})
+	if !ok {
+		args = entityArgs(ent, md)
+	}
+
+	for _, col := range md.Columns {
+		if col.Inet != "" {
+			if val, ok := args[col.DBField]; ok {
+				args[col.DBField] = inetValue(val)
+			}
+			continue
+		} else if col.Converter != "" {
+			if val, ok := args[col.DBField]; ok {
+				v, err := bindConverted(col, val)
+				if err != nil {
+					return nil, err
+				}
+				args[col.DBField] = v
+			}
+			continue
+		} else if col.Codec == "" {
+			continue
+		}
+
+		val, ok := args[col.DBField]
+		if !ok || val == nil {
+			continue
+		}
+
+		var data []byte
+		if rv := reflect.ValueOf(val); rv.Kind() == reflect.String {
+			data = []byte(rv.String())
+		} else if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			data = rv.Bytes()
+		} else {
+			return nil, fmt.Errorf("column %q, codec %q unsupported type %T", col.DBField, col.Codec, val)
+		}
+
+		c, _ := getCodec(col.Codec)
+		encoded, err := c.Encode(data)
+		if err != nil {
+			return nil, fmt.Errorf("column %q, encode %q, %w", col.DBField, col.Codec, err)
+		}
+		args[col.DBField] = encoded
+	}
+
+	return args, nil
+}
+
+// entity所有字段的值，key为数据库字段名
+func entityArgs(ent Entity, md *Metadata) map[string]interface{} {
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	args := make(map[string]interface{}, len(md.Columns))
+	for _, col := range md.Columns {
+		// nil指针字段需要保持为nil，写入NULL
+		if f, ok := readField(v, col.DBField); ok {
+			args[col.DBField] = f.Interface()
+		} else {
+			args[col.DBField] = nil
+		}
+	}
+	return args
+}
+
+// 读取数据之后解码entity的编码字段，names为本次读取的字段
+func decodeValues(ent Entity, md *Metadata, names []string) error {
+	if !md.hasCodec {
+		return nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, name := range names {
+		col, ok := md.Column(name)
+		if !ok || col.Codec == "" {
+			continue
+		}
+
+		c, _ := getCodec(col.Codec)
+		f := mapper.FieldByName(v, col.DBField)
+		switch {
+		case f.Kind() == reflect.String:
+			data, err := c.Decode([]byte(f.String()))
+			if err != nil {
+				return fmt.Errorf("column %q, decode %q, %w", col.DBField, col.Codec, err)
+			}
+			f.SetString(string(data))
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+			data, err := c.Decode(f.Bytes())
+			if err != nil {
+				return fmt.Errorf("column %q, decode %q, %w", col.DBField, col.Codec, err)
+			}
+			f.SetBytes(data)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipCodec(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE codec (id INTEGER PRIMARY KEY, content BLOB, raw BLOB)`)
+	ctx := context.Background()
+
+	content := strings.Repeat("hello entity ", 10000)
+	ent := &CodecEntity{Content: content, Raw: []byte(content)}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	var stored []byte
+	require.NoError(t, db.QueryRow(`SELECT content FROM codec WHERE id = ?`, ent.ID).Scan(&stored))
+	require.True(t, len(stored) < len(content))
+	require.Equal(t, []byte{0x1f, 0x8b}, stored[:2])
+
+	loaded := &CodecEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, content, loaded.Content)
+	require.Equal(t, []byte(content), loaded.Raw)
+
+	// 空值不压缩
+	loaded.Content = ""
+	require.NoError(t, Update(ctx, loaded, db))
+	require.NoError(t, db.QueryRow(`SELECT content FROM codec WHERE id = ?`, ent.ID).Scan(&stored))
+	require.Empty(t, stored)
+
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, "", loaded.Content)
+
+	_, err = NewMetadata(&BadCodecEntity{})
+	require.Error(t, err)
+}
+
+type CodecEntity struct {
+	ID      int    `db:"id,primaryKey,returningInsert"`
+	Content string `db:"content,codec=gzip"`
+	Raw     []byte `db:"raw,codec=gzip"`
+}
+
+func (ce CodecEntity) TableName() string {
+	return "codec"
+}
+
+func (ce *CodecEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadCodecEntity struct {
+	ID      int    `db:"id,primaryKey"`
+	Content string `db:"content,codec=zstd"`
+}
+
+func (bce BadCodecEntity) TableName() string {
+	return "bad_codec"
+}
+
+func (bce *BadCodecEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+// 批量读取同样逐行解码，不能直接把压缩后的字节写入字段
+func TestGzipCodecSelect(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE codec (id INTEGER PRIMARY KEY, content BLOB, raw BLOB)`)
+	ctx := context.Background()
+
+	for _, content := range []string{"foo", "bar"} {
+		_, err := Insert(ctx, &CodecEntity{Content: content, Raw: []byte(content)}, db)
+		require.NoError(t, err)
+	}
+
+	check := func(list []*CodecEntity) {
+		require.Len(t, list, 2)
+		require.Equal(t, "foo", list[0].Content)
+		require.Equal(t, []byte("foo"), list[0].Raw)
+		require.Equal(t, "bar", list[1].Content)
+	}
+
+	var list []*CodecEntity
+	require.NoError(t, List(ctx, db, &list, nil, WithOrderBy("id")))
+	check(list)
+
+	list, err := Select[*CodecEntity]().OrderBy("id").All(ctx, db)
+	require.NoError(t, err)
+	check(list)
+
+	require.NoError(t, FindByIDs(ctx, db, &list, []interface{}{1, 2}))
+	check(list)
+
+	require.NoError(t, LoadManyOrdered(ctx, db, &list, []int{1, 2}))
+	check(list)
+
+	require.NoError(t, SelectRanked(ctx, db, &list, nil, []string{"id"}, 2, ""))
+	check(list)
+}
@@ -0,0 +1,137 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// 与entitygen生成的代码一致
+type FastEntity struct {
+	ID   int64  `db:"id,primaryKey"`
+	Name string `db:"name"`
+}
+
+func (fe FastEntity) TableName() string {
+	return "fast"
+}
+
+func (fe *FastEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+var fastEntityColumns = []string{"id", "name"}
+
+func (fe *FastEntity) Columns() []string {
+	return fastEntityColumns
+}
+
+func (fe *FastEntity) PrimaryKeyArgs() []interface{} {
+	return []interface{}{fe.ID}
+}
+
+func (fe *FastEntity) ScanDests(cols []string) []interface{} {
+	dests := make([]interface{}, len(cols))
+	for i, col := range cols {
+		switch col {
+		case "id":
+			dests[i] = &fe.ID
+		case "name":
+			dests[i] = &fe.Name
+		default:
+			dests[i] = new(interface{})
+		}
+	}
+	return dests
+}
+
+// 生成代码过期，字段与元数据不一致
+type StaleEntity struct {
+	FastEntity
+	Extra string `db:"extra"`
+}
+
+func TestGeneratedAccessors(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE fast (id INTEGER PRIMARY KEY, name TEXT)`,
+		`INSERT INTO fast (id, name) VALUES (1, 'foo')`,
+	)
+	ctx := context.Background()
+
+	md, err := getMetadata(&FastEntity{})
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "id", "name" FROM "fast" WHERE "id" = ? LIMIT 1`, argSelectStatement(md, driverSqlite3))
+
+	ent := &FastEntity{ID: 1}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo", ent.Name)
+
+	err = Load(ctx, &FastEntity{ID: 2}, db)
+	require.True(t, errors.Is(err, sql.ErrNoRows))
+
+	// 限制读取字段时使用普通的读取方式
+	ent = &FastEntity{ID: 1}
+	require.NoError(t, Load(WithColumnMask(ctx, []string{"id"}), ent, db))
+	require.Equal(t, "", ent.Name)
+
+	registry := NewRegistry(driverSqlite3)
+	require.NoError(t, registry.Register(&FastEntity{}))
+	require.Error(t, registry.Register(&StaleEntity{}))
+}
+
+// 没有生成代码的同一张表，用于对比
+type ReflectFastEntity struct {
+	ID   int64  `db:"id,primaryKey"`
+	Name string `db:"name"`
+}
+
+func (rfe ReflectFastEntity) TableName() string {
+	return "fast"
+}
+
+func (rfe *ReflectFastEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+// 保存基准测试的结果，避免被编译器优化掉
+var (
+	benchLoadName string
+	benchLoadErr  error
+)
+
+func BenchmarkLoad(b *testing.B) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	db.MustExec(`CREATE TABLE fast (id INTEGER PRIMARY KEY, name TEXT)`)
+	db.MustExec(`INSERT INTO fast (id, name) VALUES (1, 'foo')`)
+	ctx := context.Background()
+
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ent := &FastEntity{ID: 1}
+			benchLoadErr = Load(ctx, ent, db)
+			benchLoadName = ent.Name
+		}
+		if benchLoadErr != nil || benchLoadName != "foo" {
+			b.Fatalf("load, name=%q, %v", benchLoadName, benchLoadErr)
+		}
+	})
+
+	b.Run("reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ent := &ReflectFastEntity{ID: 1}
+			benchLoadErr = Load(ctx, ent, db)
+			benchLoadName = ent.Name
+		}
+		if benchLoadErr != nil || benchLoadName != "foo" {
+			b.Fatalf("load, name=%q, %v", benchLoadName, benchLoadErr)
+		}
+	})
+}
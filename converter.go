@@ -0,0 +1,133 @@
+package entity
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ColumnConverter 字段值转换器，用于旧数据库内使用非常规格式保存的字段，例如用'Y'/'N'保存布尔值
+// 与ColumnCodec不同，转换前后的类型可以不同，entity字段可以直接使用正常的Go类型
+type ColumnConverter interface {
+	// Scan 把数据库返回的原始值转换为字段类型的值，src为nil表示NULL，返回nil时字段设置为零值
+	Scan(src interface{}) (interface{}, error)
+	// Bind 把字段值转换为写入数据库的值，指针字段传入指向的值，nil指针直接写入NULL，不会调用Bind
+	Bind(v interface{}) (interface{}, error)
+}
+
+var (
+	converters   = map[string]ColumnConverter{"ynbool": ynBoolConverter{}}
+	convertersMu sync.RWMutex
+)
+
+// RegisterConverter 注册字段值转换器，通过`db:"active,scan=name"`使用
+// 转换器应该在程序初始化阶段，声明entity metadata之前注册
+func RegisterConverter(name string, c ColumnConverter) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+
+	converters[name] = c
+}
+
+func getConverter(name string) (ColumnConverter, bool) {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+
+	c, ok := converters[name]
+	return c, ok
+}
+
+// 使用'Y'/'N'保存的布尔值，读取时不区分大小写
+type ynBoolConverter struct{}
+
+func (ynBoolConverter) Scan(src interface{}) (interface{}, error) {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return nil, fmt.Errorf("unsupported ynbool value type %T", src)
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "Y":
+		return true, nil
+	case "N":
+		return false, nil
+	}
+	return nil, fmt.Errorf("invalid ynbool value %q", s)
+}
+
+func (ynBoolConverter) Bind(v interface{}) (interface{}, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("unsupported ynbool field type %T", v)
+	} else if b {
+		return "Y", nil
+	}
+	return "N", nil
+}
+
+// 写入前转换字段值，nil指针写入NULL
+func bindConverted(col Column, val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		val = rv.Elem().Interface()
+	}
+
+	c, _ := getConverter(col.Converter)
+	v, err := c.Bind(val)
+	if err != nil {
+		return nil, fmt.Errorf("column %q, bind %q, %w", col.DBField, col.Converter, err)
+	}
+	return v, nil
+}
+
+// 读取时先由转换器处理数据库返回的原始值，再写入entity字段
+type converterScanner struct {
+	field reflect.Value
+	col   Column
+}
+
+var _ sql.Scanner = converterScanner{}
+
+func (s converterScanner) Scan(src interface{}) error {
+	c, _ := getConverter(s.col.Converter)
+	v, err := c.Scan(src)
+	if err != nil {
+		return fmt.Errorf("column %q, scan %q, %w", s.col.DBField, s.col.Converter, err)
+	}
+
+	f := s.field
+	if v == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		f = f.Elem()
+	}
+
+	rv := reflect.ValueOf(v)
+	if !rv.Type().ConvertibleTo(f.Type()) {
+		return fmt.Errorf("column %q, scan %q, cannot assign %T to %s", s.col.DBField, s.col.Converter, v, f.Type())
+	}
+	f.Set(rv.Convert(f.Type()))
+	return nil
+}
@@ -0,0 +1,95 @@
+package entity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestYNBoolConverter(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE legacy (id INTEGER PRIMARY KEY, active CHAR(1), verified CHAR(1))`)
+	ctx := context.Background()
+
+	verified := true
+	ent := &LegacyEntity{ID: 1, Active: true, Verified: &verified}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	var active, stored interface{}
+	require.NoError(t, db.QueryRow(`SELECT active, verified FROM legacy WHERE id = 1`).Scan(&active, &stored))
+	require.Equal(t, "Y", active)
+	require.Equal(t, "Y", stored)
+
+	loaded := &LegacyEntity{ID: 1}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.True(t, loaded.Active)
+	require.NotNil(t, loaded.Verified)
+	require.True(t, *loaded.Verified)
+
+	loaded.Active = false
+	loaded.Verified = nil
+	require.NoError(t, Update(ctx, loaded, db))
+	require.NoError(t, db.QueryRow(`SELECT active, verified FROM legacy WHERE id = 1`).Scan(&active, &stored))
+	require.Equal(t, "N", active)
+	require.Nil(t, stored)
+
+	loaded = &LegacyEntity{ID: 1}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.False(t, loaded.Active)
+	require.Nil(t, loaded.Verified)
+
+	// 小写也可以识别，无法识别的值返回错误
+	db.MustExec(`UPDATE legacy SET active = 'y' WHERE id = 1`)
+	require.NoError(t, Load(ctx, loaded, db))
+	require.True(t, loaded.Active)
+
+	db.MustExec(`UPDATE legacy SET active = 'X' WHERE id = 1`)
+	require.Error(t, Load(ctx, loaded, db))
+
+	_, err = NewMetadata(&BadConverterEntity{})
+	require.Error(t, err)
+}
+
+type LegacyEntity struct {
+	ID       int   `db:"id,primaryKey"`
+	Active   bool  `db:"active,scan=ynbool"`
+	Verified *bool `db:"verified,scan=ynbool"`
+}
+
+func (le LegacyEntity) TableName() string {
+	return "legacy"
+}
+
+func (le *LegacyEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadConverterEntity struct {
+	ID     int  `db:"id,primaryKey"`
+	Active bool `db:"active,scan=tfbool"`
+}
+
+func (bce BadConverterEntity) TableName() string {
+	return "bad_converter"
+}
+
+func (bce *BadConverterEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func TestYNBoolConverterSelect(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE legacy (id INTEGER PRIMARY KEY, active CHAR(1), verified CHAR(1))`,
+		`INSERT INTO legacy (id, active, verified) VALUES (1, 'Y', NULL), (2, 'N', 'Y')`,
+	)
+	ctx := context.Background()
+
+	list, err := Select[*LegacyEntity]().OrderBy("id").All(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.True(t, list[0].Active)
+	require.Nil(t, list[0].Verified)
+	require.False(t, list[1].Active)
+	require.True(t, *list[1].Verified)
+}
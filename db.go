@@ -3,26 +3,60 @@ package entity
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
 )
 
 var (
-	selectStatements = map[reflect.Type]string{}
-	insertStatements = map[reflect.Type]string{}
-	updateStatements = map[reflect.Type]string{}
-	deleteStatements = map[reflect.Type]string{}
+	selectStatements = newStatementCache()
+	insertStatements = newStatementCache()
+	updateStatements = newStatementCache()
+	deleteStatements = newStatementCache()
+	upsertStatements = newStatementCache()
+	// 使用?占位符的主键查询语句，给实现了PrimaryKeyArg的entity使用
+	argSelectStatements = newStatementCache()
+
+	statementCaches = []*statementCache{
+		selectStatements,
+		insertStatements,
+		updateStatements,
+		deleteStatements,
+		upsertStatements,
+		argSelectStatements,
+	}
 
 	driverMysql    = "mysql"
 	driverPostgres = "postgres"
 	driverSqlite3  = "sqlite3"
+	// go-mssqldb注册的驱动名
+	driverSqlserver = "sqlserver"
 
 	driverAlias = map[string]string{
-		"pgx": driverPostgres,
+		"pgx":                   driverPostgres,
+		"pgx/v5":                driverPostgres,
+		"postgresql":            driverPostgres,
+		"postgres-otel":         driverPostgres,
+		"postgres-instrumented": driverPostgres,
+		"nrpostgres":            driverPostgres,
+		"cloudsqlpostgres":      driverPostgres,
+		"mysql-otel":            driverMysql,
+		"mysql-instrumented":    driverMysql,
+		"nrmysql":               driverMysql,
+		"sqlite":                driverSqlite3,
+		"sqlite3-otel":          driverSqlite3,
+		"sqlite3-instrumented":  driverSqlite3,
+		"nrsqlite3":             driverSqlite3,
+		"mssql":                 driverSqlserver,
 	}
+
+	driverResolver func(string) string
 )
 
 // DB 数据库接口
@@ -44,132 +78,568 @@ type DB interface {
 	BindNamed(string, interface{}) (string, []interface{}, error)
 }
 
+// SupportsReturning 数据库是否支持RETURNING子句，driver可以是DriverName()返回的原始名字
+func SupportsReturning(driver string) bool {
+	return getDialect(resolveDriver(driver)).Returning
+}
+
+// 数据库不支持RETURNING时直接返回错误，不必等到数据库报语法错误
+func checkReturning(md *Metadata, driver string, returning bool) error {
+	if returning && !SupportsReturning(driver) {
+		return fmt.Errorf("entity %q, driver %q does not support RETURNING", md.Type, driver)
+	}
+	return nil
+}
+
+// SetDriverResolver 设置驱动名称转换方法
+// 被监控工具包装过的驱动，DriverName()返回的名字可能不是原始驱动名，可以用此方法转换为mysql/postgres/sqlite3/sqlserver
+func SetDriverResolver(fn func(string) string) {
+	driverResolver = fn
+}
+
 func dbDriver(db DB) string {
-	dv := db.DriverName()
+	return resolveDriver(db.DriverName())
+}
+
+func resolveDriver(dv string) string {
+	if driverResolver != nil {
+		dv = driverResolver(dv)
+	}
+
 	if v, ok := driverAlias[dv]; ok {
 		return v
 	}
 	return dv
 }
 
-func isConflictError(db DB, err error) bool {
+// IsUndefinedTableError 判断是否操作了不存在的表
+func IsUndefinedTableError(db DB, err error) bool {
+	if err == nil {
+		return false
+	} else if errors.Is(err, ErrUndefinedTable) {
+		return true
+	}
+	return isUndefinedTableError(dbDriver(db), err)
+}
+
+func isUndefinedTableError(driver string, err error) bool {
+	if d := getDialect(driver); d.IsUndefinedTable != nil {
+		return d.IsUndefinedTable(err)
+	}
+	return false
+}
+
+// IsLockNotAvailable 判断是否因为使用了NOWAIT，无法立即获得行锁而失败
+// sqlite没有行锁，始终返回false
+func IsLockNotAvailable(db DB, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if d := getDialect(dbDriver(db)); d.IsLockNotAvailable != nil {
+		return d.IsLockNotAvailable(err)
+	}
+	return false
+}
+
+// IsSerializationFailure 判断是否因为事务无法串行化而失败，通常重试整个事务即可
+// postgresql对应40001错误，mysql没有单独的串行化错误，对应SQLSTATE同为40001的死锁错误1213
+func IsSerializationFailure(db DB, err error) bool {
+	if err == nil {
+		return false
+	} else if errors.Is(err, ErrSerializationFailure) {
+		return true
+	}
+	return isSerializationFailure(dbDriver(db), err)
+}
+
+func isSerializationFailure(driver string, err error) bool {
+	if d := getDialect(driver); d.IsSerializationFailure != nil {
+		return d.IsSerializationFailure(err)
+	}
+	return false
+}
+
+// 把数据库返回的错误归类，可以用errors.Is(err, ErrConflict)、errors.Is(err, ErrUndefinedTable)等方式判断
+// errors.Unwrap()返回数据库驱动的原始错误
+func classifyError(db DB, err error) error {
+	if err == nil {
+		return nil
+	}
+
 	driver := dbDriver(db)
+	if isConflictError(db, err) {
+		return &classifiedError{err: err, kind: ErrConflict}
+	} else if isUndefinedTableError(driver, err) {
+		return &classifiedError{err: err, kind: ErrUndefinedTable}
+	} else if isSerializationFailure(driver, err) {
+		return &classifiedError{err: err, kind: ErrSerializationFailure}
+	}
+	return err
+}
+
+// 保留原始错误的同时，可以用errors.Is(err, kind)判断错误类型
+type classifiedError struct {
+	err  error
+	kind error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.kind
+}
 
-	s := err.Error()
-	if driver == driverPostgres {
-		return strings.Contains(s, "duplicate key value violates unique constraint")
-	} else if driver == driverMysql {
-		return strings.Contains(s, "Duplicate entry")
-	} else if driver == driverSqlite3 {
-		return strings.Contains(s, "UNIQUE constraint failed")
+func isConflictError(db DB, err error) bool {
+	if d := getDialect(dbDriver(db)); d.IsConflict != nil {
+		return d.IsConflict(err)
 	}
 	return false
 }
 
+// 按entity类型缓存的语句，可以并发读写
+type statementCache struct {
+	mu    sync.RWMutex
+	stmts map[reflect.Type]string
+}
+
+func newStatementCache() *statementCache {
+	return &statementCache{stmts: map[reflect.Type]string{}}
+}
+
+func (c *statementCache) get(t reflect.Type) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stmt, ok := c.stmts[t]
+	return stmt, ok
+}
+
+func (c *statementCache) set(t reflect.Type, stmt string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stmts[t] = stmt
+}
+
+func (c *statementCache) delete(t reflect.Type) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.stmts, t)
+}
+
+func (c *statementCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stmts = map[reflect.Type]string{}
+}
+
+// ClearStatementCache 清空所有entity缓存的语句，下次执行时重新生成
+func ClearStatementCache() {
+	for _, c := range statementCaches {
+		c.clear()
+	}
+}
+
+// ClearStatementCacheFor 清除一种entity缓存的语句
+func ClearStatementCacheFor(ent Entity) {
+	t := reflectx.Deref(reflect.TypeOf(ent))
+	for _, c := range statementCaches {
+		c.delete(t)
+	}
+}
+
+// WarmCache 提前生成entity的各类语句并缓存，首次请求不需要再生成语句
+// 缓存的语句不区分数据库，driver必须是实际使用的数据库驱动名
+func WarmCache(ent Entity, driver string) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	warmStatements(ent, md, resolveDriver(driver))
+	return nil
+}
+
+func warmStatements(ent Entity, md *Metadata, driver string) {
+	selectStatements.set(md.Type, selectStatement(ent, md, driver))
+	insertStatements.set(md.Type, insertStatement(ent, md, driver))
+	updateStatements.set(md.Type, updateStatement(ent, md, driver))
+	deleteStatements.set(md.Type, deleteStatement(ent, md, driver))
+	if driver != driverSqlserver {
+		upsertStatements.set(md.Type, upsertReturningStatement(ent, md, driver, false))
+	}
+	if _, ok := ent.(PrimaryKeyArg); ok {
+		argSelectStatements.set(md.Type, argSelectStatement(md, driver))
+	}
+}
+
+// 把当前行数据写入entity
+func scanEntity(rows *sqlx.Rows, ent Entity) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if v, ok := ent.(ScanDest); ok {
+		return rows.Scan(v.ScanDests(cols)...)
+	}
+
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	if err := checkColumns(md, cols, nil); err != nil {
+		return err
+	}
+
+	if !md.hasInet && !md.hasConverter {
+		if err := rows.StructScan(ent); err != nil {
+			return err
+		}
+		return decodeValues(ent, md, cols)
+	}
+
+	// 网络地址字段需要解析文本，转换器字段需要先转换原始值，不能直接使用StructScan
+	columns := make([]Column, 0, len(cols))
+	for _, name := range cols {
+		col, _ := md.Column(name)
+		columns = append(columns, col)
+	}
+
+	if err := rows.Scan(fieldAddrs(ent, columns)...); err != nil {
+		return err
+	}
+	return decodeValues(ent, md, cols)
+}
+
 func doLoad(ctx context.Context, ent Entity, db DB) error {
+	db = withLogger(db)
+	return handle(ctx, db, OpLoad, ent.TableName(), func(ctx context.Context) error {
+		return loadEntity(ctx, ent, db, "")
+	})
+}
+
+// lock为行锁子句，例如FOR UPDATE NOWAIT，为空时不加锁
+func loadEntity(ctx context.Context, ent Entity, db DB, lock string) error {
 	md, err := getMetadata(ent)
 	if err != nil {
 		return fmt.Errorf("get metadata, %w", err)
 	}
 
-	stmt, ok := selectStatements[md.Type]
-	if !ok {
+	allocEmbedded(ent, md)
+
+	mmd, masked, err := maskMetadata(ctx, md)
+	if err != nil {
+		return err
+	}
+
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return err
+	}
+
+	if pk, ok := ent.(PrimaryKeyArg); ok && !masked && len(scope) == 0 && lock == "" {
+		if _, ok := ent.(ScanDest); ok {
+			return loadByArgs(ctx, ent, md, db, pk.PrimaryKeyArgs())
+		}
+	}
+
+	var stmt string
+	if masked || len(scope) > 0 {
+		// 字段限制和默认条件会改变语句，不能缓存
+		stmt = selectStatement(ent, mmd, dbDriver(db), scope...)
+	} else if s, ok := selectStatements.get(md.Type); ok {
+		stmt = s
+	} else {
 		stmt = selectStatement(ent, md, dbDriver(db))
-		selectStatements[md.Type] = stmt
+		selectStatements.set(md.Type, stmt)
+	}
+	if lock != "" {
+		stmt += " " + lock
+	}
+
+	rows, err := namedQuery(ctx, db, stmt, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return sql.ErrNoRows
+	}
+
+	if _, ok := ent.(ScanDest); !ok {
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		} else if err := checkColumns(md, cols, columnNames(mmd.Columns)); err != nil {
+			return err
+		}
 	}
 
-	rows, err := sqlx.NamedQueryContext(ctx, db, stmt, ent)
+	if err := scanEntity(rows, ent); err != nil {
+		return fmt.Errorf("scan struct, %w", err)
+	}
+
+	return rows.Err()
+}
+
+// 检查查询结果的字段，结果内有entity没有的字段，或者缺少expected内的字段时返回ErrColumnMismatch
+// 通常是因为表结构修改以后entity没有同步修改
+func checkColumns(md *Metadata, cols []string, expected []string) error {
+	returned := make(map[string]bool, len(cols))
+	unexpected := []string{}
+	for _, name := range cols {
+		returned[name] = true
+		if _, ok := md.Column(name); !ok {
+			unexpected = append(unexpected, name)
+		}
+	}
+
+	missing := []string{}
+	for _, name := range expected {
+		if !returned[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(unexpected) > 0 && len(missing) > 0 {
+		return fmt.Errorf("entity %q, unexpected columns %v and missing columns %v in result, %w", md.Type, unexpected, missing, ErrColumnMismatch)
+	} else if len(unexpected) > 0 {
+		return fmt.Errorf("entity %q, unexpected columns %v in result, %w", md.Type, unexpected, ErrColumnMismatch)
+	} else if len(missing) > 0 {
+		return fmt.Errorf("entity %q, missing columns %v in result, %w", md.Type, missing, ErrColumnMismatch)
+	}
+	return nil
+}
+
+// 使用entity生成的主键参数读取，不需要反射
+func loadByArgs(ctx context.Context, ent Entity, md *Metadata, db DB, args []interface{}) error {
+	if len(args) != len(md.PrimaryKeys) {
+		return fmt.Errorf("entity %q, expect %d primary key values, got %d", md.Type, len(md.PrimaryKeys), len(args))
+	}
+
+	stmt, ok := argSelectStatements.get(md.Type)
+	if !ok {
+		stmt = argSelectStatement(md, dbDriver(db))
+		argSelectStatements.set(md.Type, stmt)
+	}
+
+	rows, err := db.QueryxContext(ctx, rebind(db, stmt), args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
 		return sql.ErrNoRows
 	}
 
-	if err := rows.StructScan(ent); err != nil {
+	if err := scanEntity(rows, ent); err != nil {
 		return fmt.Errorf("scan struct, %w", err)
 	}
 
 	return rows.Err()
 }
 
-func doInsert(ctx context.Context, ent Entity, db DB) (int64, error) {
+func doInsert(ctx context.Context, ent Entity, db DB) (lastID int64, err error) {
+	db = withLogger(db)
+	err = handle(ctx, db, OpInsert, ent.TableName(), func(ctx context.Context) error {
+		lastID, err = insertEntity(ctx, ent, db)
+		return err
+	})
+	return
+}
+
+func insertEntity(ctx context.Context, ent Entity, db DB) (int64, error) {
 	md, err := getMetadata(ent)
 	if err != nil {
 		return 0, fmt.Errorf("get metadata, %w", err)
 	}
 
-	stmt, ok := insertStatements[md.Type]
-	if !ok {
+	allocEmbedded(ent, md)
+
+	touchTimestamps(ent, md, true)
+	if err := checkValues(ent, md); err != nil {
+		return 0, err
+	}
+	if err := checkFKEnums(ctx, ent, md, db); err != nil {
+		return 0, err
+	}
+
+	if strictMode {
+		if err := validateReturning(md, dbDriver(db)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := checkReturning(md, dbDriver(db), md.hasReturningInsert); err != nil {
+		return 0, err
+	}
+
+	var arg interface{} = ent
+	var stmt string
+	if md.hasNullPolicy {
+		// 插入字段取决于字段值，不能缓存
+		var omd *Metadata
+		omd, arg = nullPolicyValues(ent, md)
+		stmt = insertStatement(ent, omd, dbDriver(db))
+	} else if s, ok := insertStatements.get(md.Type); ok {
+		stmt = s
+	} else {
 		stmt = insertStatement(ent, md, dbDriver(db))
-		insertStatements[md.Type] = stmt
+		insertStatements.set(md.Type, stmt)
 	}
 
-	if md.hasReturningInsert {
-		rows, err := sqlx.NamedQueryContext(ctx, db, stmt, ent)
+	if arg, err = encodeArg(ent, md, arg); err != nil {
+		return 0, err
+	}
+
+	if insertReturning(md, dbDriver(db)) {
+		rows, err := namedQuery(ctx, db, stmt, arg)
 		if err != nil {
 			return 0, err
 		}
 		defer rows.Close()
 
 		if !rows.Next() {
+			// sqlite在读取RETURNING结果时才会返回冲突等错误
+			if err := rows.Err(); err != nil {
+				return 0, err
+			}
 			return 0, sql.ErrNoRows
 		}
 
-		if err := rows.StructScan(ent); err != nil {
+		if err := scanEntity(rows, ent); err != nil {
 			return 0, fmt.Errorf("scan struct, %w", err)
 		}
 
-		return 0, rows.Err()
+		return autoIncrementID(ent, md), rows.Err()
 	}
 
-	result, err := db.NamedExecContext(ctx, stmt, ent)
+	result, err := namedExec(ctx, db, stmt, arg)
 	if err != nil {
 		return 0, err
 	}
 
-	// postgresql不支持LastInsertId特性
-	if dbDriver(db) == driverPostgres {
+	// postgresql及sqlserver不支持LastInsertId特性
+	if returningAutoIncrement(dbDriver(db)) {
 		return 0, nil
 	}
 
 	lastID, err := result.LastInsertId()
-	return lastID, fmt.Errorf("get last insert id, %w", err)
+	if err != nil {
+		return 0, fmt.Errorf("get last insert id, %w", err)
+	}
+
+	// 写回entity，EventAfterInsert事件内可以拿到自增ID
+	if lastID > 0 {
+		setAutoIncrement(ent, md, lastID)
+	}
+	return lastID, nil
+}
+
+// 插入语句是否使用RETURNING取回字段值
+func insertReturning(md *Metadata, driver string) bool {
+	return md.hasReturningInsert || (md.hasAutoIncrement && returningAutoIncrement(driver))
 }
 
 func doUpdate(ctx context.Context, ent Entity, db DB) error {
+	db = withLogger(db)
+	return handle(ctx, db, OpUpdate, ent.TableName(), func(ctx context.Context) error {
+		return updateEntity(ctx, ent, db)
+	})
+}
+
+func updateEntity(ctx context.Context, ent Entity, db DB) error {
 	md, err := getMetadata(ent)
 	if err != nil {
 		return fmt.Errorf("get metadata, %w", err)
 	}
 
-	stmt, ok := updateStatements[md.Type]
-	if !ok {
+	allocEmbedded(ent, md)
+
+	md, masked, err := maskMetadata(ctx, md)
+	if err != nil {
+		return err
+	}
+
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return err
+	}
+
+	touchTimestamps(ent, md, false)
+	if err := checkValues(ent, md); err != nil {
+		return err
+	}
+	if err := checkFKEnums(ctx, ent, md, db); err != nil {
+		return err
+	}
+
+	if strictMode {
+		if err := validateReturning(md, dbDriver(db)); err != nil {
+			return err
+		}
+	}
+
+	if err := checkReturning(md, dbDriver(db), md.hasReturningUpdate); err != nil {
+		return err
+	}
+
+	var stmt string
+	if masked && !hasUpdateColumn(md) {
+		return fmt.Errorf("entity %q, all update columns are masked", md.Type)
+	} else if masked || len(scope) > 0 {
+		// 字段限制和默认条件会改变语句，不能缓存
+		stmt = updateStatement(ent, md, dbDriver(db), scope...)
+	} else if s, ok := updateStatements.get(md.Type); ok {
+		stmt = s
+	} else {
 		stmt = updateStatement(ent, md, dbDriver(db))
-		updateStatements[md.Type] = stmt
+		updateStatements.set(md.Type, stmt)
+	}
+
+	if arg, err = encodeArg(ent, md, arg); err != nil {
+		return err
 	}
 
 	if md.hasReturningUpdate {
-		rows, err := sqlx.NamedQueryContext(ctx, db, stmt, ent)
+		rows, err := namedQuery(ctx, db, stmt, arg)
 		if err != nil {
 			return err
 		}
 		defer rows.Close()
 
 		if !rows.Next() {
-			return sql.ErrNoRows
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return updateMissed(ctx, ent, md, db, arg, scope...)
 		}
 
-		if err := rows.StructScan(ent); err != nil {
+		if err := scanEntity(rows, ent); err != nil {
 			return fmt.Errorf("scan struct, %w", err)
 		}
 
+		incrVersion(ent, md)
 		return rows.Err()
 	}
 
-	result, err := db.NamedExecContext(ctx, stmt, ent)
+	result, err := namedExec(ctx, db, stmt, arg)
 	if err != nil {
 		return err
 	}
@@ -177,144 +647,638 @@ func doUpdate(ctx context.Context, ent Entity, db DB) error {
 	if n, err := result.RowsAffected(); err != nil {
 		return fmt.Errorf("get affected rows, %w", err)
 	} else if n == 0 {
-		return sql.ErrNoRows
+		return updateMissed(ctx, ent, md, db, arg, scope...)
 	}
 
+	incrVersion(ent, md)
 	return nil
+}
 
+// 更新没有影响任何记录时返回的错误
+// 有版本号字段并且记录仍然存在时，说明版本号不一致，返回ErrVersionMismatch，否则返回sql.ErrNoRows
+// 判断记录是否存在时同样使用默认条件scope，并且排除已经软删除的记录
+func updateMissed(ctx context.Context, ent Entity, md *Metadata, db DB, arg interface{}, scope ...string) error {
+	if !md.hasVersion {
+		return sql.ErrNoRows
+	}
+
+	driver := dbDriver(db)
+	stmt := newSelect(md, driver).
+		expr("1").
+		where(primaryKeyWhere(md, driver)).
+		where(notDeleted(md, driver)...).
+		where(scope...).
+		String()
+	rows, err := namedQuery(ctx, db, stmt, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return ErrVersionMismatch
+	} else if err := rows.Err(); err != nil {
+		return err
+	}
+	return sql.ErrNoRows
+}
+
+// 解析"expr AS name"形式的extra，返回去掉引号之后的name
+func extraAlias(extra string) (string, bool) {
+	i := strings.LastIndex(strings.ToLower(extra), " as ")
+	if i < 0 {
+		return "", false
+	}
+
+	expr, name := strings.TrimSpace(extra[:i]), strings.TrimSpace(extra[i+4:])
+	name = strings.Trim(name, "\"`[]")
+	if expr == "" || name == "" || strings.ContainsAny(name, " \t\n()\"`[],") {
+		return "", false
+	}
+	return name, true
+}
+
+func doUpdateReturningExtra(ctx context.Context, ent Entity, db DB, extraDest interface{}, extras []string) error {
+	db = withLogger(db)
+	return handle(ctx, db, OpUpdate, ent.TableName(), func(ctx context.Context) error {
+		return updateEntityReturningExtra(ctx, ent, db, extraDest, extras)
+	})
+}
+
+func updateEntityReturningExtra(ctx context.Context, ent Entity, db DB, extraDest interface{}, extras []string) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	allocEmbedded(ent, md)
+
+	md, masked, err := maskMetadata(ctx, md)
+	if err != nil {
+		return err
+	} else if masked && !hasUpdateColumn(md) {
+		return fmt.Errorf("entity %q, all update columns are masked", md.Type)
+	}
+
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return err
+	}
+
+	touchTimestamps(ent, md, false)
+	if err := checkValues(ent, md); err != nil {
+		return err
+	}
+	if err := checkFKEnums(ctx, ent, md, db); err != nil {
+		return err
+	}
+
+	if err := checkReturning(md, dbDriver(db), true); err != nil {
+		return err
+	} else if driver := dbDriver(db); driver == driverSqlserver {
+		// extras追加在语句末尾，sqlserver的OUTPUT子句在WHERE之前
+		return fmt.Errorf("driver %q update returning extra, %w", driver, ErrUnsupported)
+	}
+
+	dv := reflect.ValueOf(extraDest)
+	if dv.Kind() != reflect.Ptr || reflect.Indirect(dv).Kind() != reflect.Struct {
+		return fmt.Errorf("extra dest must be a pointer to struct, got %T", extraDest)
+	}
+
+	// 执行之前检查extras，避免更新之后才发现无法写回
+	extraFields := mapper.TypeMap(reflect.Indirect(dv).Type())
+	for _, extra := range extras {
+		name, ok := extraAlias(extra)
+		if !ok {
+			return fmt.Errorf("invalid returning extra %q, must be \"expr AS name\"", extra)
+		} else if _, ok := extraFields.Names[name]; !ok {
+			return fmt.Errorf("missing destination for returning column %q", name)
+		}
+	}
+
+	// extras追加在语句末尾，语句不缓存
+	stmt := updateStatement(ent, md, dbDriver(db), scope...)
+	if md.hasReturningUpdate {
+		stmt += ", " + strings.Join(extras, ", ")
+	} else {
+		stmt += " RETURNING " + strings.Join(extras, ", ")
+	}
+
+	if arg, err = encodeArg(ent, md, arg); err != nil {
+		return err
+	}
+
+	rows, err := namedQuery(ctx, db, stmt, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return updateMissed(ctx, ent, md, db, arg, scope...)
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	ev := reflect.Indirect(reflect.ValueOf(ent))
+	dv = reflect.Indirect(dv)
+
+	dests := make([]interface{}, 0, len(cols))
+	for _, name := range cols {
+		if col, ok := md.Column(name); ok && col.ReturningUpdate {
+			dests = append(dests, mapper.FieldByName(ev, name).Addr().Interface())
+		} else if _, ok := extraFields.Names[name]; ok {
+			dests = append(dests, mapper.FieldByName(dv, name).Addr().Interface())
+		} else {
+			return fmt.Errorf("missing destination for returning column %q", name)
+		}
+	}
+
+	if err := rows.Scan(dests...); err != nil {
+		return fmt.Errorf("scan struct, %w", err)
+	}
+
+	incrVersion(ent, md)
+	return rows.Err()
 }
 
 func doDelete(ctx context.Context, ent Entity, db DB) error {
+	// 级联软删除需要在同一个事务内执行，db不是*sqlx.DB时认为已经是事务
+	if v, ok := db.(*sqlx.DB); ok {
+		if md, err := getMetadata(ent); err == nil && len(md.cascades) > 0 {
+			return RunInTx(ctx, v, func(tx DB) error {
+				return doDelete(ctx, ent, tx)
+			})
+		}
+	}
+
+	db = withLogger(db)
+	return handle(ctx, db, OpDelete, ent.TableName(), func(ctx context.Context) error {
+		return deleteEntity(ctx, ent, db, false)
+	})
+}
+
+// force为true时，有softdelete字段的entity也会被物理删除
+func deleteEntity(ctx context.Context, ent Entity, db DB, force bool) error {
 	md, err := getMetadata(ent)
 	if err != nil {
 		return fmt.Errorf("get metadata, %w", err)
 	}
 
-	stmt, ok := deleteStatements[md.Type]
-	if !ok {
+	allocEmbedded(ent, md)
+
+	soft := md.softDelete != nil && !force
+	if soft {
+		setDeletedAt(ent, md, nowFunc())
+	}
+
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return err
+	}
+
+	var stmt string
+	if md.softDelete != nil && force {
+		stmt = forceDeleteStatement(ent, md, dbDriver(db), scope...)
+	} else if len(scope) > 0 {
+		// 默认条件会改变语句，不能缓存
+		stmt = deleteStatement(ent, md, dbDriver(db), scope...)
+	} else if s, ok := deleteStatements.get(md.Type); ok {
+		stmt = s
+	} else {
 		stmt = deleteStatement(ent, md, dbDriver(db))
-		deleteStatements[md.Type] = stmt
+		deleteStatements.set(md.Type, stmt)
 	}
 
-	_, err = db.NamedExecContext(ctx, stmt, ent)
-	return err
+	result, err := namedExec(ctx, db, stmt, arg)
+	if err != nil || !soft || len(md.cascades) == 0 {
+		return err
+	}
+
+	// 记录不存在或者不符合默认条件时，不删除子表记录
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("get affected rows, %w", err)
+	} else if n == 0 {
+		return nil
+	}
+	return cascadeSoftDelete(ctx, ent, md, db)
 }
 
-func selectStatement(ent Entity, md *Metadata, driver string) string {
-	columns := []string{}
-	for _, col := range md.Columns {
-		columns = append(columns, quoteColumn(col.DBField, driver))
+// 软删除子表内关联的记录，只处理一层，子表的软删除字段与父表同名
+func cascadeSoftDelete(ctx context.Context, ent Entity, md *Metadata, db DB) error {
+	v := reflect.ValueOf(ent)
+	deletedAt, _ := readField(v, md.softDelete.DBField)
+
+	driver := dbDriver(db)
+	for _, col := range md.cascades {
+		key, _ := readField(v, col.DBField)
+
+		stmt := newSQLBuilder("UPDATE", quoteIdentifier(col.CascadeDelete, driver), driver).
+			set(md.softDelete.DBField, "?").
+			where(quoteColumn(col.CascadeFK, driver) + " = ?").
+			where(quoteColumn(md.softDelete.DBField, driver) + " IS NULL").
+			String()
+		if _, err := db.ExecContext(ctx, rebind(db, stmt), deletedAt.Interface(), key.Interface()); err != nil {
+			return fmt.Errorf("cascade delete %s, %w", col.CascadeDelete, err)
+		}
 	}
-	stmt := fmt.Sprintf("SELECT %s FROM %s WHERE", strings.Join(columns, ", "), quoteIdentifier(md.TableName, driver))
+	return nil
+}
 
-	for i, col := range md.PrimaryKeys {
-		if i == 0 {
-			stmt += fmt.Sprintf(" %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
-		} else {
-			stmt += fmt.Sprintf(" AND %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
+// conds为主键之外额外的查询条件，例如DefaultScoper返回的条件
+func selectStatement(ent Entity, md *Metadata, driver string, conds ...string) string {
+	return newSelect(md, driver).
+		column(columnNames(md.Columns)...).
+		where(primaryKeyWhere(md, driver)).
+		where(notDeleted(md, driver)...).
+		where(conds...).
+		limit(1).
+		String()
+}
+
+// 与selectStatement相同，主键条件使用?占位符按顺序绑定参数
+func argSelectStatement(md *Metadata, driver string) string {
+	conds := make([]string, 0, len(md.PrimaryKeys))
+	for _, col := range md.PrimaryKeys {
+		op := "="
+		if col.NullableKey {
+			op = nullSafeEqual(driver)
 		}
+		conds = append(conds, fmt.Sprintf("%s %s %s", quoteColumn(col.DBField, driver), op, bindParam(col, driver, "?")))
 	}
-	stmt += " LIMIT 1"
 
-	return stmt
+	return newSelect(md, driver).
+		column(columnNames(md.Columns)...).
+		where(conds...).
+		where(notDeleted(md, driver)...).
+		limit(1).
+		String()
 }
 
 func insertStatement(ent Entity, md *Metadata, driver string) string {
-	columns := []string{}
-	returnings := []string{}
-	placeholder := []string{}
+	return insertBuilder(md, driver).String()
+}
+
+// 根据INSERT语句的字段构造语句，包括RETURNING字段
+func insertBuilder(md *Metadata, driver string) *sqlBuilder {
+	columns, placeholder, _ := insertColumns(md, driver)
+
+	b := newInsert(md, driver)
+	for i, name := range columns {
+		b.value(name, placeholder[i])
+	}
+	return b.returning(insertReturnings(md, driver)...)
+}
+
+// INSERT语句RETURNING的字段
+// postgresql不支持LastInsertId，自增字段也需要通过RETURNING取回
+func insertReturnings(md *Metadata, driver string) []string {
+	names := []string{}
+	for _, col := range md.Columns {
+		if col.ReturningInsert || (col.AutoIncrement && returningAutoIncrement(driver)) {
+			names = append(names, col.DBField)
+		}
+	}
+	return names
+}
+
+// 自增字段是否需要通过RETURNING取回，sqlserver的RETURNING对应OUTPUT INSERTED子句
+func returningAutoIncrement(driver string) bool {
+	return driver == driverPostgres || driver == driverSqlserver
+}
 
+// INSERT语句的字段、参数占位符以及RETURNING字段，字段名不包含引号
+func insertColumns(md *Metadata, driver string) (columns, placeholder, returnings []string) {
 	for _, col := range md.Columns {
-		c := quoteColumn(col.DBField, driver)
 		if col.ReturningInsert {
-			returnings = append(returnings, c)
-		} else if !col.AutoIncrement {
-			columns = append(columns, c)
-			placeholder = append(placeholder, fmt.Sprintf(":%s", col.DBField))
+			returnings = append(returnings, col.DBField)
+		} else if !col.AutoIncrement && col.Generated == "" {
+			for _, name := range append([]string{col.DBField}, col.Mirrors...) {
+				columns = append(columns, name)
+				placeholder = append(placeholder, bindParam(col, driver, ":"+col.DBField))
+			}
 		}
 	}
 
-	stmt := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s)",
-		quoteIdentifier(md.TableName, driver),
-		strings.Join(columns, ", "),
-		strings.Join(placeholder, ", "),
-	)
+	return
+}
+
+// 字段对应的参数占位符，postgresql的enum类型需要显式转换，否则会报类型不匹配
+// 不能使用 :name::type 的写法，sqlx会把::当作转义的冒号
+func bindParam(col Column, driver string, param string) string {
+	if driver != driverPostgres {
+		return param
+	} else if col.PGEnum != "" {
+		return fmt.Sprintf("CAST(%s AS %s)", param, quoteIdentifier(col.PGEnum, driver))
+	} else if col.Inet != "" {
+		return fmt.Sprintf("CAST(%s AS %s)", param, col.Inet)
+	}
+	return param
+}
+
+// 根据字段值构造INSERT语句，参数使用命名参数
+func insertMapStatement(table string, cols map[string]interface{}, driver string) string {
+	names := make([]string, 0, len(cols))
+	for name := range cols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := newSQLBuilder("INSERT", quoteIdentifier(table, driver), driver)
+	for _, name := range names {
+		b.value(name, fmt.Sprintf(":%s", name))
+	}
+	return b.String()
+}
+
+// 表内不存在符合条件的记录时才插入，where条件使用?作为参数占位符
+// 返回的语句中entity字段使用命名参数，需要先用sqlx.Named()处理
+func insertUnlessStatement(ent Entity, md *Metadata, driver string, where string) (head, tail string) {
+	columns, placeholder, returnings := insertColumns(md, driver)
+	table := quoteTable(md, driver)
+
+	head = fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(quoteNames(columns, driver), ", "))
+	if len(returnings) > 0 && driver == driverSqlserver {
+		head += " " + outputClause("INSERTED", quoteNames(returnings, driver))
+	}
+	head += " SELECT " + strings.Join(placeholder, ", ")
 
-	if len(returnings) > 0 {
-		stmt += fmt.Sprintf(" RETURNING %s", strings.Join(returnings, ", "))
+	tail = fmt.Sprintf(" WHERE NOT EXISTS (%s)", newSelect(md, driver).expr("1").where(where))
+	if len(returnings) > 0 && driver != driverSqlserver {
+		tail += fmt.Sprintf(" RETURNING %s", strings.Join(quoteNames(returnings, driver), ", "))
 	}
 
-	return stmt
+	return
 }
 
-func updateStatement(ent Entity, md *Metadata, driver string) string {
-	returnings := []string{}
-	stmt := fmt.Sprintf("UPDATE %s SET", quoteIdentifier(md.TableName, driver))
+func doInsertUnless(ctx context.Context, ent Entity, db DB, where string, args []interface{}) (inserted bool, err error) {
+	db = withLogger(db)
+	err = handle(ctx, db, OpInsert, ent.TableName(), func(ctx context.Context) error {
+		inserted, err = insertEntityUnless(ctx, ent, db, where, args)
+		return err
+	})
+	return
+}
+
+func insertEntityUnless(ctx context.Context, ent Entity, db DB, where string, args []interface{}) (bool, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return false, fmt.Errorf("get metadata, %w", err)
+	}
+
+	allocEmbedded(ent, md)
 
-	set := false
+	touchTimestamps(ent, md, true)
+	if err := checkValues(ent, md); err != nil {
+		return false, err
+	}
+	if err := checkFKEnums(ctx, ent, md, db); err != nil {
+		return false, err
+	}
+
+	if err := checkReturning(md, dbDriver(db), md.hasReturningInsert); err != nil {
+		return false, err
+	}
+
+	arg, err := encodeArg(ent, md, ent)
+	if err != nil {
+		return false, err
+	}
+
+	head, tail := insertUnlessStatement(ent, md, dbDriver(db), where)
+	stmt, namedArgs, err := sqlx.Named(head, arg)
+	if err != nil {
+		return false, fmt.Errorf("bind named, %w", err)
+	}
+	stmt = rebind(db, stmt+tail)
+	args = append(namedArgs, args...)
+
+	if md.hasReturningInsert {
+		rows, err := db.QueryxContext(ctx, stmt, args...)
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			return false, rows.Err()
+		}
+
+		if err := scanEntity(rows, ent); err != nil {
+			return false, fmt.Errorf("scan struct, %w", err)
+		}
+		return true, rows.Err()
+	}
+
+	result, err := db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get affected rows, %w", err)
+	}
+	return n > 0, nil
+}
+
+func updateStatement(ent Entity, md *Metadata, driver string, conds ...string) string {
+	b := newUpdate(md, driver).where(primaryKeyWhere(md, driver))
 	for _, col := range md.Columns {
 		if col.ReturningUpdate {
-			returnings = append(returnings, quoteColumn(col.DBField, driver))
+			b.returning(col.DBField)
+		} else if col.Version {
+			c := quoteColumn(col.DBField, driver)
+			b.set(col.DBField, c+" + 1").where(fmt.Sprintf("%s = :%s", c, col.DBField))
 		} else if !col.RefuseUpdate {
-			if set {
-				stmt += fmt.Sprintf(", %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
-			} else {
-				stmt += fmt.Sprintf(" %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
-				set = true
+			for _, name := range append([]string{col.DBField}, col.Mirrors...) {
+				b.set(name, bindParam(col, driver, ":"+col.DBField))
 			}
 		}
 	}
 
-	for i, col := range md.PrimaryKeys {
-		if i == 0 {
-			stmt += fmt.Sprintf(" WHERE %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
-		} else {
-			stmt += fmt.Sprintf(" AND %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
-		}
+	return b.where(conds...).String()
+}
+
+// 有softdelete字段时，使用UPDATE写入删除时间，已经被删除的记录不会重复写入
+func deleteStatement(ent Entity, md *Metadata, driver string, conds ...string) string {
+	if md.softDelete == nil {
+		return forceDeleteStatement(ent, md, driver, conds...)
 	}
 
-	if len(returnings) > 0 {
-		stmt += fmt.Sprintf(" RETURNING %s", strings.Join(returnings, ", "))
+	name := md.softDelete.DBField
+	return newUpdate(md, driver).
+		set(name, ":"+name).
+		where(primaryKeyWhere(md, driver)).
+		where(notDeleted(md, driver)...).
+		where(conds...).
+		String()
+}
+
+func forceDeleteStatement(ent Entity, md *Metadata, driver string, conds ...string) string {
+	return newDelete(md, driver).where(primaryKeyWhere(md, driver)).where(conds...).String()
+}
+
+// 逗号分隔的所有字段
+func columnList(md *Metadata, driver string) string {
+	return strings.Join(quoteNames(columnNames(md.Columns), driver), ", ")
+}
+
+func columnNames(cols []Column) []string {
+	names := make([]string, 0, len(cols))
+	for _, col := range cols {
+		names = append(names, col.DBField)
 	}
+	return names
+}
 
-	return stmt
+func quoteNames(names []string, driver string) []string {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, quoteColumn(name, driver))
+	}
+	return result
 }
 
-func deleteStatement(ent Entity, md *Metadata, driver string) string {
-	stmt := fmt.Sprintf("DELETE FROM %s WHERE", quoteIdentifier(md.TableName, driver))
-	for i, col := range md.PrimaryKeys {
-		if i == 0 {
-			stmt += fmt.Sprintf(" %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
-		} else {
-			stmt += fmt.Sprintf(" AND %s = :%s", quoteColumn(col.DBField, driver), col.DBField)
+// 根据主键查询的WHERE条件，不包含WHERE关键字
+func primaryKeyWhere(md *Metadata, driver string) string {
+	conds := []string{}
+	for _, col := range md.PrimaryKeys {
+		op := "="
+		if col.NullableKey {
+			op = nullSafeEqual(driver)
 		}
+		conds = append(conds, fmt.Sprintf("%s %s %s", quoteColumn(col.DBField, driver), op, bindParam(col, driver, ":"+col.DBField)))
 	}
+	return strings.Join(conds, " AND ")
+}
 
-	return stmt
+// NULL安全的相等比较运算符，NULL与NULL比较结果为真
+func nullSafeEqual(driver string) string {
+	switch driver {
+	case driverMysql:
+		return "<=>"
+	case driverSqlite3:
+		return "IS"
+	default:
+		return "IS NOT DISTINCT FROM"
+	}
+}
+
+// PrepareInsert 返回使用位置参数的INSERT语句，以及按照占位符顺序提取entity字段值的方法
+// 用于驱动自带的批量接口，例如pgx.Batch，binder只能用于与ent相同类型的entity
+func PrepareInsert(ent Entity, driver string) (stmt string, binder func(Entity) []interface{}, err error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return "", nil, fmt.Errorf("get metadata, %w", err)
+	}
+
+	driver = resolveDriver(driver)
+	if err := checkReturning(md, driver, md.hasReturningInsert); err != nil {
+		return "", nil, err
+	}
+
+	b := newInsert(md, driver)
+	names := []string{}
+	for _, col := range md.Columns {
+		if col.ReturningInsert || col.AutoIncrement || col.Generated != "" {
+			continue
+		}
+
+		for _, name := range append([]string{col.DBField}, col.Mirrors...) {
+			b.value(name, bindParam(col, driver, "?"))
+			names = append(names, col.DBField)
+		}
+	}
+	stmt = b.returning(insertReturnings(md, driver)...).String()
+
+	binder = func(ent Entity) []interface{} {
+		v := reflect.Indirect(reflect.ValueOf(ent))
+
+		args := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			val := mapper.FieldByName(v, name).Interface()
+			if col, _ := md.Column(name); col.Inet != "" {
+				val = inetValue(val)
+			}
+			args = append(args, val)
+		}
+		return args
+	}
+
+	return sqlx.Rebind(getDialect(driver).BindType, stmt), binder, nil
+}
+
+// ColumnListSQL 返回entity所有字段，已经按照数据库类型加上引号，以逗号分隔
+// 用于自行编写的SQL，例如 "SELECT " + ColumnListSQL(u, "postgres") + " FROM ... JOIN ..."
+func ColumnListSQL(ent Entity, driver string) string {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return ""
+	}
+	return columnList(md, driver)
+}
+
+// PrimaryKeyWhereSQL 返回根据主键查询的条件，不包含WHERE关键字，参数使用命名参数形式，例如 "id" = :id
+func PrimaryKeyWhereSQL(ent Entity, driver string) string {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return ""
+	}
+	return primaryKeyWhere(md, driver)
 }
 
 func quoteColumn(name string, driver string) string {
-	if driver == driverMysql {
-		return fmt.Sprintf("`%s`", name)
+	return getDialect(driver).quote(name)
+}
+
+// 表名加上引号，声明为RawTableName的表名原样返回
+func quoteTable(md *Metadata, driver string) string {
+	if md.rawTable {
+		return md.TableName
 	}
-	return fmt.Sprintf("%q", name)
+	return quoteIdentifier(md.TableName, driver)
 }
 
 func quoteIdentifier(name string, driver string) string {
-	symbol := `"`
-	if driver == driverMysql {
-		symbol = "`"
-	}
+	d := getDialect(driver)
 
 	result := []string{}
-	name = strings.ReplaceAll(name, symbol, "")
+	name = strings.Map(func(r rune) rune {
+		if r == d.Quote || r == d.CloseQuote {
+			return -1
+		}
+		return r
+	}, name)
 	for _, s := range strings.Split(name, ".") {
 		if s != "*" {
-			s = fmt.Sprintf("%s%s%s", symbol, s, symbol)
+			s = d.quote(s)
 		}
 		result = append(result, s)
 	}
 
 	return strings.Join(result, ".")
 }
+
+// Statements 返回entity的Load、Insert、Update、Delete语句，key为OpLoad、OpInsert、OpUpdate、OpDelete
+// 参数使用命名参数形式，可以用于检查entity生成的SQL
+func Statements(ent Entity, driver string) (map[string]string, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return nil, fmt.Errorf("get metadata, %w", err)
+	}
+
+	driver = resolveDriver(driver)
+	return map[string]string{
+		OpLoad:   selectStatement(ent, md, driver),
+		OpInsert: insertStatement(ent, md, driver),
+		OpUpdate: updateStatement(ent, md, driver),
+		OpDelete: deleteStatement(ent, md, driver),
+	}, nil
+}
@@ -1,8 +1,16 @@
 package entity
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/jmoiron/sqlx"
 )
 
 func TestStatement(t *testing.T) {
@@ -32,12 +40,44 @@ func TestStatement(t *testing.T) {
 		}
 
 		stmt = insertStatement(&GenernalEntity{}, md, driverPostgres)
-		expected = `INSERT INTO "genernal" ("extra", "id2", "name") VALUES (:extra, :id2, :name) RETURNING "create_at", "version"`
+		expected = `INSERT INTO "genernal" ("extra", "id2", "name") VALUES (:extra, :id2, :name) RETURNING "create_at", "id", "version"`
+		if stmt != expected {
+			t.Fatalf("GenernalEntity, Expected=%s, Actual=%s", expected, stmt)
+		}
+
+		md, _ = newTestMetadata(&AutoIncrementEntity{})
+
+		stmt = insertStatement(&AutoIncrementEntity{}, md, driverPostgres)
+		expected = `INSERT INTO "users" ("name") VALUES (:name) RETURNING "user_id"`
 		if stmt != expected {
+			t.Fatalf("AutoIncrementEntity, Expected=%s, Actual=%s", expected, stmt)
+		}
+
+		stmt = insertStatement(&AutoIncrementEntity{}, md, driverMysql)
+		expected = "INSERT INTO `users` (`name`) VALUES (:name)"
+		if stmt != expected {
+			t.Fatalf("AutoIncrementEntity, Expected=%s, Actual=%s", expected, stmt)
+		}
+	})
+
+	t.Run("insert unless", func(t *testing.T) {
+		md, _ := newTestMetadata(&GenernalEntity{})
+
+		head, tail := insertUnlessStatement(&GenernalEntity{}, md, driverPostgres, "name = ?")
+		expected := `INSERT INTO "genernal" ("extra", "id2", "name") SELECT :extra, :id2, :name WHERE NOT EXISTS (SELECT 1 FROM "genernal" WHERE name = ?) RETURNING "create_at", "version"`
+		if stmt := head + tail; stmt != expected {
 			t.Fatalf("GenernalEntity, Expected=%s, Actual=%s", expected, stmt)
 		}
 	})
 
+	t.Run("insert map", func(t *testing.T) {
+		stmt := insertMapStatement("public.log", map[string]interface{}{"user_id": 1, "action": "create"}, driverPostgres)
+		expected := `INSERT INTO "public"."log" ("action", "user_id") VALUES (:action, :user_id)`
+		if stmt != expected {
+			t.Fatalf("insert map, Expected=%s, Actual=%s", expected, stmt)
+		}
+	})
+
 	t.Run("update", func(t *testing.T) {
 		md, _ := newTestMetadata(&GenernalEntity{})
 
@@ -71,6 +111,106 @@ func TestStatement(t *testing.T) {
 	})
 }
 
+func TestMirrorStatement(t *testing.T) {
+	md, err := newTestMetadata(&MirrorEntity{})
+	if err != nil {
+		t.Fatalf("MirrorEntity metadata, %v", err)
+	}
+
+	stmt := insertStatement(&MirrorEntity{}, md, driverPostgres)
+	expected := `INSERT INTO "mirror" ("email", "email_copy") VALUES (:email, :email) RETURNING "id"`
+	if stmt != expected {
+		t.Fatalf("MirrorEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+
+	stmt = updateStatement(&MirrorEntity{}, md, driverPostgres)
+	expected = `UPDATE "mirror" SET "email" = :email, "email_copy" = :email WHERE "id" = :id`
+	if stmt != expected {
+		t.Fatalf("MirrorEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+
+	stmt = selectStatement(&MirrorEntity{}, md, driverPostgres)
+	expected = `SELECT "email", "id" FROM "mirror" WHERE "id" = :id LIMIT 1`
+	if stmt != expected {
+		t.Fatalf("MirrorEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+}
+
+func TestSQLFragment(t *testing.T) {
+	md, err := getMetadata(&GenernalEntity{})
+	if err != nil {
+		t.Fatalf("GenernalEntity metadata, %v", err)
+	}
+
+	for _, driver := range []string{driverMysql, driverPostgres, driverSqlite3} {
+		columns := ColumnListSQL(&GenernalEntity{}, driver)
+		where := PrimaryKeyWhereSQL(&GenernalEntity{}, driver)
+
+		expected := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT 1", columns, quoteIdentifier("genernal", driver), where)
+		if stmt := selectStatement(&GenernalEntity{}, md, driver); stmt != expected {
+			t.Fatalf("%q select, Expected=%s, Actual=%s", driver, expected, stmt)
+		}
+
+		expected = fmt.Sprintf("DELETE FROM %s WHERE %s", quoteIdentifier("genernal", driver), where)
+		if stmt := deleteStatement(&GenernalEntity{}, md, driver); stmt != expected {
+			t.Fatalf("%q delete, Expected=%s, Actual=%s", driver, expected, stmt)
+		}
+	}
+
+	if columns := ColumnListSQL(&EmptyEntity{}, driverPostgres); columns != "" {
+		t.Fatalf("EmptyEntity, Expected=\"\", Actual=%s", columns)
+	}
+}
+
+func TestNullableKeyStatement(t *testing.T) {
+	md, _ := newTestMetadata(&NullableKeyEntity{})
+
+	expected := map[string]string{
+		driverMysql:    "SELECT `code`, `name`, `region` FROM `nullable_key` WHERE `code` = :code AND `region` <=> :region LIMIT 1",
+		driverPostgres: `SELECT "code", "name", "region" FROM "nullable_key" WHERE "code" = :code AND "region" IS NOT DISTINCT FROM :region LIMIT 1`,
+		driverSqlite3:  `SELECT "code", "name", "region" FROM "nullable_key" WHERE "code" = :code AND "region" IS :region LIMIT 1`,
+	}
+
+	for driver, v := range expected {
+		if stmt := selectStatement(&NullableKeyEntity{}, md, driver); stmt != v {
+			t.Fatalf("%q NullableKeyEntity, Expected=%s, Actual=%s", driver, v, stmt)
+		}
+	}
+}
+
+func TestResolveDriver(t *testing.T) {
+	cases := map[string]string{
+		"mysql":                 driverMysql,
+		"mysql-otel":            driverMysql,
+		"pgx":                   driverPostgres,
+		"postgres-instrumented": driverPostgres,
+		"sqlite3":               driverSqlite3,
+		"nrsqlite3":             driverSqlite3,
+		"ocsql-0":               "ocsql-0",
+	}
+
+	for name, expected := range cases {
+		if actual := resolveDriver(name); actual != expected {
+			t.Fatalf("%q resolve driver, Expected=%s, Actual=%s", name, expected, actual)
+		}
+	}
+
+	SetDriverResolver(func(name string) string {
+		if name == "ocsql-0" {
+			return "postgres"
+		}
+		return name
+	})
+	defer SetDriverResolver(nil)
+
+	if actual := resolveDriver("ocsql-0"); actual != driverPostgres {
+		t.Fatalf("custom resolve driver, Expected=%s, Actual=%s", driverPostgres, actual)
+	}
+	if actual := resolveDriver("mysql-otel"); actual != driverMysql {
+		t.Fatalf("custom resolve driver, Expected=%s, Actual=%s", driverMysql, actual)
+	}
+}
+
 func TestQuoteColumn(t *testing.T) {
 	tests := []struct {
 		driver   string
@@ -155,3 +295,344 @@ func newTestMetadata(ent Entity) (*Metadata, error) {
 
 	return md, nil
 }
+
+func TestSupportsReturning(t *testing.T) {
+	cases := map[string]bool{
+		"mysql":      false,
+		"nrmysql":    false,
+		"postgres":   true,
+		"pgx":        true,
+		"sqlite3":    true,
+		"sqlite":     true,
+		"mysql-otel": false,
+	}
+
+	for driver, expected := range cases {
+		if actual := SupportsReturning(driver); actual != expected {
+			t.Fatalf("%q supports returning, Expected=%v, Actual=%v", driver, expected, actual)
+		}
+	}
+
+	md, _ := newTestMetadata(&MirrorEntity{})
+	if err := checkReturning(md, driverMysql, md.hasReturningInsert); err == nil {
+		t.Fatalf("mysql MirrorEntity, Expected error")
+	}
+	if err := checkReturning(md, driverMysql, md.hasReturningUpdate); err != nil {
+		t.Fatalf("mysql MirrorEntity, Unexpected error %v", err)
+	}
+}
+
+func TestIsUndefinedTableError(t *testing.T) {
+	cases := []struct {
+		driver   string
+		err      string
+		expected bool
+	}{
+		{driverPostgres, `pq: relation "foo" does not exist`, true},
+		{driverPostgres, `ERROR: relation "foo" does not exist (SQLSTATE 42P01)`, true},
+		{driverPostgres, `ERROR: column "foo" does not exist (SQLSTATE 42703)`, false},
+		{driverMysql, `Error 1146: Table 'test.foo' doesn't exist`, true},
+		{driverMysql, `Error 1146 (42S02): Table 'test.foo' doesn't exist`, true},
+		{driverMysql, `Error 1054: Unknown column 'foo' in 'field list'`, false},
+		{driverSqlite3, `no such table: foo`, true},
+		{driverSqlite3, `no such column: foo`, false},
+	}
+
+	for _, c := range cases {
+		db := sqlx.NewDb(nil, c.driver)
+		if actual := IsUndefinedTableError(db, errors.New(c.err)); actual != c.expected {
+			t.Fatalf("%q %s, Expected=%v, Actual=%v", c.driver, c.err, c.expected, actual)
+		}
+	}
+
+	db := newTestDB(t)
+	err := Load(context.Background(), &MirrorEntity{ID: 1}, db)
+	if !errors.Is(err, ErrUndefinedTable) || !IsUndefinedTableError(db, err) {
+		t.Fatalf("load from undefined table, Expected=%v, Actual=%v", ErrUndefinedTable, err)
+	}
+}
+
+func TestIsLockNotAvailable(t *testing.T) {
+	cases := []struct {
+		driver   string
+		err      string
+		expected bool
+	}{
+		{driverPostgres, `pq: could not obtain lock on row in relation "foo"`, true},
+		{driverPostgres, `ERROR: could not obtain lock on row in relation "foo" (SQLSTATE 55P03)`, true},
+		{driverPostgres, `ERROR: deadlock detected (SQLSTATE 40P01)`, false},
+		{driverMysql, `Error 3572 (HY000): Statement aborted because lock(s) could not be acquired immediately and NOWAIT is set.`, true},
+		{driverMysql, `Error 1205: Lock wait timeout exceeded; try restarting transaction`, false},
+		{driverSqlite3, `database is locked`, false},
+	}
+
+	for _, c := range cases {
+		db := sqlx.NewDb(nil, c.driver)
+		if actual := IsLockNotAvailable(db, errors.New(c.err)); actual != c.expected {
+			t.Fatalf("%q %s, Expected=%v, Actual=%v", c.driver, c.err, c.expected, actual)
+		}
+	}
+}
+
+func TestPrepareInsert(t *testing.T) {
+	stmt, binder, err := PrepareInsert(&MirrorEntity{}, "pgx")
+	if err != nil {
+		t.Fatalf("prepare insert, %v", err)
+	}
+
+	expected := `INSERT INTO "mirror" ("email", "email_copy") VALUES ($1, $2) RETURNING "id"`
+	if stmt != expected {
+		t.Fatalf("MirrorEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+
+	args := binder(&MirrorEntity{ID: 1, Email: "foo@example.com"})
+	if fmt.Sprint(args) != "[foo@example.com foo@example.com]" {
+		t.Fatalf("MirrorEntity args, Actual=%v", args)
+	}
+
+	if _, _, err := PrepareInsert(&MirrorEntity{}, driverMysql); err == nil {
+		t.Fatalf("mysql MirrorEntity, Expected error")
+	}
+
+	db := newTestDB(t, `CREATE TABLE sized (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT)`)
+	stmt, binder, err = PrepareInsert(&SizedEntity{}, driverSqlite3)
+	if err != nil {
+		t.Fatalf("prepare insert, %v", err)
+	}
+
+	var ent SizedEntity
+	ent.Name = "foo"
+	ent.Nickname.String, ent.Nickname.Valid = "bar", true
+	if err := db.QueryRowx(stmt, binder(&ent)...).Scan(&ent.ID); err != nil {
+		t.Fatalf("insert SizedEntity, %v", err)
+	}
+
+	var name, nickname string
+	if err := db.QueryRow(`SELECT name, nickname FROM sized WHERE id = ?`, ent.ID).Scan(&name, &nickname); err != nil {
+		t.Fatalf("select SizedEntity, %v", err)
+	} else if name != "foo" || nickname != "bar" {
+		t.Fatalf("SizedEntity, Expected=foo bar, Actual=%s %s", name, nickname)
+	}
+}
+
+func TestIsSerializationFailure(t *testing.T) {
+	cases := []struct {
+		driver   string
+		err      string
+		expected bool
+	}{
+		{driverPostgres, `pq: could not serialize access due to concurrent update`, true},
+		{driverPostgres, `ERROR: could not serialize access due to read/write dependencies among transactions (SQLSTATE 40001)`, true},
+		{driverPostgres, `ERROR: deadlock detected (SQLSTATE 40P01)`, false},
+		{driverMysql, `Error 1213 (40001): Deadlock found when trying to get lock; try restarting transaction`, true},
+		{driverMysql, `Error 1205: Lock wait timeout exceeded; try restarting transaction`, false},
+		{driverSqlite3, `database is locked`, false},
+	}
+
+	for _, c := range cases {
+		db := sqlx.NewDb(nil, c.driver)
+		if actual := IsSerializationFailure(db, errors.New(c.err)); actual != c.expected {
+			t.Fatalf("%q %s, Expected=%v, Actual=%v", c.driver, c.err, c.expected, actual)
+		}
+	}
+
+	db := sqlx.NewDb(nil, driverPostgres)
+	err := handle(context.Background(), db, OpUpdate, "users", func(ctx context.Context) error {
+		return errors.New("ERROR: could not serialize access due to concurrent update (SQLSTATE 40001)")
+	})
+	if !errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrUndefinedTable) {
+		t.Fatalf("classify error, Expected=%v, Actual=%v", ErrSerializationFailure, err)
+	}
+}
+
+func TestPGEnumStatement(t *testing.T) {
+	md, _ := newTestMetadata(&PGEnumEntity{})
+
+	expected := map[string]string{
+		"insert": `INSERT INTO "pgenum" ("id", "mood") VALUES (:id, CAST(:mood AS "mood"))`,
+		"update": `UPDATE "pgenum" SET "mood" = CAST(:mood AS "mood") WHERE "id" = :id`,
+		"select": `SELECT "id", "mood" FROM "pgenum" WHERE "id" = :id LIMIT 1`,
+	}
+	actual := map[string]string{
+		"insert": insertStatement(&PGEnumEntity{}, md, driverPostgres),
+		"update": updateStatement(&PGEnumEntity{}, md, driverPostgres),
+		"select": selectStatement(&PGEnumEntity{}, md, driverPostgres),
+	}
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Fatalf("%s PGEnumEntity, Expected=%s, Actual=%s", k, v, actual[k])
+		}
+	}
+
+	if stmt := insertStatement(&PGEnumEntity{}, md, driverMysql); stmt != "INSERT INTO `pgenum` (`id`, `mood`) VALUES (:id, :mood)" {
+		t.Fatalf("mysql PGEnumEntity, Actual=%s", stmt)
+	}
+
+	// 占位符能够被sqlx正确解析
+	if _, _, err := sqlx.Named(actual["update"], &PGEnumEntity{}); err != nil {
+		t.Fatalf("bind PGEnumEntity, %v", err)
+	}
+}
+
+func TestInsertLastInsertID(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE users (user_id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`)
+
+	id, err := Insert(context.Background(), &AutoIncrementEntity{Name: "foo"}, db)
+	if err != nil {
+		t.Fatalf("insert AutoIncrementEntity, %v", err)
+	} else if id <= 0 {
+		t.Fatalf("AutoIncrementEntity, Expected positive id, Actual=%d", id)
+	}
+}
+
+func TestStatementCacheConcurrency(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE users (user_id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`)
+	ctx := context.Background()
+
+	md, err := getMetadata(&AutoIncrementEntity{})
+	if err != nil {
+		t.Fatalf("get metadata, %v", err)
+	}
+	// 清空缓存，让并发的操作同时走缓存未命中的路径
+	for _, c := range []*statementCache{selectStatements, insertStatements} {
+		c.mu.Lock()
+		delete(c.stmts, md.Type)
+		c.mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ent := &AutoIncrementEntity{Name: "foo"}
+			id, err := doInsert(ctx, ent, db)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			ent.UserID = id
+			if err := doLoad(ctx, ent, db); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent insert and load, %v", err)
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	cases := []struct {
+		driver string
+		err    string
+	}{
+		{driverPostgres, `pq: duplicate key value violates unique constraint "mirror_pkey"`},
+		{driverMysql, `Error 1062: Duplicate entry '1' for key 'PRIMARY'`},
+		{driverSqlite3, `UNIQUE constraint failed: mirror.id`},
+		{driverSqlserver, `mssql: Violation of PRIMARY KEY constraint 'PK_mirror'. Cannot insert duplicate key in object 'dbo.mirror'. The duplicate key value is (1).`},
+	}
+
+	for _, c := range cases {
+		origin := errors.New(c.err)
+		err := classifyError(sqlx.NewDb(nil, c.driver), origin)
+		if !errors.Is(err, ErrConflict) {
+			t.Fatalf("%q %s, Expected=%v, Actual=%v", c.driver, c.err, ErrConflict, err)
+		} else if errors.Unwrap(err) != origin {
+			t.Fatalf("%q %s, unwrap Expected=%v, Actual=%v", c.driver, c.err, origin, errors.Unwrap(err))
+		}
+	}
+
+	db := newTestDB(t, `CREATE TABLE upsert (code TEXT PRIMARY KEY, name TEXT, create_at INTEGER DEFAULT 100)`)
+	ctx := context.Background()
+
+	if _, err := Insert(ctx, &UpsertEntity{Code: "a", Name: "foo"}, db); err != nil {
+		t.Fatalf("insert UpsertEntity, %v", err)
+	}
+
+	_, err := Insert(ctx, &UpsertEntity{Code: "a", Name: "bar"}, db)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("duplicate insert, Expected=%v, Actual=%v", ErrConflict, err)
+	} else if errors.Unwrap(err) == nil || !isConflictError(db, errors.Unwrap(err)) {
+		t.Fatalf("duplicate insert, unwrap Actual=%v", errors.Unwrap(err))
+	}
+}
+
+func TestColumnMismatch(t *testing.T) {
+	db := newTestDB(t)
+
+	rows, err := db.Queryx(`SELECT 1 AS id, 'red' AS team, 2 AS points, 3 AS rank`)
+	if err != nil {
+		t.Fatalf("query, %v", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		t.Fatalf("no rows, %v", rows.Err())
+	}
+
+	err = scanEntity(rows, &ScoreEntity{})
+	if !errors.Is(err, ErrColumnMismatch) {
+		t.Fatalf("expected ErrColumnMismatch, got %v", err)
+	} else if !strings.Contains(err.Error(), "unexpected columns [rank]") {
+		t.Fatalf("error should name the unexpected column, got %v", err)
+	}
+
+	md, err := getMetadata(&ScoreEntity{})
+	if err != nil {
+		t.Fatalf("get metadata, %v", err)
+	}
+	err = checkColumns(md, []string{"id", "team"}, []string{"id", "team", "points"})
+	if !errors.Is(err, ErrColumnMismatch) || !strings.Contains(err.Error(), "missing columns [points]") {
+		t.Fatalf("expected missing columns error, got %v", err)
+	}
+}
+
+func TestStatementCacheWarmAndClear(t *testing.T) {
+	// 缓存的语句不区分数据库，测试结束后清空，避免影响其它使用sqlite的测试
+	t.Cleanup(ClearStatementCache)
+
+	ree := &ReturningExtraEntity{}
+	ge := &GenernalEntity{}
+	if err := WarmCache(ree, "pgx"); err != nil {
+		t.Fatalf("warm cache, %v", err)
+	} else if err := WarmCache(ge, driverPostgres); err != nil {
+		t.Fatalf("warm cache, %v", err)
+	}
+
+	reeType := reflect.TypeOf(*ree)
+	geType := reflect.TypeOf(*ge)
+	for i, c := range statementCaches[:5] {
+		if _, ok := c.get(reeType); !ok {
+			t.Fatalf("cache %d, ReturningExtraEntity statement not warmed", i)
+		}
+	}
+
+	expected := `SELECT "id", "amount", "version" FROM "returning_extra" WHERE "id" = :id LIMIT 1`
+	if actual, _ := selectStatements.get(reeType); actual != expected {
+		t.Fatalf("warmed select, Expected=%s, Actual=%s", expected, actual)
+	}
+
+	ClearStatementCacheFor(ree)
+	for i, c := range statementCaches {
+		if _, ok := c.get(reeType); ok {
+			t.Fatalf("cache %d, ReturningExtraEntity statement not cleared", i)
+		}
+	}
+	if _, ok := selectStatements.get(geType); !ok {
+		t.Fatalf("GenernalEntity statement should be kept")
+	}
+
+	ClearStatementCache()
+	for i, c := range statementCaches {
+		if _, ok := c.get(geType); ok {
+			t.Fatalf("cache %d, GenernalEntity statement not cleared", i)
+		}
+	}
+}
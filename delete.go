@@ -0,0 +1,75 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeleteWhereChunked 分批删除符合条件的记录，每批最多删除chunkSize条，直到没有符合条件的记录为止
+// 用于删除大量数据，避免单条语句长时间锁表，返回删除的总数
+// 有softdelete字段的entity会改为软删除，已经被软删除的记录不会重复处理
+// where条件使用?作为参数占位符，同样适用entity的默认条件(DefaultScoper)，每批之间会检查ctx是否已经取消
+// 中途停止时返回*BatchError，可以用errors.Is()判断是context.Canceled还是context.DeadlineExceeded
+func DeleteWhereChunked(ctx context.Context, ent Entity, db DB, chunkSize int, where string, args ...interface{}) (int64, error) {
+	if chunkSize <= 0 {
+		return 0, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+
+	md, err := getMetadata(ent)
+	if err != nil {
+		return 0, fmt.Errorf("get metadata, %w", err)
+	}
+
+	scope, scopeArgs, err := scopeConds(ctx, ent, md)
+	if err != nil {
+		return 0, err
+	}
+	stmt := rebind(db, deleteChunkStatement(md, dbDriver(db), where, chunkSize, scope...))
+	args = append(append(softDeleteArgs(md), args...), scopeArgs...)
+
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, &BatchError{Processed: total, Err: err}
+		}
+
+		n, err := deleteChunk(ctx, db, stmt, args)
+		total += n
+		if err != nil {
+			return total, &BatchError{Processed: total, Err: err}
+		} else if n < int64(chunkSize) {
+			return total, nil
+		}
+	}
+}
+
+func deleteChunk(ctx context.Context, db DB, stmt string, args []interface{}) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get affected rows, %w", err)
+	}
+	return n, nil
+}
+
+func deleteChunkStatement(md *Metadata, driver string, where string, chunkSize int, scope ...string) string {
+	b := newBulkDelete(md, driver)
+	if driver == driverMysql || driver == driverSqlserver {
+		return b.where(where).where(notDeleted(md, driver)...).where(scope...).limit(chunkSize).String()
+	}
+
+	// sqlite默认编译选项不支持DELETE ... LIMIT
+	rowID := "rowid"
+	if driver == driverPostgres {
+		rowID = "ctid"
+	}
+	sub := newSelect(md, driver).expr(rowID).where(where).where(notDeleted(md, driver)...).where(scope...).limit(chunkSize)
+	return b.where(fmt.Sprintf("%s IN (%s)", rowID, sub)).String()
+}
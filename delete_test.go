@@ -0,0 +1,112 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteChunkStatement(t *testing.T) {
+	md, _ := newTestMetadata(&GenernalEntity{})
+
+	expected := map[string]string{
+		driverMysql:    "DELETE FROM `genernal` WHERE name = ? LIMIT 100",
+		driverPostgres: `DELETE FROM "genernal" WHERE ctid IN (SELECT ctid FROM "genernal" WHERE name = ? LIMIT 100)`,
+		driverSqlite3:  `DELETE FROM "genernal" WHERE rowid IN (SELECT rowid FROM "genernal" WHERE name = ? LIMIT 100)`,
+	}
+
+	for driver, v := range expected {
+		if stmt := deleteChunkStatement(md, driver, "name = ?", 100); stmt != v {
+			t.Fatalf("%q GenernalEntity, Expected=%s, Actual=%s", driver, v, stmt)
+		}
+	}
+
+	scoped := map[string]string{
+		driverMysql:    "DELETE FROM `genernal` WHERE name = ? AND tenant_id = ? LIMIT 100",
+		driverPostgres: `DELETE FROM "genernal" WHERE ctid IN (SELECT ctid FROM "genernal" WHERE name = ? AND tenant_id = ? LIMIT 100)`,
+	}
+
+	for driver, v := range scoped {
+		if stmt := deleteChunkStatement(md, driver, "name = ?", 100, "tenant_id = ?"); stmt != v {
+			t.Fatalf("%q GenernalEntity scoped, Expected=%s, Actual=%s", driver, v, stmt)
+		}
+	}
+}
+
+// 分批删除同样适用默认条件，不会删除其它租户的记录
+func TestDeleteWhereChunkedScoped(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT)`)
+	for i := 0; i < 15; i++ {
+		db.MustExec(`INSERT INTO tenant (tenant_id, name) VALUES (?, ?)`, i%3, "foo")
+	}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, 1)
+	n, err := DeleteWhereChunked(ctx, &TenantEntity{}, db, 2, "name = ?", "foo")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n)
+
+	var left int
+	require.NoError(t, db.Get(&left, `SELECT COUNT(*) FROM tenant WHERE tenant_id <> 1`))
+	require.Equal(t, 10, left)
+	require.NoError(t, db.Get(&left, `SELECT COUNT(*) FROM tenant WHERE tenant_id = 1`))
+	require.Equal(t, 0, left)
+}
+
+func TestDeleteWhereChunked(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	for i := 0; i < 25; i++ {
+		db.MustExec(`INSERT INTO mirror (email) VALUES (?)`, "foo")
+	}
+	db.MustExec(`INSERT INTO mirror (email) VALUES (?)`, "bar")
+
+	n, err := DeleteWhereChunked(context.Background(), &MirrorEntity{}, db, 10, "email = ?", "foo")
+	require.NoError(t, err)
+	require.Equal(t, int64(25), n)
+
+	var left int
+	require.NoError(t, db.Get(&left, `SELECT COUNT(*) FROM mirror`))
+	require.Equal(t, 1, left)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = DeleteWhereChunked(ctx, &MirrorEntity{}, db, 10, "email = ?", "bar")
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestDeleteWhereChunkedStopped(t *testing.T) {
+	for _, stopErr := range []error{context.Canceled, context.DeadlineExceeded} {
+		db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+		for i := 0; i < 25; i++ {
+			db.MustExec(`INSERT INTO mirror (email) VALUES (?)`, "foo")
+		}
+
+		// 删除两批之后停止
+		ctx := &stopAfterContext{Context: context.Background(), n: 2, err: stopErr}
+		n, err := DeleteWhereChunked(ctx, &MirrorEntity{}, db, 10, "email = ?", "foo")
+		require.Equal(t, int64(20), n)
+		require.True(t, errors.Is(err, stopErr))
+		require.False(t, errors.Is(err, context.Canceled) && errors.Is(err, context.DeadlineExceeded))
+
+		var be *BatchError
+		require.True(t, errors.As(err, &be))
+		require.Equal(t, int64(20), be.Processed)
+	}
+}
+
+// Err()被调用n次之后返回err
+type stopAfterContext struct {
+	context.Context
+	n   int
+	err error
+}
+
+func (c *stopAfterContext) Err() error {
+	if c.n <= 0 {
+		return c.err
+	}
+	c.n--
+	return nil
+}
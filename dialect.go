@@ -0,0 +1,165 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect 数据库方言，描述不同数据库在标识符引号、RETURNING、占位符以及错误信息上的差异
+type Dialect struct {
+	// 标识符的引号，例如mysql的`
+	Quote rune
+	// 标识符的右引号，与Quote不同时设置，例如sqlserver的[name]
+	CloseQuote rune
+	// 是否支持RETURNING子句
+	Returning bool
+	// 占位符格式，sqlx.QUESTION、sqlx.DOLLAR、sqlx.AT或sqlx.NAMED
+	// 只在sqlx无法根据驱动名识别占位符格式时使用
+	BindType int
+	// 判断错误是否为违反主键或唯一索引，为nil时不识别冲突错误
+	IsConflict func(err error) bool
+	// 判断错误是否为操作了不存在的表，为nil时不识别
+	IsUndefinedTable func(err error) bool
+	// 判断错误是否为NOWAIT无法立即获得行锁，为nil时不识别
+	IsLockNotAvailable func(err error) bool
+	// 判断错误是否为事务无法串行化，为nil时不识别
+	IsSerializationFailure func(err error) bool
+}
+
+func (d Dialect) quote(name string) string {
+	closeQuote := d.CloseQuote
+	if closeQuote == 0 {
+		closeQuote = d.Quote
+	}
+	return string(d.Quote) + name + string(closeQuote)
+}
+
+var (
+	dialects = map[string]Dialect{
+		driverMysql: {
+			Quote:              '`',
+			BindType:           sqlx.QUESTION,
+			IsConflict:         errorContains("Duplicate entry"),
+			IsUndefinedTable:   errorContains("Error 1146"),
+			IsLockNotAvailable: errorContains("Error 3572"),
+			// mysql没有单独的串行化错误，对应SQLSTATE同为40001的死锁错误1213
+			IsSerializationFailure: errorContains("Error 1213"),
+		},
+		driverPostgres: {
+			Quote:      '"',
+			Returning:  true,
+			BindType:   sqlx.DOLLAR,
+			IsConflict: errorContains("duplicate key value violates unique constraint"),
+			IsUndefinedTable: func(err error) bool {
+				s := err.Error()
+				return strings.Contains(s, "42P01") ||
+					(strings.Contains(s, "relation ") && strings.Contains(s, " does not exist"))
+			},
+			IsLockNotAvailable:     errorContains("55P03", "could not obtain lock"),
+			IsSerializationFailure: errorContains("40001", "could not serialize access"),
+		},
+		driverSqlite3: {
+			Quote:            '"',
+			Returning:        true,
+			BindType:         sqlx.QUESTION,
+			IsConflict:       errorContains("UNIQUE constraint failed"),
+			IsUndefinedTable: errorContains("no such table"),
+		},
+		driverSqlserver: {
+			Quote:      '[',
+			CloseQuote: ']',
+			Returning:  true,
+			BindType:   sqlx.AT,
+			// 2627违反主键或唯一约束，2601违反唯一索引
+			IsConflict:       errorContains("Cannot insert duplicate key"),
+			IsUndefinedTable: errorContains("Invalid object name"),
+		},
+	}
+	dialectsMu sync.RWMutex
+
+	// 没有注册的驱动使用标准SQL的写法
+	defaultDialect = Dialect{
+		Quote:     '"',
+		Returning: true,
+		BindType:  sqlx.QUESTION,
+	}
+)
+
+// RegisterDialect 注册数据库方言，name为驱动名，已经注册的驱动会被覆盖
+// 用于本包不认识的驱动，方言只决定标识符引号、RETURNING、占位符格式以及错误归类
+// 语句的其它部分(LIMIT、ON CONFLICT、FOR UPDATE、NULL安全比较、EXPLAIN等)仍然按照标准SQL构造，
+// 只对内置的mysql、postgres、sqlite3、sqlserver生成各自的写法
+// 方言应该在程序初始化阶段，执行任何数据库操作之前注册
+func RegisterDialect(name string, d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+
+	dialects[name] = d
+}
+
+// driver为resolveDriver()转换之后的驱动名
+func getDialect(driver string) Dialect {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	if d, ok := dialects[driver]; ok {
+		return d
+	}
+	return defaultDialect
+}
+
+// 错误信息包含任意一个s时返回true
+func errorContains(s ...string) func(err error) bool {
+	return func(err error) bool {
+		msg := err.Error()
+		for _, v := range s {
+			if strings.Contains(msg, v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 把?占位符转换为数据库使用的格式
+// sqlx无法根据驱动名识别占位符格式时(例如pgx/v5或者自定义的驱动)，使用方言的设置
+func rebind(db DB, query string) string {
+	if sqlx.BindType(db.DriverName()) == sqlx.UNKNOWN {
+		if bt := getDialect(dbDriver(db)).BindType; bt != sqlx.QUESTION && bt != sqlx.UNKNOWN {
+			return sqlx.Rebind(bt, query)
+		}
+	}
+	return db.Rebind(query)
+}
+
+// 绑定命名参数并转换为数据库使用的占位符格式
+// sqlx只按照驱动名识别占位符格式，自定义驱动需要通过方言的BindType转换
+func bindNamedDB(db DB, query string, arg interface{}) (string, []interface{}, error) {
+	q, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return "", nil, err
+	}
+	return rebind(db, q), args, nil
+}
+
+// 代替sqlx.NamedQueryContext，按照方言绑定命名参数
+func namedQuery(ctx context.Context, db DB, query string, arg interface{}) (*sqlx.Rows, error) {
+	q, args, err := bindNamedDB(db, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryxContext(ctx, q, args...)
+}
+
+// 代替db.NamedExecContext，按照方言绑定命名参数
+func namedExec(ctx context.Context, db DB, query string, arg interface{}) (sql.Result, error) {
+	q, args, err := bindNamedDB(db, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, q, args...)
+}
@@ -0,0 +1,112 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRegisterDialect(t *testing.T) {
+	RegisterDialect("exampledb", Dialect{
+		Quote:     '`',
+		Returning: false,
+		BindType:  sqlx.DOLLAR,
+		IsConflict: func(err error) bool {
+			return strings.Contains(err.Error(), "E2001")
+		},
+	})
+	t.Cleanup(func() {
+		dialectsMu.Lock()
+		delete(dialects, "exampledb")
+		dialectsMu.Unlock()
+	})
+
+	md, err := newTestMetadata(&ReturningExtraEntity{})
+	if err != nil {
+		t.Fatalf("get metadata, %v", err)
+	}
+
+	expected := "SELECT `amount`, `id`, `version` FROM `returning_extra` WHERE `id` = :id LIMIT 1"
+	if actual := selectStatement(&ReturningExtraEntity{}, md, "exampledb"); actual != expected {
+		t.Fatalf("select, Expected=%s, Actual=%s", expected, actual)
+	}
+
+	expected = "`public`.`users`"
+	if actual := quoteIdentifier("`public`.users", "exampledb"); actual != expected {
+		t.Fatalf("identifier, Expected=%s, Actual=%s", expected, actual)
+	}
+
+	if SupportsReturning("exampledb") {
+		t.Fatalf("exampledb should not support RETURNING")
+	}
+
+	db := sqlx.NewDb(nil, "exampledb")
+	if actual := rebind(db, "SELECT 1 WHERE a = ? AND b = ?"); actual != "SELECT 1 WHERE a = $1 AND b = $2" {
+		t.Fatalf("rebind, Actual=%s", actual)
+	}
+
+	if !errors.Is(classifyError(db, errors.New("E2001: duplicate row")), ErrConflict) {
+		t.Fatalf("expected conflict error")
+	} else if errors.Is(classifyError(db, errors.New("E1000: syntax error")), ErrConflict) {
+		t.Fatalf("unexpected conflict error")
+	}
+
+	// 没有注册的驱动使用标准SQL的双引号
+	if actual := quoteColumn("id", "unknowndb"); actual != `"id"` {
+		t.Fatalf("default quote, Actual=%s", actual)
+	}
+}
+
+// sqlx不认识的驱动，命名参数同样按照方言的占位符格式绑定
+func TestRegisterDialectBindNamed(t *testing.T) {
+	RegisterDialect("dollardb", Dialect{
+		Quote:            '"',
+		Returning:        true,
+		BindType:         sqlx.DOLLAR,
+		IsConflict:       errorContains("UNIQUE constraint failed"),
+		IsUndefinedTable: errorContains("no such table"),
+	})
+	t.Cleanup(func() {
+		dialectsMu.Lock()
+		delete(dialects, "dollardb")
+		dialectsMu.Unlock()
+	})
+
+	var queries []string
+	Use(LoggingMiddleware(func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error) {
+		queries = append(queries, query)
+	}))
+	defer resetMiddlewares()
+
+	// sqlite可以识别$N形式的占位符
+	db := sqlx.NewDb(newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`).DB, "dollardb")
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	if _, err := Insert(ctx, ent, db); err != nil {
+		t.Fatalf("insert, %v", err)
+	} else if err := Load(ctx, ent, db); err != nil {
+		t.Fatalf("load, %v", err)
+	} else if err := Update(ctx, ent, db); err != nil {
+		t.Fatalf("update, %v", err)
+	} else if err := Delete(ctx, ent, db); err != nil {
+		t.Fatalf("delete, %v", err)
+	}
+
+	if len(queries) != 4 {
+		t.Fatalf("Expected 4 queries, Actual=%d", len(queries))
+	}
+	for _, q := range queries {
+		if !strings.Contains(q, "$1") || strings.Contains(q, "?") {
+			t.Fatalf("unexpected placeholder, %s", q)
+		}
+	}
+
+	if err := Load(ctx, &MirrorEntity{ID: 1}, sqlx.NewDb(newTestDB(t).DB, "dollardb")); !errors.Is(err, ErrUndefinedTable) {
+		t.Fatalf("expected undefined table error, %v", err)
+	}
+}
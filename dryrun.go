@@ -0,0 +1,89 @@
+package entity
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// InsertSQL 返回Insert会执行的语句及参数，不访问数据库，用于调试或者检查不同数据库生成的语句
+// 语句已经按照driver的占位符格式绑定参数，不会触发entity事件，也不会填充created、updated字段
+func InsertSQL(ent Entity, driver string) (string, []interface{}, error) {
+	md, driver, err := dryRunMetadata(ent, driver)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var arg interface{} = ent
+	var stmt string
+	if md.hasNullPolicy {
+		var omd *Metadata
+		omd, arg = nullPolicyValues(ent, md)
+		stmt = insertStatement(ent, omd, driver)
+	} else {
+		stmt = insertStatement(ent, md, driver)
+	}
+
+	if arg, err = encodeArg(ent, md, arg); err != nil {
+		return "", nil, err
+	}
+	return bindNamed(driver, stmt, arg)
+}
+
+// SelectSQL 返回Load按主键查询的语句及参数，不包括DefaultScoper的条件
+func SelectSQL(ent Entity, driver string) (string, []interface{}, error) {
+	md, driver, err := dryRunMetadata(ent, driver)
+	if err != nil {
+		return "", nil, err
+	}
+	return bindNamed(driver, selectStatement(ent, md, driver), ent)
+}
+
+// UpdateSQL 返回Update会执行的语句及参数，不包括DefaultScoper的条件
+func UpdateSQL(ent Entity, driver string) (string, []interface{}, error) {
+	md, driver, err := dryRunMetadata(ent, driver)
+	if err != nil {
+		return "", nil, err
+	}
+
+	arg, err := encodeArg(ent, md, ent)
+	if err != nil {
+		return "", nil, err
+	}
+	return bindNamed(driver, updateStatement(ent, md, driver), arg)
+}
+
+// DeleteSQL 返回Delete会执行的语句及参数，不包括DefaultScoper的条件
+// 软删除的entity返回UPDATE语句，删除时间使用当前时间，entity本身不会被修改
+func DeleteSQL(ent Entity, driver string) (string, []interface{}, error) {
+	md, driver, err := dryRunMetadata(ent, driver)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var arg interface{} = ent
+	if md.softDelete != nil {
+		args := entityArgs(ent, md)
+		args[md.softDelete.DBField] = nowFunc()
+		arg = args
+	}
+	return bindNamed(driver, deleteStatement(ent, md, driver), arg)
+}
+
+func dryRunMetadata(ent Entity, driver string) (*Metadata, string, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return nil, "", fmt.Errorf("get metadata, %w", err)
+	}
+
+	allocEmbedded(ent, md)
+	return md, resolveDriver(driver), nil
+}
+
+func bindNamed(driver string, stmt string, arg interface{}) (string, []interface{}, error) {
+	query, args, err := sqlx.BindNamed(getDialect(driver).BindType, stmt, arg)
+	if err != nil {
+		return "", nil, fmt.Errorf("bind named, %w", err)
+	}
+	return query, args, nil
+}
@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunSQL(t *testing.T) {
+	ent := &ReturningExtraEntity{ID: 1, Amount: 100, Version: 3}
+
+	stmt, args, err := InsertSQL(ent, "pgx")
+	require.NoError(t, err)
+	require.Equal(t, `INSERT INTO "returning_extra" ("id", "amount", "version") VALUES ($1, $2, $3)`, stmt)
+	require.Equal(t, []interface{}{1, 100, 3}, args)
+
+	stmt, args, err = SelectSQL(ent, driverMysql)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT `id`, `amount`, `version` FROM `returning_extra` WHERE `id` = ? LIMIT 1", stmt)
+	require.Equal(t, []interface{}{1}, args)
+
+	stmt, args, err = UpdateSQL(ent, driverPostgres)
+	require.NoError(t, err)
+	require.Equal(t, `UPDATE "returning_extra" SET "amount" = $1 WHERE "id" = $2 RETURNING "version"`, stmt)
+	require.Equal(t, []interface{}{100, 1}, args)
+
+	stmt, args, err = DeleteSQL(ent, driverSqlserver)
+	require.NoError(t, err)
+	require.Equal(t, `DELETE FROM [returning_extra] WHERE [id] = @p1`, stmt)
+	require.Equal(t, []interface{}{1}, args)
+
+	// 软删除使用当前时间，不修改entity
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	sde := &SoftDeleteEntity{ID: 7}
+	stmt, args, err = DeleteSQL(sde, driverSqlite3)
+	require.NoError(t, err)
+	require.Equal(t, `UPDATE "soft_delete" SET "deleted_at" = ? WHERE "id" = ? AND "deleted_at" IS NULL`, stmt)
+	require.Equal(t, []interface{}{now, 7}, args)
+	require.Nil(t, sde.DeletedAt)
+}
@@ -0,0 +1,112 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// EnsureRetries Ensure因为并发插入冲突而重试的次数
+var EnsureRetries = 3
+
+// Ensure 保证表内存在与entity对应的记录，执行完毕后entity的所有字段都会被数据库内的数据填充
+// 先按照lookupCols字段的值查询，不存在时插入entity，再重新读取以获得数据库生成的字段值
+// lookupCols为空时按照主键查询，lookupCols应该有唯一索引，否则无法发现并发插入的重复记录
+//
+// db是*sqlx.DB时在一个事务内执行，并发插入发生冲突时开启新的事务重新读取已有记录，最多重试EnsureRetries次
+// 否则认为db已经是事务，不重试，冲突时直接返回ErrConflict，postgresql的事务在发生冲突以后无法继续执行，只能由调用方重试
+func Ensure(ctx context.Context, ent Entity, db DB, lookupCols ...string) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	if len(lookupCols) == 0 {
+		lookupCols = columnNames(md.PrimaryKeys)
+	}
+	for _, name := range lookupCols {
+		if _, ok := md.Column(name); !ok {
+			return fmt.Errorf("entity %q, unknown lookup column %q", md.Type, name)
+		}
+	}
+
+	v, ok := db.(*sqlx.DB)
+	if !ok {
+		// 调用方的事务发生冲突以后无法继续使用，原样返回冲突错误
+		return ensureEntity(ctx, ent, md, db, lookupCols)
+	}
+
+	for i := 0; ; i++ {
+		err := Transaction(v, func(tx *sqlx.Tx) error {
+			return ensureEntity(ctx, ent, md, tx, lookupCols)
+		})
+		if err == nil || !errors.Is(err, ErrConflict) || i >= EnsureRetries {
+			return err
+		}
+	}
+}
+
+func ensureEntity(ctx context.Context, ent Entity, md *Metadata, db DB, lookupCols []string) error {
+	if found, err := loadByColumns(ctx, ent, md, db, lookupCols); err != nil {
+		return fmt.Errorf("load, %w", err)
+	} else if found {
+		return nil
+	}
+
+	if _, err := Insert(ctx, ent, db); err != nil {
+		return err
+	}
+
+	if found, err := loadByColumns(ctx, ent, md, db, lookupCols); err != nil {
+		return fmt.Errorf("reload, %w", err)
+	} else if !found {
+		// 插入以后仍然查询不到，通常是lookupCols的值被数据库修改了
+		return fmt.Errorf("reload after insert, %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// 按照指定字段的值读取entity，同样适用默认条件和软删除条件
+func loadByColumns(ctx context.Context, ent Entity, md *Metadata, db DB, cols []string) (bool, error) {
+	allocEmbedded(ent, md)
+
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return false, err
+	}
+
+	driver := dbDriver(db)
+	b := newSelect(md, driver).column(columnNames(md.Columns)...)
+	for _, name := range cols {
+		col, _ := md.Column(name)
+		b.where(fmt.Sprintf("%s = %s", quoteColumn(col.DBField, driver), bindParam(col, driver, ":"+col.DBField)))
+	}
+	stmt := b.where(notDeleted(md, driver)...).where(scope...).limit(1).String()
+
+	db = withLogger(db)
+	var found bool
+	err = handle(ctx, db, OpLoad, md.TableName, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+		defer cancel()
+
+		rows, err := namedQuery(ctx, db, stmt, arg)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			return rows.Err()
+		}
+
+		if err := scanEntity(rows, ent); err != nil {
+			return fmt.Errorf("scan struct, %w", err)
+		}
+		found = true
+		return rows.Err()
+	})
+	return found, err
+}
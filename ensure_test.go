@@ -0,0 +1,138 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type EnsureEntity struct {
+	ID    int64  `db:"id,primaryKey,autoIncrement"`
+	Email string `db:"email"`
+	Code  string `db:"code,generated=upper(email),stored"`
+
+	beforeInsert func() error
+}
+
+func (ee EnsureEntity) TableName() string {
+	return "ensure"
+}
+
+func (ee *EnsureEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	if ev == EventBeforeInsert && ee.beforeInsert != nil {
+		return ee.beforeInsert()
+	}
+	return nil
+}
+
+const ensureSchema = `CREATE TABLE ensure (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL UNIQUE,
+	code TEXT GENERATED ALWAYS AS (upper(email)) STORED
+)`
+
+func TestEnsure(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("created", func(t *testing.T) {
+		db := newTestDB(t, ensureSchema)
+
+		ent := &EnsureEntity{Email: "foo@example.com"}
+		if err := Ensure(ctx, ent, db, "email"); err != nil {
+			t.Fatalf("Ensure, %v", err)
+		}
+
+		if ent.ID == 0 {
+			t.Fatalf("expected id to be populated")
+		} else if ent.Code != "FOO@EXAMPLE.COM" {
+			t.Fatalf("expected generated column to be reloaded, got %q", ent.Code)
+		}
+	})
+
+	t.Run("found", func(t *testing.T) {
+		db := newTestDB(t, ensureSchema, `INSERT INTO ensure (id, email) VALUES (7, 'bar@example.com')`)
+
+		ent := &EnsureEntity{
+			Email: "bar@example.com",
+			beforeInsert: func() error {
+				t.Fatalf("existing record should not be inserted")
+				return nil
+			},
+		}
+		if err := Ensure(ctx, ent, db, "email"); err != nil {
+			t.Fatalf("Ensure, %v", err)
+		}
+
+		if ent.ID != 7 || ent.Code != "BAR@EXAMPLE.COM" {
+			t.Fatalf("unexpected entity, %+v", ent)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		db := newTestDB(t, ensureSchema)
+
+		tx := db.MustBegin()
+		defer tx.Rollback()
+
+		// 模拟查询之后、插入之前其它连接插入了相同的记录
+		attempts := 0
+		ent := &EnsureEntity{Email: "baz@example.com"}
+		ent.beforeInsert = func() error {
+			attempts++
+			_, err := tx.Exec(`INSERT INTO ensure (id, email) VALUES (9, 'baz@example.com')`)
+			return err
+		}
+
+		// 调用方的事务不重试，冲突原样返回
+		if err := Ensure(ctx, ent, tx, "email"); !errors.Is(err, ErrConflict) {
+			t.Fatalf("expected conflict error, got %v", err)
+		} else if attempts != 1 {
+			t.Fatalf("expected 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		db := newTestDB(t, ensureSchema)
+
+		const n = 10
+		ids := make([]int64, n)
+		errs := make([]error, n)
+
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				ent := &EnsureEntity{Email: "qux@example.com"}
+				errs[i] = Ensure(ctx, ent, db, "email")
+				ids[i] = ent.ID
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 0; i < n; i++ {
+			if errs[i] != nil {
+				t.Fatalf("Ensure, %v", errs[i])
+			} else if ids[i] != ids[0] {
+				t.Fatalf("expected same record, got ids %v", ids)
+			}
+		}
+
+		var count int
+		if err := db.Get(&count, `SELECT COUNT(*) FROM ensure`); err != nil {
+			t.Fatalf("count, %v", err)
+		} else if count != 1 {
+			t.Fatalf("expected 1 record, got %d", count)
+		}
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		db := newTestDB(t, ensureSchema)
+
+		if err := Ensure(ctx, &EnsureEntity{}, db, "nickname"); err == nil {
+			t.Fatalf("expected error for unknown lookup column")
+		}
+	})
+}
@@ -2,10 +2,17 @@ package entity
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/reflectx"
@@ -26,11 +33,45 @@ const (
 	EventBeforeDelete
 	// EventAfterDelete after delete entity
 	EventAfterDelete
+	// EventAfterLoad after load entity, also triggered when loaded from cache
+	EventAfterLoad
+)
+
+// 插入时字段零值的处理方式
+const (
+	// NullPolicyNull 零值写入NULL
+	NullPolicyNull = "null"
+	// NullPolicyZero 零值原样写入，默认行为
+	NullPolicyZero = "zero"
+	// NullPolicyOmit 零值字段不写入，使用数据库默认值
+	NullPolicyOmit = "omit"
+)
+
+// 写入时字符串字段的规范化方式
+const (
+	// NormalizeLower 转换为小写
+	NormalizeLower = "lower"
+	// NormalizeTrim 去掉首尾空白
+	NormalizeTrim = "trim"
+	// NormalizeLowerTrim 去掉首尾空白并转换为小写
+	NormalizeLowerTrim = "lower_trim"
 )
 
 var (
-	// ErrConflict 发生了数据冲突
+	// ErrConflict 发生了数据冲突(违反主键或唯一索引)，可以用errors.Is(err, ErrConflict)判断
 	ErrConflict = fmt.Errorf("database record conflict")
+	// ErrUndefinedTable 操作的表不存在
+	ErrUndefinedTable = fmt.Errorf("undefined table")
+	// ErrSerializationFailure 事务无法串行化，可以重试
+	ErrSerializationFailure = fmt.Errorf("serialization failure")
+	// ErrValueTooLong 字段内容超过了声明的长度
+	ErrValueTooLong = fmt.Errorf("value too long")
+	// ErrVersionMismatch 更新时记录的版本号与entity不一致，说明记录已经被其它操作修改
+	ErrVersionMismatch = fmt.Errorf("version mismatch")
+	// ErrColumnMismatch 查询结果的字段与entity不一致，通常是表结构修改以后entity没有同步修改
+	ErrColumnMismatch = fmt.Errorf("column mismatch")
+	// ErrInvalidEnum 字段值不在参照表内
+	ErrInvalidEnum = fmt.Errorf("invalid enum value")
 
 	// ReadTimeout 读取entity数据的默认超时时间
 	ReadTimeout = 3 * time.Second
@@ -41,6 +82,13 @@ var (
 	entitiesMux sync.RWMutex
 
 	mapper = reflectx.NewMapper("db")
+
+	strictMode bool
+
+	// 填充created、updated字段使用的时钟，测试时可以替换
+	nowFunc = time.Now
+
+	timeType = reflect.TypeOf(time.Time{})
 )
 
 // Event 存储事件
@@ -52,15 +100,110 @@ type Entity interface {
 	OnEntityEvent(ctx context.Context, ev Event) error
 }
 
+// ScanDest 自定义读取数据时的接收对象
+// 实现了此接口的entity，读取数据时不使用StructScan，而是使用ScanDests()返回的对象接收每个字段的数据
+type ScanDest interface {
+	ScanDests(cols []string) []interface{}
+}
+
+// PrimaryKeyArg 按元数据的主键顺序(primaryKey=N指定的顺序)返回主键值，通常由entitygen生成
+// 实现了此接口并且同时实现了ScanDest的entity，按主键读取时不再通过反射绑定参数以及读取数据
+type PrimaryKeyArg interface {
+	PrimaryKeyArgs() []interface{}
+}
+
+// ColumnList 按元数据顺序返回数据库字段名，通常由entitygen生成
+// Registry注册时会检查返回结果与元数据是否一致，用于发现没有重新生成的代码
+type ColumnList interface {
+	Columns() []string
+}
+
+// SaveChecker Save时是否先查询数据库确认记录是否存在
+// 自然主键(例如用户名、编码)在插入之前就有值，不能根据主键是否为零值判断是新记录，可以实现此接口返回true
+type SaveChecker interface {
+	SaveCheckExists() bool
+}
+
+// InsertReloader 插入之后是否重新读取entity
+// 没有使用RETURNING的插入(例如mysql)拿不到数据库填充的默认值，实现此接口并返回true时，插入成功后按照主键重新读取一次
+// 自增主键先通过LastInsertId写回entity，重新读取在EventAfterInsert事件之前执行
+type InsertReloader interface {
+	ReloadAfterInsert() bool
+}
+
+// RawTableName 实现此接口并返回true的entity，TableName()的返回值原样写入SQL，不加引号
+// 用于ONLY parent_table、表函数等表达式，返回值会直接拼接到语句内，只能返回可信的常量
+type RawTableName interface {
+	RawTableName() bool
+}
+
+// OnConflicter 插入时发生主键或唯一索引冲突的处理方法，例如读取已有记录再合并
+// 返回nil时认为插入已经处理完毕，Insert返回成功，但不会触发EventAfterInsert事件
+// 返回错误时Insert返回此错误
+type OnConflicter interface {
+	OnConflict(ctx context.Context, db DB) error
+}
+
+// Validatable 写入前的数据校验，插入、更新以及upsert在Before事件之后、构造语句之前调用
+// Validate返回的错误原样返回，不会被包装，调用方可以直接判断自定义的错误类型
+type Validatable interface {
+	Validate() error
+}
+
+func validate(ent Entity) error {
+	if v, ok := ent.(Validatable); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
 // Column 字段信息
 type Column struct {
-	StructField     string
-	DBField         string
-	PrimaryKey      bool
+	StructField string
+	DBField     string
+	PrimaryKey  bool
+	// 复合主键在查询条件内的顺序，从1开始，0表示按照字段声明的顺序排在有顺序的主键之后
+	PrimaryKeyOrder int
 	AutoIncrement   bool
 	RefuseUpdate    bool
 	ReturningInsert bool
 	ReturningUpdate bool
+	// 可以为NULL的主键字段，查询条件需要使用NULL安全的比较
+	NullableKey bool
+	// 字符串最大长度，按字符计算，0表示不限制
+	Size int
+	// 冗余存储同一个值的其它字段，写入时一并写入，读取时只读取DBField
+	Mirrors []string
+	// 插入时字段为零值的处理方式，见NullPolicyNull、NullPolicyZero、NullPolicyOmit
+	NullPolicy string
+	// postgresql原生enum类型名，写入时参数会转换为此类型
+	PGEnum string
+	// 写入前对字符串值的规范化方式，见NormalizeLower、NormalizeTrim、NormalizeLowerTrim
+	Normalize string
+	// 字段编解码器名称，见RegisterCodec
+	Codec string
+	// 数据库生成字段的表达式，例如price * quantity，生成字段不会被插入或更新
+	Generated string
+	// 生成字段是否存储在表内(STORED)，否则为VIRTUAL
+	GeneratedStored bool
+	// 乐观锁版本号字段，更新时自增并且作为更新条件
+	Version bool
+	// postgresql网络地址类型，inet或者cidr，根据字段类型自动识别
+	Inet string
+	// 创建时间字段，插入时自动填充，不允许更新
+	Created bool
+	// 更新时间字段，插入及更新时自动填充
+	Updated bool
+	// 软删除时间字段，删除时写入当前时间，查询时忽略已经删除的记录
+	SoftDelete bool
+	// 取值范围所在的参照表及字段，格式为table(column)，写入前检查值是否存在
+	FKEnum string
+	// 字段值转换器名称，见RegisterConverter
+	Converter string
+	// 软删除时一并软删除的子表，子表的CascadeFK字段值等于本字段的值
+	// 使用entity tag声明，例如`entity:"cascade_delete=order_items,fk=order_id"`
+	CascadeDelete string
+	CascadeFK     string
 }
 
 func (c Column) String() string {
@@ -76,6 +219,37 @@ type Metadata struct {
 
 	hasReturningInsert bool
 	hasReturningUpdate bool
+	hasSizeLimit       bool
+	hasNullPolicy      bool
+	hasNormalize       bool
+	hasCodec           bool
+	hasVersion         bool
+	hasInet            bool
+	hasConverter       bool
+	hasFKEnum          bool
+	hasEmbeddedPtr     bool
+	hasAutoIncrement   bool
+
+	// 声明为RawTableName的表名，生成语句时不加引号
+	rawTable bool
+
+	// 自动填充的创建时间及更新时间字段，没有时为nil
+	created *Column
+	updated *Column
+	// 软删除字段，没有时为nil
+	softDelete *Column
+	// 声明了cascade_delete的字段
+	cascades []Column
+}
+
+// Column 根据数据库字段名查找字段
+func (md *Metadata) Column(name string) (Column, bool) {
+	for _, col := range md.Columns {
+		if col.DBField == name {
+			return col, true
+		}
+	}
+	return Column{}, false
 }
 
 // NewMetadata 构造实体对象元数据
@@ -93,6 +267,18 @@ func NewMetadata(ent Entity) (*Metadata, error) {
 		return nil, fmt.Errorf("empty entity %q", md.Type)
 	}
 
+	if v, ok := ent.(RawTableName); ok && v.RawTableName() {
+		md.rawTable = true
+	}
+
+	// 嵌入的struct与外层struct的字段名冲突时，无法确定应该使用哪个字段
+	if err := checkDuplicateFields(mapper.TypeMap(md.Type).Tree); err != nil {
+		return nil, fmt.Errorf("entity %q, %w", md.Type, err)
+	}
+	if err := checkMirrors(md.Columns); err != nil {
+		return nil, fmt.Errorf("entity %q, %w", md.Type, err)
+	}
+
 	for _, col := range md.Columns {
 		if col.ReturningInsert {
 			md.hasReturningInsert = true
@@ -100,18 +286,234 @@ func NewMetadata(ent Entity) (*Metadata, error) {
 		if col.ReturningUpdate {
 			md.hasReturningUpdate = true
 		}
+		if col.AutoIncrement {
+			md.hasAutoIncrement = true
+		}
+		if col.Size < 0 {
+			return nil, fmt.Errorf("entity %q, column %q invalid size", md.Type, col.DBField)
+		} else if col.Size > 0 {
+			md.hasSizeLimit = true
+		}
+		switch col.NullPolicy {
+		case "", NullPolicyZero:
+		case NullPolicyNull, NullPolicyOmit:
+			md.hasNullPolicy = true
+		default:
+			return nil, fmt.Errorf("entity %q, column %q invalid null policy %q", md.Type, col.DBField, col.NullPolicy)
+		}
+		switch col.Normalize {
+		case "":
+		case NormalizeLower, NormalizeTrim, NormalizeLowerTrim:
+			md.hasNormalize = true
+		default:
+			return nil, fmt.Errorf("entity %q, column %q invalid normalize %q", md.Type, col.DBField, col.Normalize)
+		}
+		if col.GeneratedStored && col.Generated == "" {
+			return nil, fmt.Errorf("entity %q, column %q stored requires generated expression", md.Type, col.DBField)
+		} else if col.Generated != "" && col.PrimaryKey {
+			return nil, fmt.Errorf("entity %q, primary key %q cannot be generated", md.Type, col.DBField)
+		}
+		if col.Codec != "" {
+			if _, ok := getCodec(col.Codec); !ok {
+				return nil, fmt.Errorf("entity %q, column %q unknown codec %q", md.Type, col.DBField, col.Codec)
+			} else if col.PrimaryKey {
+				return nil, fmt.Errorf("entity %q, primary key %q cannot use codec", md.Type, col.DBField)
+			}
+			md.hasCodec = true
+		}
+		if col.Inet != "" {
+			md.hasInet = true
+		}
+		if col.Converter != "" {
+			if _, ok := getConverter(col.Converter); !ok {
+				return nil, fmt.Errorf("entity %q, column %q unknown converter %q", md.Type, col.DBField, col.Converter)
+			} else if col.PrimaryKey {
+				return nil, fmt.Errorf("entity %q, primary key %q cannot use converter", md.Type, col.DBField)
+			} else if col.Codec != "" {
+				return nil, fmt.Errorf("entity %q, column %q cannot use both codec and converter", md.Type, col.DBField)
+			}
+			md.hasConverter = true
+		}
+		if col.FKEnum != "" {
+			if _, _, ok := parseFKEnum(col.FKEnum); !ok {
+				return nil, fmt.Errorf("entity %q, column %q invalid fkEnum %q", md.Type, col.DBField, col.FKEnum)
+			}
+			md.hasFKEnum = true
+		}
+		if col.SoftDelete {
+			if md.softDelete != nil {
+				return nil, fmt.Errorf("entity %q, multiple softdelete columns", md.Type)
+			} else if t := mapper.TypeMap(md.Type).Names[col.DBField].Field.Type; t != nullTimeType && t != reflect.PtrTo(timeType) {
+				return nil, fmt.Errorf("entity %q, softdelete column %q must be *time.Time or sql.NullTime", md.Type, col.DBField)
+			}
+
+			c := col
+			md.softDelete = &c
+		}
+		if col.Created || col.Updated {
+			if t := reflectx.Deref(mapper.TypeMap(md.Type).Names[col.DBField].Field.Type); t != timeType {
+				return nil, fmt.Errorf("entity %q, timestamp column %q must be time.Time", md.Type, col.DBField)
+			} else if col.Created && col.Updated {
+				return nil, fmt.Errorf("entity %q, column %q cannot be both created and updated", md.Type, col.DBField)
+			}
+
+			c := col
+			if col.Created {
+				if md.created != nil {
+					return nil, fmt.Errorf("entity %q, multiple created columns", md.Type)
+				}
+				md.created = &c
+			} else {
+				if md.updated != nil {
+					return nil, fmt.Errorf("entity %q, multiple updated columns", md.Type)
+				}
+				md.updated = &c
+			}
+		}
+		if col.Version {
+			if md.hasVersion {
+				return nil, fmt.Errorf("entity %q, multiple version columns", md.Type)
+			} else if col.RefuseUpdate || col.ReturningUpdate {
+				return nil, fmt.Errorf("entity %q, version column %q must be updatable", md.Type, col.DBField)
+			}
+
+			switch reflectx.Deref(mapper.TypeMap(md.Type).Names[col.DBField].Field.Type).Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return nil, fmt.Errorf("entity %q, version column %q must be integer", md.Type, col.DBField)
+			}
+			md.hasVersion = true
+		}
+		if col.CascadeDelete != "" || col.CascadeFK != "" {
+			if col.CascadeDelete == "" || col.CascadeFK == "" {
+				return nil, fmt.Errorf("entity %q, column %q cascade_delete requires both table and fk", md.Type, col.DBField)
+			}
+			md.cascades = append(md.cascades, col)
+		}
 		if col.PrimaryKey {
+			if col.PrimaryKeyOrder < 0 {
+				return nil, fmt.Errorf("entity %q, primary key %q invalid order", md.Type, col.DBField)
+			}
 			md.PrimaryKeys = append(md.PrimaryKeys, col)
 		}
 	}
 
 	if len(md.PrimaryKeys) == 0 {
 		return nil, fmt.Errorf("undefined entity %q primary key", md.Type)
+	} else if len(md.cascades) > 0 && md.softDelete == nil {
+		return nil, fmt.Errorf("entity %q, cascade_delete requires softdelete column", md.Type)
+	} else if err := sortPrimaryKeys(md.PrimaryKeys); err != nil {
+		return nil, fmt.Errorf("entity %q, %w", md.Type, err)
+	}
+
+	md.hasEmbeddedPtr = hasEmbeddedPtr(md)
+
+	if strictMode {
+		if err := validateMetadata(md); err != nil {
+			return nil, fmt.Errorf("entity %q, %w", md.Type, err)
+		}
 	}
 
 	return md, nil
 }
 
+// SetStrictMode 严格模式下，首次使用entity时会对元数据做完整性检查，尽早发现配置错误
+func SetStrictMode(strict bool) {
+	strictMode = strict
+}
+
+func validateMetadata(md *Metadata) error {
+	if len(md.PrimaryKeys) == 0 {
+		return fmt.Errorf("undefined primary key")
+	}
+
+	columns := map[string]bool{}
+	for _, col := range md.Columns {
+		columns[col.DBField] = true
+	}
+	for _, col := range md.PrimaryKeys {
+		if !columns[col.DBField] {
+			return fmt.Errorf("primary key %q not found in columns", col.DBField)
+		}
+	}
+
+	return nil
+}
+
+// 检查数据库是否支持entity声明的RETURNING字段
+func validateReturning(md *Metadata, driver string) error {
+	return checkReturning(md, driver, md.hasReturningInsert || md.hasReturningUpdate)
+}
+
+// FieldColumnMap 返回entity的struct属性名与数据库字段名的对应关系
+func FieldColumnMap(ent Entity) (map[string]string, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(md.Columns))
+	for _, col := range md.Columns {
+		result[col.StructField] = col.DBField
+	}
+	return result, nil
+}
+
+// ColumnFieldMap 返回entity的数据库字段名与struct属性名的对应关系，包含冗余字段
+func ColumnFieldMap(ent Entity) (map[string]string, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(md.Columns))
+	for _, col := range md.Columns {
+		result[col.DBField] = col.StructField
+		for _, name := range col.Mirrors {
+			result[name] = col.StructField
+		}
+	}
+	return result, nil
+}
+
+// 构造T类型的空entity，T为指针类型时会分配内存
+func newEntity[T Entity]() T {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface().(T)
+	}
+	return reflect.New(t).Elem().Interface().(T)
+}
+
+// CloneForInsert 复制entity，并清空自增主键、插入时由数据库生成的字段以及软删除和版本号字段，复制结果可以直接作为新记录插入
+// 复制是浅拷贝，指针、slice、map等类型的属性与原对象共享数据，
+// 但是被清空字段所在的嵌入struct指针会重新分配，清空时不会影响原对象
+func CloneForInsert[T Entity](src T) T {
+	sv := reflect.ValueOf(src)
+	if sv.Kind() == reflect.Ptr && sv.IsNil() {
+		return src
+	}
+
+	dst := reflect.New(reflect.Indirect(sv).Type())
+	dst.Elem().Set(reflect.Indirect(sv))
+
+	if md, err := getMetadata(src); err == nil {
+		for _, col := range md.Columns {
+			if col.AutoIncrement || col.ReturningInsert || col.SoftDelete || col.Version {
+				if f, ok := unshareField(dst.Elem(), col.DBField); ok {
+					f.Set(reflect.Zero(f.Type()))
+				}
+			}
+		}
+	}
+
+	if sv.Kind() == reflect.Ptr {
+		return dst.Interface().(T)
+	}
+	return dst.Elem().Interface().(T)
+}
+
 func getMetadata(ent Entity) (*Metadata, error) {
 	t := reflectx.Deref(reflect.TypeOf(ent))
 
@@ -142,12 +544,20 @@ func getColumns(ent Entity) []Column { // revive:disable-line
 		col := Column{
 			StructField: fi.Field.Name,
 			DBField:     fi.Name,
+			Inet:        inetType(fi.Field.Type),
 		}
 
 		for key := range fi.Options {
 			if key == "primaryKey" || key == "primary_key" {
 				col.PrimaryKey = true
 				col.RefuseUpdate = true
+				if v := fi.Options[key]; v != "" {
+					if n, err := strconv.Atoi(v); err == nil && n > 0 {
+						col.PrimaryKeyOrder = n
+					} else {
+						col.PrimaryKeyOrder = -1
+					}
+				}
 			} else if key == "refuseUpdate" || key == "refuse_update" {
 				col.RefuseUpdate = true
 			} else if key == "returning" {
@@ -162,6 +572,52 @@ func getColumns(ent Entity) []Column { // revive:disable-line
 			} else if key == "autoIncrement" || key == "auto_increment" {
 				col.AutoIncrement = true
 				col.RefuseUpdate = true
+			} else if key == "nullableKey" || key == "nullable_key" {
+				col.NullableKey = true
+			} else if key == "size" {
+				if n, err := strconv.Atoi(fi.Options[key]); err == nil && n > 0 {
+					col.Size = n
+				} else {
+					col.Size = -1
+				}
+			} else if key == "mirror" {
+				col.Mirrors = strings.Split(fi.Options[key], "|")
+			} else if key == "nullPolicy" || key == "null_policy" {
+				col.NullPolicy = fi.Options[key]
+			} else if key == "fkEnum" || key == "fk_enum" {
+				col.FKEnum = fi.Options[key]
+			} else if key == "pgenum" {
+				col.PGEnum = fi.Options[key]
+			} else if key == "normalize" {
+				col.Normalize = fi.Options[key]
+			} else if key == "codec" {
+				col.Codec = fi.Options[key]
+			} else if key == "scan" {
+				col.Converter = fi.Options[key]
+			} else if key == "generated" {
+				col.Generated = fi.Options[key]
+				col.RefuseUpdate = true
+			} else if key == "stored" {
+				col.GeneratedStored = true
+			} else if key == "version" {
+				col.Version = true
+			} else if key == "created" {
+				col.Created = true
+				col.RefuseUpdate = true
+			} else if key == "updated" {
+				col.Updated = true
+			} else if key == "softdelete" || key == "soft_delete" {
+				col.SoftDelete = true
+				col.RefuseUpdate = true
+			}
+		}
+
+		for _, opt := range strings.Split(fi.Field.Tag.Get("entity"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			if key == "cascade_delete" || key == "cascadeDelete" {
+				col.CascadeDelete = value
+			} else if key == "fk" {
+				col.CascadeFK = value
 			}
 		}
 		cols = append(cols, col)
@@ -170,6 +626,288 @@ func getColumns(ent Entity) []Column { // revive:disable-line
 	return cols
 }
 
+// 按照primaryKey=N指定的顺序排列主键，没有指定顺序的主键按照声明顺序排在后面
+// 查询条件的字段顺序与索引一致，不依赖struct字段的声明顺序
+func sortPrimaryKeys(keys []Column) error {
+	orders := map[int]string{}
+	for _, col := range keys {
+		if col.PrimaryKeyOrder == 0 {
+			continue
+		} else if name, ok := orders[col.PrimaryKeyOrder]; ok {
+			return fmt.Errorf("primary key %q and %q have the same order %d", name, col.DBField, col.PrimaryKeyOrder)
+		}
+		orders[col.PrimaryKeyOrder] = col.DBField
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i].PrimaryKeyOrder, keys[j].PrimaryKeyOrder
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+	return nil
+}
+
+// 检查冗余字段名，不允许为空或者与其它字段重复
+func checkMirrors(cols []Column) error {
+	names := map[string]bool{}
+	for _, col := range cols {
+		names[col.DBField] = true
+	}
+
+	for _, col := range cols {
+		for _, name := range col.Mirrors {
+			if name == "" {
+				return fmt.Errorf("column %q has empty mirror", col.DBField)
+			} else if names[name] {
+				return fmt.Errorf("column %q mirror %q duplicated", col.DBField, name)
+			}
+			names[name] = true
+		}
+	}
+	return nil
+}
+
+// 更新成功之后，entity的版本号字段加1，与数据库内的版本号保持一致
+func incrVersion(ent Entity, md *Metadata) {
+	if !md.hasVersion {
+		return
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, col := range md.Columns {
+		if !col.Version {
+			continue
+		}
+
+		f := reflect.Indirect(mapper.FieldByName(v, col.DBField))
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f.SetInt(f.Int() + 1)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f.SetUint(f.Uint() + 1)
+		}
+	}
+}
+
+// 写入之前填充创建时间及更新时间字段，insert为false时只填充更新时间
+func touchTimestamps(ent Entity, md *Metadata, insert bool) {
+	if md.created == nil && md.updated == nil {
+		return
+	}
+
+	now := nowFunc()
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	if insert && md.created != nil {
+		setTime(mapper.FieldByName(v, md.created.DBField), now)
+	}
+	if md.updated != nil {
+		setTime(mapper.FieldByName(v, md.updated.DBField), now)
+	}
+}
+
+func setTime(f reflect.Value, t time.Time) {
+	if f.Kind() == reflect.Ptr {
+		f.Set(reflect.ValueOf(&t))
+	} else {
+		f.Set(reflect.ValueOf(t))
+	}
+}
+
+// 写入数据库之前规范化并检查entity数据
+func checkValues(ent Entity, md *Metadata) error {
+	normalizeValues(ent, md)
+
+	if !md.hasSizeLimit {
+		return nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, col := range md.Columns {
+		if col.Size == 0 {
+			continue
+		}
+
+		s, ok := stringValue(mapper.FieldByName(v, col.DBField))
+		if ok && utf8.RuneCountInString(s) > col.Size {
+			return fmt.Errorf("column %q exceeds size %d, %w", col.DBField, col.Size, ErrValueTooLong)
+		}
+	}
+	return nil
+}
+
+// 字段是否位于嵌入的结构体指针内
+func hasEmbeddedPtr(md *Metadata) bool {
+	sm := mapper.TypeMap(md.Type)
+	for _, col := range md.Columns {
+		fi, ok := sm.Names[col.DBField]
+		if !ok {
+			continue
+		}
+
+		t := md.Type
+		for _, i := range fi.Index[:len(fi.Index)-1] {
+			ft := t.Field(i).Type
+			if ft.Kind() == reflect.Ptr {
+				return true
+			}
+			t = ft
+		}
+	}
+	return false
+}
+
+// 为nil的嵌入结构体指针分配内存，否则绑定参数时会panic，读取的数据也无法写入
+func allocEmbedded(ent Entity, md *Metadata) {
+	if !md.hasEmbeddedPtr {
+		return
+	}
+
+	// FieldByName会自动分配路径上为nil的指针
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, col := range md.Columns {
+		mapper.FieldByName(v, col.DBField)
+	}
+}
+
+// 按照字段的nullPolicy处理零值，返回插入时使用的元数据以及参数
+// 使用omit的零值字段不会出现在返回的元数据内，插入时使用数据库默认值
+func nullPolicyValues(ent Entity, md *Metadata) (*Metadata, map[string]interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(ent))
+
+	omd := *md
+	omd.Columns = make([]Column, 0, len(md.Columns))
+	args := make(map[string]interface{}, len(md.Columns))
+
+	for _, col := range md.Columns {
+		f := mapper.FieldByName(v, col.DBField)
+
+		if f.IsZero() {
+			switch col.NullPolicy {
+			case NullPolicyOmit:
+				continue
+			case NullPolicyNull:
+				omd.Columns = append(omd.Columns, col)
+				args[col.DBField] = nil
+				continue
+			}
+		}
+
+		omd.Columns = append(omd.Columns, col)
+		args[col.DBField] = f.Interface()
+	}
+
+	return &omd, args
+}
+
+// 按照normalize设置修改entity的字符串字段，只处理string及*string类型
+func normalizeValues(ent Entity, md *Metadata) {
+	if !md.hasNormalize {
+		return
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, col := range md.Columns {
+		if col.Normalize == "" {
+			continue
+		}
+
+		f := mapper.FieldByName(v, col.DBField)
+		if f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				continue
+			}
+			f = f.Elem()
+		}
+		if f.Kind() != reflect.String {
+			continue
+		}
+
+		s := f.String()
+		switch col.Normalize {
+		case NormalizeLower:
+			s = strings.ToLower(s)
+		case NormalizeTrim:
+			s = strings.TrimSpace(s)
+		case NormalizeLowerTrim:
+			s = strings.ToLower(strings.TrimSpace(s))
+		}
+		f.SetString(s)
+	}
+}
+
+// 只读方式取出字段，不会像mapper.FieldByName那样给nil指针分配对象
+// 字段位于值为nil的嵌入结构体指针内时返回false
+func readField(v reflect.Value, name string) (reflect.Value, bool) {
+	fi, ok := mapper.TypeMap(v.Type()).Names[name]
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	for _, i := range fi.Index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// 与readField相同，但是路径上的嵌入struct指针会复制一份新的再写回，修改返回的字段不会影响共享指针的其它对象
+// 指针为nil时字段不存在，不需要分配
+func unshareField(v reflect.Value, name string) (reflect.Value, bool) {
+	fi, ok := mapper.TypeMap(v.Type()).Names[name]
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	for _, i := range fi.Index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+
+			cp := reflect.New(v.Type().Elem())
+			cp.Elem().Set(v.Elem())
+			v.Set(cp)
+			v = cp.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// 取出字段的字符串内容，支持string、*string以及返回字符串的driver.Valuer，例如sql.NullString
+func stringValue(f reflect.Value) (string, bool) {
+	if f.Kind() == reflect.Ptr && f.IsNil() {
+		return "", false
+	}
+
+	if v, ok := f.Interface().(driver.Valuer); ok {
+		dv, err := v.Value()
+		if err != nil {
+			return "", false
+		}
+
+		switch s := dv.(type) {
+		case string:
+			return s, true
+		case []byte:
+			return string(s), true
+		}
+		return "", false
+	}
+
+	if f = reflect.Indirect(f); f.Kind() == reflect.String {
+		return f.String(), true
+	}
+	return "", false
+}
+
 // 从反射信息内，解析字段属性
 func getFields(node *reflectx.FieldInfo) []*reflectx.FieldInfo {
 	fields := []*reflectx.FieldInfo{}
@@ -187,19 +925,60 @@ func getFields(node *reflectx.FieldInfo) []*reflectx.FieldInfo {
 
 	// root node
 	if node.Parent == nil {
-		// replace duplicate name
-		filter := map[string]*reflectx.FieldInfo{}
+		// replace duplicate name，保持字段首次出现的顺序，生成的语句才是稳定的
+		index := map[string]int{}
+		result := make([]*reflectx.FieldInfo, 0, len(fields))
 		for _, v := range fields {
-			filter[v.Name] = v
+			if i, ok := index[v.Name]; ok {
+				result[i] = v
+			} else {
+				index[v.Name] = len(result)
+				result = append(result, v)
+			}
+		}
+		fields = result
+	}
+
+	return fields
+}
+
+// 检查重复声明的字段名，通常是嵌入的struct与外层struct声明了相同的字段
+// 返回的错误包含重复的字段名以及声明它们的struct字段，例如"name" declared by Base.Name, Name
+func checkDuplicateFields(node *reflectx.FieldInfo) error {
+	fields := map[string][]string{}
+
+	var walk func(node *reflectx.FieldInfo, prefix string)
+	walk = func(node *reflectx.FieldInfo, prefix string) {
+		for _, fi := range node.Children {
+			if fi == nil {
+				continue
+			}
+
+			if fi.Embedded {
+				walk(fi, prefix+fi.Field.Name+".")
+			} else {
+				fields[fi.Name] = append(fields[fi.Name], prefix+fi.Field.Name)
+			}
 		}
+	}
+	walk(node, "")
 
-		fields = fields[:0]
-		for _, v := range filter {
-			fields = append(fields, v)
+	names := []string{}
+	for name, declared := range fields {
+		if len(declared) > 1 {
+			names = append(names, name)
 		}
 	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
 
-	return fields
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%q declared by %s", name, strings.Join(fields[name], ", ")))
+	}
+	return fmt.Errorf("duplicate columns, %s", strings.Join(msgs, "; "))
 }
 
 // Load 从数据库载入entity
@@ -207,7 +986,24 @@ func Load(ctx context.Context, ent Entity, db DB) error {
 	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
 	defer cancel()
 
+	if err := loadWithCache(ctx, ent, db); err != nil {
+		return err
+	}
+
+	if err := ent.OnEntityEvent(ctx, EventAfterLoad); err != nil {
+		return fmt.Errorf("after load, %w", err)
+	}
+	return nil
+}
+
+func loadWithCache(ctx context.Context, ent Entity, db DB) error {
 	cv, cacheable := ent.(Cacheable)
+	// 缓存的记录不一定满足当前ctx的默认条件，例如其它租户读取后缓存的数据，有默认条件时不读也不写缓存
+	// 字段限制下缓存的完整记录会泄露不允许读取的字段，部分读取的结果也不能写入缓存
+	if cacheable && (hasDefaultScope(ctx, ent) || hasColumnMask(ctx)) {
+		cacheable = false
+	}
+
 	if cacheable {
 		if loaded, err := loadCache(cv); err != nil {
 			return fmt.Errorf("load from cache, %w", err)
@@ -236,16 +1032,24 @@ func Insert(ctx context.Context, ent Entity, db DB) (int64, error) {
 
 	if err := ent.OnEntityEvent(ctx, EventBeforeInsert); err != nil {
 		return 0, fmt.Errorf("before insert, %w", err)
+	} else if err := validate(ent); err != nil {
+		return 0, err
 	}
 
 	lastID, err := doInsert(ctx, ent, db)
 	if err != nil {
-		if isConflictError(db, err) {
-			return 0, ErrConflict
+		if oc, ok := ent.(OnConflicter); ok && errors.Is(err, ErrConflict) {
+			return 0, oc.OnConflict(ctx, db)
 		}
 		return 0, err
 	}
 
+	if ir, ok := ent.(InsertReloader); ok && ir.ReloadAfterInsert() {
+		if err := reloadAfterInsert(ctx, ent, db); err != nil {
+			return 0, fmt.Errorf("reload after insert, %w", err)
+		}
+	}
+
 	if err := ent.OnEntityEvent(ctx, EventAfterInsert); err != nil {
 		return 0, fmt.Errorf("after insert, %w", err)
 	}
@@ -253,16 +1057,163 @@ func Insert(ctx context.Context, ent Entity, db DB) (int64, error) {
 	return lastID, nil
 }
 
+// 插入时已经通过RETURNING取回了数据库生成的字段，不需要重新读取
+func reloadAfterInsert(ctx context.Context, ent Entity, db DB) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	} else if insertReturning(md, dbDriver(db)) {
+		return nil
+	}
+	return doLoad(ctx, ent, db)
+}
+
+// InsertLinked 插入entity，然后使用新记录的主键插入一条关联记录，两条语句在同一个事务内执行
+// linkFn根据新记录的主键，返回关联记录的表名以及字段值
+// db是*sqlx.DB时会自动开启事务，否则认为db已经是事务
+// 自增主键使用新记录的自增ID，postgresql需要把主键声明为returningInsert才能拿到，非自增主键使用entity上的值
+func InsertLinked(ctx context.Context, ent Entity, db DB, linkFn func(id interface{}) (table string, cols map[string]interface{})) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	} else if len(md.PrimaryKeys) != 1 {
+		return fmt.Errorf("entity %q, linked insert requires single primary key", md.Type)
+	}
+
+	fn := func(db DB) error {
+		lastID, err := Insert(ctx, ent, db)
+		if err != nil {
+			return err
+		}
+
+		// 只有自增主键才使用lastID，sqlite对非自增主键同样返回rowid
+		var id interface{} = lastID
+		if pk := md.PrimaryKeys[0]; !pk.AutoIncrement || lastID == 0 {
+			f, _ := readField(reflect.ValueOf(ent), pk.DBField)
+			id = f.Interface()
+		}
+
+		table, cols := linkFn(id)
+		if len(cols) == 0 {
+			return fmt.Errorf("empty linked columns")
+		}
+
+		_, err = namedExec(ctx, db, insertMapStatement(table, cols, dbDriver(db)), cols)
+		return err
+	}
+
+	if v, ok := db.(*sqlx.DB); ok {
+		return Transaction(v, func(tx *sqlx.Tx) error {
+			return fn(tx)
+		})
+	}
+	return fn(db)
+}
+
+// InsertUnless 表内不存在符合条件的记录时才插入entity，不依赖唯一索引实现有条件的插入
+// where条件使用?作为参数占位符，inserted表示是否插入了新记录
+func InsertUnless(ctx context.Context, ent Entity, db DB, where string, args ...interface{}) (inserted bool, err error) {
+	if strings.TrimSpace(where) == "" {
+		return false, fmt.Errorf("empty where condition")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	if err := ent.OnEntityEvent(ctx, EventBeforeInsert); err != nil {
+		return false, fmt.Errorf("before insert, %w", err)
+	} else if err := validate(ent); err != nil {
+		return false, err
+	}
+
+	inserted, err = doInsertUnless(ctx, ent, db, where, args)
+	if err != nil {
+		return false, err
+	} else if !inserted {
+		return false, nil
+	}
+
+	if err := ent.OnEntityEvent(ctx, EventAfterInsert); err != nil {
+		return true, fmt.Errorf("after insert, %w", err)
+	}
+
+	return true, nil
+}
+
 // Update 更新entity
 func Update(ctx context.Context, ent Entity, db DB) error {
+	return update(ctx, ent, db, func(ctx context.Context) error {
+		return doUpdate(ctx, ent, db)
+	})
+}
+
+// Save 保存entity，新记录插入，已有记录更新
+// 默认根据主键判断，所有主键字段都是零值时插入，否则更新，自增主键插入后会写回entity
+// 自然主键无法根据零值判断，更新不存在的记录会返回sql.ErrNoRows，这种entity应该实现SaveChecker，先查询记录是否存在
+func Save(ctx context.Context, ent Entity, db DB) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	var exists bool
+	if sc, ok := ent.(SaveChecker); ok && sc.SaveCheckExists() {
+		if exists, err = Exists(ctx, ent, db); err != nil {
+			return fmt.Errorf("check exists, %w", err)
+		}
+	} else {
+		exists = !zeroPrimaryKeys(ent, md)
+	}
+
+	if exists {
+		return Update(ctx, ent, db)
+	}
+
+	lastID, err := Insert(ctx, ent, db)
+	if err != nil {
+		return err
+	} else if lastID > 0 && autoIncrementID(ent, md) == 0 {
+		setAutoIncrement(ent, md, lastID)
+	}
+	return nil
+}
+
+// 所有主键字段是否都是零值
+func zeroPrimaryKeys(ent Entity, md *Metadata) bool {
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, col := range md.PrimaryKeys {
+		if f, ok := readField(v, col.DBField); ok && !f.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateReturningExtra 更新entity，RETURNING子句除了entity本身的returningUpdate字段之外，还会返回extras指定的字段或表达式
+// entity字段写回entity，其它字段按照db tag写入extraDest，extraDest必须是struct指针
+// extras必须是"expr AS name"形式，name在extraDest内没有对应字段时不会执行更新
+// 例如 UpdateReturningExtra(ctx, order, db, &result, "(SELECT SUM(amount) FROM orders) AS total")
+func UpdateReturningExtra(ctx context.Context, ent Entity, db DB, extraDest interface{}, extras ...string) error {
+	if len(extras) == 0 {
+		return fmt.Errorf("empty extra returning columns")
+	}
+
+	return update(ctx, ent, db, func(ctx context.Context) error {
+		return doUpdateReturningExtra(ctx, ent, db, extraDest, extras)
+	})
+}
+
+func update(ctx context.Context, ent Entity, db DB, fn func(ctx context.Context) error) error {
 	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
 	defer cancel()
 
 	if err := ent.OnEntityEvent(ctx, EventBeforeUpdate); err != nil {
 		return fmt.Errorf("before update, %w", err)
+	} else if err := validate(ent); err != nil {
+		return err
 	}
 
-	if err := doUpdate(ctx, ent, db); err != nil {
+	if err := fn(ctx); err != nil {
 		return err
 	}
 
@@ -278,7 +1229,9 @@ func Update(ctx context.Context, ent Entity, db DB) error {
 	return nil
 }
 
-// Delete 删除entity
+// Delete 删除entity，有softdelete字段时写入删除时间
+// 声明了cascade_delete的entity，软删除时在同一个事务内一并软删除子表内关联的记录，任何一步失败都会回滚
+// db是*sqlx.DB时会自动开启事务，否则认为db已经是事务
 func Delete(ctx context.Context, ent Entity, db DB) error {
 	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
 	defer cancel()
@@ -303,14 +1256,43 @@ func Delete(ctx context.Context, ent Entity, db DB) error {
 	return nil
 }
 
-// Transaction 执行事务过程，根据结果选择提交或回滚
-func Transaction(db *sqlx.DB, fn func(tx *sqlx.Tx) error) (err error) {
-	tx, err := db.Beginx()
+// Transaction 执行事务过程，根据结果选择提交或回滚，fn发生panic时回滚后继续panic
+func Transaction(db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	return runTx(context.Background(), db, nil, fn)
+}
+
+// RunInTx 在事务内执行fn，fn返回nil时提交，返回错误时回滚，发生panic时回滚后继续panic
+// opts可以指定事务的隔离级别以及只读，ctx结束时事务会被回滚
+//
+//	err := entity.RunInTx(ctx, db, func(tx entity.DB) error {
+//		if _, err := entity.Insert(ctx, order, tx); err != nil {
+//			return err
+//		}
+//		return entity.Update(ctx, stock, tx)
+//	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+func RunInTx(ctx context.Context, db *sqlx.DB, fn func(tx DB) error, opts ...*sql.TxOptions) error {
+	var opt *sql.TxOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	return runTx(ctx, db, opt, func(tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
+
+func runTx(ctx context.Context, db *sqlx.DB, opt *sql.TxOptions, fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, opt)
 	if err != nil {
 		return fmt.Errorf("begin transaction, %w", err)
 	}
 
 	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+
 		if err == nil {
 			if txErr := tx.Commit(); txErr != nil {
 				err = fmt.Errorf("commit transaction, %w", txErr)
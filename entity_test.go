@@ -2,11 +2,19 @@ package entity
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/reflectx"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMetadata(t *testing.T) {
@@ -34,6 +42,112 @@ func TestMetadata(t *testing.T) {
 	}
 }
 
+func TestStrictMode(t *testing.T) {
+	SetStrictMode(true)
+	defer SetStrictMode(false)
+
+	t.Run("duplicate column", func(t *testing.T) {
+		_, err := NewMetadata(&DuplicateColumnEntity{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `"name"`)
+
+		// 字段名冲突与严格模式无关
+		SetStrictMode(false)
+		defer SetStrictMode(true)
+
+		_, err = NewMetadata(&DuplicateColumnEntity{})
+		require.Error(t, err)
+	})
+
+	t.Run("primary key", func(t *testing.T) {
+		_, err := NewMetadata(&NoPrimaryKeyEntity{})
+		require.Error(t, err)
+
+		md := &Metadata{
+			Columns:     []Column{{DBField: "name"}},
+			PrimaryKeys: []Column{{DBField: "id", PrimaryKey: true}},
+		}
+		require.Error(t, validateMetadata(md))
+
+		md.PrimaryKeys = nil
+		require.Error(t, validateMetadata(md))
+	})
+
+	t.Run("returning", func(t *testing.T) {
+		md, err := NewMetadata(&GenernalEntity{})
+		require.NoError(t, err)
+
+		require.Error(t, validateReturning(md, driverMysql))
+		require.NoError(t, validateReturning(md, driverPostgres))
+		require.NoError(t, validateReturning(md, driverSqlite3))
+
+		md, err = NewMetadata(&DuplicateColumnBase{})
+		require.NoError(t, err)
+		require.NoError(t, validateReturning(md, driverMysql))
+	})
+}
+
+func TestFieldColumnMap(t *testing.T) {
+	fields, err := FieldColumnMap(&GenernalEntity{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"ID":       "id",
+		"ID2":      "id2",
+		"Name":     "name",
+		"CreateAt": "create_at",
+		"Version":  "version",
+		"Extra":    "extra",
+	}, fields)
+
+	columns, err := ColumnFieldMap(&MirrorEntity{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"id":         "ID",
+		"email":      "Email",
+		"email_copy": "Email",
+	}, columns)
+
+	_, err = FieldColumnMap(&EmptyEntity{})
+	require.Error(t, err)
+}
+
+func TestCloneForInsert(t *testing.T) {
+	src := &GenernalEntity{
+		ID:       1,
+		ID2:      2,
+		Name:     "foo",
+		CreateAt: time.Now(),
+		Version:  3,
+		Extra:    TestExtra{E1: "bar", E2: 4},
+	}
+
+	dst := CloneForInsert(src)
+	require.True(t, src != dst)
+	require.Equal(t, GenernalEntity{ID2: 2, Name: "foo", Extra: TestExtra{E1: "bar", E2: 4}}, *dst)
+	require.Equal(t, 1, src.ID)
+
+	v := CloneForInsert(GenernalEntity{ID: 1, Name: "foo"})
+	require.Equal(t, GenernalEntity{Name: "foo"}, v)
+
+	// 嵌入struct指针重新分配，清空字段不影响原对象
+	base := &EmbeddedPtrBase{Name: "foo", CreateAt: "2020-01-01"}
+	ep := CloneForInsert(&EmbeddedPtrEntity{ID: 1, EmbeddedPtrBase: base})
+	require.True(t, ep.EmbeddedPtrBase != base)
+	require.Equal(t, EmbeddedPtrBase{Name: "foo"}, *ep.EmbeddedPtrBase)
+	require.Equal(t, "2020-01-01", base.CreateAt)
+
+	ep = CloneForInsert(&EmbeddedPtrEntity{ID: 1})
+	require.Nil(t, ep.EmbeddedPtrBase)
+
+	// 软删除和版本号字段同样清空
+	now := time.Now()
+	sd := CloneForInsert(&SoftDeleteEntity{ID: 1, Name: "foo", DeletedAt: &now})
+	require.Equal(t, SoftDeleteEntity{Name: "foo"}, *sd)
+
+	ve := CloneForInsert(&VersionEntity{ID: 1, Name: "foo", Version: 3})
+	require.Equal(t, VersionEntity{Name: "foo"}, *ve)
+}
+
 func TestColumns(t *testing.T) {
 	cases := map[string]struct {
 		primaryKey      bool
@@ -154,6 +268,719 @@ func TestFields(t *testing.T) {
 	}
 }
 
+func TestMirror(t *testing.T) {
+	_, err := NewMetadata(&BadMirrorEntity{})
+	if err == nil {
+		t.Fatalf(`BadMirrorEntity metadata, Expected="mirror duplicated", Actual=nil`)
+	}
+
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NotZero(t, ent.ID)
+
+	var copied string
+	require.NoError(t, db.Get(&copied, `SELECT email_copy FROM mirror WHERE id = ?`, ent.ID))
+	require.Equal(t, "foo@example.com", copied)
+
+	ent.Email = "bar@example.com"
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, db.Get(&copied, `SELECT email_copy FROM mirror WHERE id = ?`, ent.ID))
+	require.Equal(t, "bar@example.com", copied)
+
+	loaded := &MirrorEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, "bar@example.com", loaded.Email)
+}
+
+func TestNullableKey(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE nullable_key (code TEXT NOT NULL, region TEXT, name TEXT)`,
+		`INSERT INTO nullable_key (code, region, name) VALUES ('a', NULL, 'foo'), ('a', 'cn', 'bar')`,
+	)
+	ctx := context.Background()
+
+	ent := &NullableKeyEntity{Code: "a"}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo", ent.Name)
+
+	ent = &NullableKeyEntity{Code: "a", Region: sql.NullString{String: "cn", Valid: true}}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "bar", ent.Name)
+}
+
+func TestPrimaryKeyOrder(t *testing.T) {
+	md, err := NewMetadata(&OrderedKeyEntity{})
+	require.NoError(t, err)
+	// 指定了顺序的主键在前，其余按照声明顺序
+	require.Equal(t, []string{"tenant_id", "order_id", "line"}, columnNames(md.PrimaryKeys))
+	require.Equal(t, `SELECT "line", "order_id", "tenant_id", "amount" FROM "ordered_key" WHERE "tenant_id" = :tenant_id AND "order_id" = :order_id AND "line" = :line LIMIT 1`,
+		selectStatement(&OrderedKeyEntity{}, md, driverSqlite3))
+
+	md, err = NewMetadata(&NullableKeyEntity{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"code", "region"}, columnNames(md.PrimaryKeys))
+
+	_, err = NewMetadata(&BadKeyOrderEntity{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "same order")
+}
+
+func TestScanDest(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE scan_dest (id INTEGER PRIMARY KEY, name TEXT)`,
+		`INSERT INTO scan_dest (id, name) VALUES (1, 'foo')`,
+	)
+
+	ent := &ScanDestEntity{ID: 1}
+	require.NoError(t, Load(context.Background(), ent, db))
+	require.Equal(t, "FOO", ent.Name)
+	require.ElementsMatch(t, []string{"id", "name"}, ent.scanned)
+}
+
+func TestInsertUnless(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	inserted, err := InsertUnless(ctx, ent, db, "email = ?", ent.Email)
+	require.NoError(t, err)
+	require.True(t, inserted)
+	require.NotZero(t, ent.ID)
+
+	ent = &MirrorEntity{Email: "foo@example.com"}
+	inserted, err = InsertUnless(ctx, ent, db, "email = ?", ent.Email)
+	require.NoError(t, err)
+	require.False(t, inserted)
+	require.Zero(t, ent.ID)
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM mirror`))
+	require.Equal(t, 1, n)
+
+	_, err = InsertUnless(ctx, ent, db, "")
+	require.Error(t, err)
+}
+
+func TestUpdateReturningExtra(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE returning_extra (id INTEGER PRIMARY KEY, amount INTEGER, version INTEGER DEFAULT 3)`,
+		`INSERT INTO returning_extra (id, amount) VALUES (1, 10), (2, 20)`,
+	)
+
+	var result struct {
+		Total int `db:"total"`
+	}
+
+	ent := &ReturningExtraEntity{ID: 1, Amount: 15}
+	err := UpdateReturningExtra(context.Background(), ent, db, &result, "(SELECT SUM(amount) FROM returning_extra) AS total")
+	require.NoError(t, err)
+	require.Equal(t, 35, result.Total)
+	require.Equal(t, 3, ent.Version)
+
+	// extras无法写回时，在执行之前返回错误，记录不会被更新
+	ent.Amount = 99
+	for _, extra := range []string{"1 AS unknown", "1", "SUM(amount)", "CAST(amount AS total)", " AS total"} {
+		err = UpdateReturningExtra(context.Background(), ent, db, &result, "1 AS total", extra)
+		require.Error(t, err, extra)
+
+		var amount int
+		require.NoError(t, db.Get(&amount, `SELECT amount FROM returning_extra WHERE id = 1`))
+		require.Equal(t, 15, amount, extra)
+	}
+
+	err = UpdateReturningExtra(context.Background(), ent, db, result, "1 AS total")
+	require.Error(t, err)
+}
+
+func TestValueTooLong(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE sized (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT)`)
+	ctx := context.Background()
+
+	ent := &SizedEntity{ID: 1, Name: "中文名字", Nickname: sql.NullString{String: "foo", Valid: true}}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	ent.Name = "中文名字太长"
+	err = Update(ctx, ent, db)
+	require.True(t, errors.Is(err, ErrValueTooLong))
+	require.Contains(t, err.Error(), `"name"`)
+
+	ent = &SizedEntity{ID: 2, Name: "foo", Nickname: sql.NullString{String: "foobar", Valid: true}}
+	_, err = Insert(ctx, ent, db)
+	require.True(t, errors.Is(err, ErrValueTooLong))
+	require.Contains(t, err.Error(), `"nickname"`)
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM sized`))
+	require.Equal(t, 1, n)
+
+	_, err = NewMetadata(&BadSizeEntity{})
+	require.Error(t, err)
+}
+
+func TestNullPolicy(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE null_policy (
+		id INTEGER PRIMARY KEY,
+		as_null TEXT DEFAULT 'default',
+		as_zero TEXT DEFAULT 'default',
+		as_omit TEXT DEFAULT 'default'
+	)`)
+	ctx := context.Background()
+
+	type row struct {
+		AsNull sql.NullString `db:"as_null"`
+		AsZero sql.NullString `db:"as_zero"`
+		AsOmit sql.NullString `db:"as_omit"`
+	}
+
+	_, err := Insert(ctx, &NullPolicyEntity{ID: 1}, db)
+	require.NoError(t, err)
+
+	var r row
+	require.NoError(t, db.Get(&r, `SELECT as_null, as_zero, as_omit FROM null_policy WHERE id = 1`))
+	require.False(t, r.AsNull.Valid)
+	require.Equal(t, sql.NullString{String: "", Valid: true}, r.AsZero)
+	require.Equal(t, sql.NullString{String: "default", Valid: true}, r.AsOmit)
+
+	_, err = Insert(ctx, &NullPolicyEntity{ID: 2, AsNull: "a", AsZero: "b", AsOmit: "c"}, db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Get(&r, `SELECT as_null, as_zero, as_omit FROM null_policy WHERE id = 2`))
+	require.Equal(t, "a", r.AsNull.String)
+	require.Equal(t, "b", r.AsZero.String)
+	require.Equal(t, "c", r.AsOmit.String)
+
+	_, err = NewMetadata(&BadNullPolicyEntity{})
+	require.Error(t, err)
+}
+
+func TestNormalize(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE normalize (
+		id INTEGER PRIMARY KEY,
+		email TEXT UNIQUE,
+		nickname TEXT
+	)`)
+	ctx := context.Background()
+
+	nickname := "  Foo  "
+	ent := &NormalizeEntity{Email: " Foo@Example.COM ", Nickname: &nickname}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.Equal(t, "foo@example.com", ent.Email)
+	require.Equal(t, "Foo", *ent.Nickname)
+
+	var email, nick string
+	require.NoError(t, db.QueryRow(`SELECT email, nickname FROM normalize WHERE id = ?`, ent.ID).Scan(&email, &nick))
+	require.Equal(t, "foo@example.com", email)
+	require.Equal(t, "Foo", nick)
+
+	_, err = Insert(ctx, &NormalizeEntity{Email: "FOO@example.com"}, db)
+	require.Error(t, err)
+
+	ent.Email = "\tBar@Example.com"
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, db.QueryRow(`SELECT email FROM normalize WHERE id = ?`, ent.ID).Scan(&email))
+	require.Equal(t, "bar@example.com", email)
+
+	_, err = NewMetadata(&BadNormalizeEntity{})
+	require.Error(t, err)
+}
+
+func TestGenerated(t *testing.T) {
+	md, err := newTestMetadata(&GeneratedEntity{})
+	require.NoError(t, err)
+
+	col, _ := md.Column("total")
+	require.Equal(t, "price*quantity", col.Generated)
+	require.True(t, col.GeneratedStored)
+	require.True(t, col.RefuseUpdate)
+
+	require.Equal(t, `INSERT INTO "generated" ("price", "quantity") VALUES (:price, :quantity) RETURNING "id"`, insertStatement(&GeneratedEntity{}, md, driverPostgres))
+	require.Equal(t, `UPDATE "generated" SET "price" = :price, "quantity" = :quantity WHERE "id" = :id`, updateStatement(&GeneratedEntity{}, md, driverPostgres))
+
+	db := newTestDB(t, `CREATE TABLE generated (
+		id INTEGER PRIMARY KEY,
+		price INTEGER,
+		quantity INTEGER,
+		total INTEGER GENERATED ALWAYS AS (price*quantity) STORED
+	)`)
+	ctx := context.Background()
+
+	ent := &GeneratedEntity{Price: 3, Quantity: 4, Total: 100}
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, 12, ent.Total)
+
+	ent.Quantity = 5
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, 15, ent.Total)
+
+	// 批量插入同样忽略生成字段
+	ent = &GeneratedEntity{Price: 2, Quantity: 2, Total: 100}
+	require.NoError(t, BatchInsert(ctx, []Entity{ent}, db))
+	require.NotZero(t, ent.ID)
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, 4, ent.Total)
+
+	_, err = NewMetadata(&BadGeneratedEntity{})
+	require.Error(t, err)
+}
+
+func TestVersion(t *testing.T) {
+	md, err := newTestMetadata(&VersionEntity{})
+	require.NoError(t, err)
+	require.Equal(t, `UPDATE "version" SET "name" = :name, "version" = "version" + 1 WHERE "id" = :id AND "version" = :version`, updateStatement(&VersionEntity{}, md, driverPostgres))
+
+	db := newTestDB(t, `CREATE TABLE version (id INTEGER PRIMARY KEY, name TEXT, version INTEGER)`)
+	ctx := context.Background()
+
+	ent := &VersionEntity{Name: "foo", Version: 1}
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	stale := &VersionEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, stale, db))
+
+	ent.Name = "bar"
+	require.NoError(t, Update(ctx, ent, db))
+	require.Equal(t, 2, ent.Version)
+
+	var version int
+	require.NoError(t, db.Get(&version, `SELECT version FROM version WHERE id = ?`, ent.ID))
+	require.Equal(t, 2, version)
+
+	// 其它操作已经修改了记录
+	stale.Name = "baz"
+	require.True(t, errors.Is(Update(ctx, stale, db), ErrVersionMismatch))
+	require.Equal(t, 1, stale.Version)
+
+	// 重新读取之后可以继续更新
+	require.NoError(t, Load(ctx, stale, db))
+	stale.Name = "baz"
+	require.NoError(t, Update(ctx, stale, db))
+	require.Equal(t, 3, stale.Version)
+
+	require.True(t, errors.Is(Update(ctx, &VersionEntity{ID: 100, Version: 1}, db), sql.ErrNoRows))
+
+	_, err = NewMetadata(&BadVersionEntity{})
+	require.Error(t, err)
+}
+
+func TestTimestamps(t *testing.T) {
+	defer func() { nowFunc = time.Now }()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	nowFunc = func() time.Time { return created }
+
+	md, err := newTestMetadata(&TimestampEntity{})
+	require.NoError(t, err)
+	require.Equal(t, `UPDATE "timestamp" SET "name" = :name, "update_at" = :update_at WHERE "id" = :id`, updateStatement(&TimestampEntity{}, md, driverPostgres))
+
+	db := newTestDB(t, `CREATE TABLE timestamp (id INTEGER PRIMARY KEY, name TEXT, create_at TIMESTAMP, update_at TIMESTAMP)`)
+	ctx := context.Background()
+
+	ent := &TimestampEntity{Name: "foo"}
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.True(t, created.Equal(ent.CreateAt))
+	require.NotNil(t, ent.UpdateAt)
+	require.True(t, created.Equal(*ent.UpdateAt))
+
+	updated := created.Add(time.Hour)
+	nowFunc = func() time.Time { return updated }
+
+	ent.Name = "bar"
+	require.NoError(t, Update(ctx, ent, db))
+	require.True(t, updated.Equal(*ent.UpdateAt))
+
+	loaded := &TimestampEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.True(t, created.Equal(loaded.CreateAt))
+	require.True(t, updated.Equal(*loaded.UpdateAt))
+
+	_, err = NewMetadata(&BadTimestampEntity{})
+	require.Error(t, err)
+}
+
+func TestOnConflicter(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE conflict (id INTEGER PRIMARY KEY, email TEXT UNIQUE, visits INTEGER)`)
+	ctx := context.Background()
+
+	ent := &ConflictEntity{Email: "foo@example.com", Visits: 1}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.False(t, ent.conflicted)
+
+	// 冲突时读取已有记录并合并
+	dup := &ConflictEntity{Email: "foo@example.com", Visits: 2}
+	_, err = Insert(ctx, dup, db)
+	require.NoError(t, err)
+	require.True(t, dup.conflicted)
+	require.Equal(t, ent.ID, dup.ID)
+	require.Equal(t, 3, dup.Visits)
+
+	var visits int
+	require.NoError(t, db.Get(&visits, `SELECT visits FROM conflict WHERE id = ?`, ent.ID))
+	require.Equal(t, 3, visits)
+
+	dup = &ConflictEntity{Email: "foo@example.com", failConflict: true}
+	_, err = Insert(ctx, dup, db)
+	require.Equal(t, errConflictHook, err)
+}
+
+func TestEmbeddedBase(t *testing.T) {
+	md, err := NewMetadata(&EmbeddedBaseEntity{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "create_at", "update_at", "email"}, columnNames(md.Columns))
+	require.Equal(t, []string{"id"}, columnNames(md.PrimaryKeys))
+
+	id, _ := md.Column("id")
+	require.True(t, id.AutoIncrement)
+	require.True(t, id.RefuseUpdate)
+	createAt, _ := md.Column("create_at")
+	require.True(t, createAt.Created)
+	require.True(t, createAt.RefuseUpdate)
+	updateAt, _ := md.Column("update_at")
+	require.True(t, updateAt.Updated)
+
+	_, err = NewMetadata(&DuplicateColumnEntity{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"name" declared by DuplicateColumnBase.Name, Name`)
+}
+
+func TestEmbeddedPtr(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE embedded_ptr (id INTEGER PRIMARY KEY, name TEXT, create_at TEXT DEFAULT 'now')`,
+		`INSERT INTO embedded_ptr (id, name) VALUES (1, 'foo')`,
+	)
+	ctx := context.Background()
+
+	ent := &EmbeddedPtrEntity{ID: 1}
+	require.NoError(t, Load(ctx, ent, db))
+	require.NotNil(t, ent.EmbeddedPtrBase)
+	require.Equal(t, "foo", ent.Name)
+	require.Equal(t, "now", ent.CreateAt)
+
+	ent = &EmbeddedPtrEntity{ID: 2}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NotNil(t, ent.EmbeddedPtrBase)
+	require.Equal(t, "now", ent.CreateAt)
+
+	ent = &EmbeddedPtrEntity{ID: 1}
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "", ent.Name)
+}
+
+func TestInsertLinked(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`CREATE TABLE mirror_log (mirror_id INTEGER NOT NULL, action TEXT NOT NULL)`,
+	)
+	ctx := context.Background()
+
+	link := func(id interface{}) (string, map[string]interface{}) {
+		return "mirror_log", map[string]interface{}{"mirror_id": id, "action": "create"}
+	}
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	require.NoError(t, InsertLinked(ctx, ent, db, link))
+
+	var linkedID int64
+	require.NoError(t, db.Get(&linkedID, `SELECT mirror_id FROM mirror_log`))
+	require.Equal(t, ent.ID, linkedID)
+
+	// 关联记录插入失败，整个事务回滚
+	err := InsertLinked(ctx, &MirrorEntity{Email: "bar@example.com"}, db, func(id interface{}) (string, map[string]interface{}) {
+		return "mirror_log", map[string]interface{}{"mirror_id": id, "action": nil}
+	})
+	require.Error(t, err)
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM mirror`))
+	require.Equal(t, 1, n)
+}
+
+// 非自增主键使用entity上的主键值，sqlite返回的rowid与主键无关
+func TestInsertLinkedNaturalKey(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE legacy (id INT PRIMARY KEY, active CHAR(1), verified CHAR(1))`,
+		`CREATE TABLE legacy_log (legacy_id INTEGER NOT NULL, action TEXT NOT NULL)`,
+	)
+	ctx := context.Background()
+
+	ent := &LegacyEntity{ID: 42, Active: true}
+	require.NoError(t, InsertLinked(ctx, ent, db, func(id interface{}) (string, map[string]interface{}) {
+		return "legacy_log", map[string]interface{}{"legacy_id": id, "action": "create"}
+	}))
+
+	var linkedID int
+	require.NoError(t, db.Get(&linkedID, `SELECT legacy_id FROM legacy_log`))
+	require.Equal(t, 42, linkedID)
+}
+
+func TestInsertLinkedPostgres(t *testing.T) {
+	db := newPostgresDB(t,
+		`CREATE TABLE mirror (id SERIAL PRIMARY KEY, email TEXT, email_copy TEXT)`,
+		`CREATE TABLE legacy (id INT PRIMARY KEY, active CHAR(1), verified CHAR(1))`,
+		`CREATE TABLE entity_link (ref_id INTEGER NOT NULL)`,
+	)
+	ctx := context.Background()
+
+	link := func(id interface{}) (string, map[string]interface{}) {
+		return "entity_link", map[string]interface{}{"ref_id": id}
+	}
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	require.NoError(t, InsertLinked(ctx, ent, db, link))
+	require.NoError(t, InsertLinked(ctx, &LegacyEntity{ID: 42}, db, link))
+
+	var ids []int64
+	require.NoError(t, db.Select(&ids, `SELECT ref_id FROM entity_link ORDER BY ref_id`))
+	require.Equal(t, []int64{ent.ID, 42}, ids)
+}
+
+func TestEntityEvents(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE hook (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT)`)
+	ctx := context.Background()
+
+	ent := &HookEntity{Email: "  Foo@Example.com "}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.Equal(t, "foo@example.com", ent.Email)
+	// EventAfterInsert在写回自增ID之后触发
+	require.Equal(t, ent.ID, ent.insertedID)
+	require.NotZero(t, ent.insertedID)
+
+	loaded := &HookEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, "example.com", loaded.domain)
+	require.Equal(t, []Event{EventAfterLoad}, loaded.events)
+
+	// Before事件返回错误时中止操作
+	loaded.Email = "bar@example.com"
+	loaded.fail = EventBeforeUpdate
+	err = Update(ctx, loaded, db)
+	require.True(t, errors.Is(err, errHookFailed))
+
+	var email string
+	require.NoError(t, db.Get(&email, `SELECT email FROM hook WHERE id = ?`, ent.ID))
+	require.Equal(t, "foo@example.com", email)
+
+	loaded.fail = EventBeforeDelete
+	require.True(t, errors.Is(Delete(ctx, loaded, db), errHookFailed))
+
+	loaded.fail = EventUnknown
+	loaded.events = nil
+	require.NoError(t, Delete(ctx, loaded, db))
+	require.Equal(t, []Event{EventBeforeDelete, EventAfterDelete}, loaded.events)
+}
+
+func TestValidatable(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE hook (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT)`)
+	ctx := context.Background()
+
+	var count int
+	countRows := func() int {
+		require.NoError(t, db.Get(&count, `SELECT COUNT(*) FROM hook`))
+		return count
+	}
+
+	_, err := Insert(ctx, &ValidatedEntity{Email: "foo"}, db)
+	verr, ok := err.(*validationError)
+	require.True(t, ok, "expected *validationError, got %T", err)
+	require.Equal(t, "email", verr.Field)
+	require.Equal(t, 0, countRows())
+
+	ent := &ValidatedEntity{Email: "foo@example.com"}
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	ent.Email = "bar"
+	_, ok = Update(ctx, ent, db).(*validationError)
+	require.True(t, ok)
+
+	_, ok = Upsert(ctx, ent, db).(*validationError)
+	require.True(t, ok)
+
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo@example.com", ent.Email)
+}
+
+func TestRunInTx(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE hook (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT)`)
+	ctx := context.Background()
+
+	count := func() int {
+		var n int
+		require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM hook`))
+		return n
+	}
+
+	require.NoError(t, RunInTx(ctx, db, func(tx DB) error {
+		_, err := Insert(ctx, &HookEntity{Email: "foo@example.com"}, tx)
+		return err
+	}))
+	require.Equal(t, 1, count())
+
+	err := RunInTx(ctx, db, func(tx DB) error {
+		if _, err := Insert(ctx, &HookEntity{Email: "bar@example.com"}, tx); err != nil {
+			return err
+		}
+		return errHookFailed
+	})
+	require.True(t, errors.Is(err, errHookFailed))
+	require.Equal(t, 1, count())
+
+	require.PanicsWithValue(t, "boom", func() {
+		_ = RunInTx(ctx, db, func(tx DB) error {
+			if _, err := Insert(ctx, &HookEntity{Email: "baz@example.com"}, tx); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+	require.Equal(t, 1, count())
+
+	require.NoError(t, RunInTx(ctx, db, func(tx DB) error {
+		_, err := Insert(ctx, &HookEntity{Email: "qux@example.com"}, tx)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable}))
+	require.Equal(t, 2, count())
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = RunInTx(canceled, db, func(tx DB) error {
+		t.Fatalf("fn should not be called")
+		return nil
+	})
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestIgnoredField(t *testing.T) {
+	md, err := getMetadata(&IgnoredFieldEntity{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "email"}, columnNames(md.Columns))
+
+	ent := &IgnoredFieldEntity{ID: 1, Email: "foo@example.com", Password: "secret"}
+	for _, fn := range []func(Entity, string) (string, []interface{}, error){InsertSQL, SelectSQL, UpdateSQL, DeleteSQL} {
+		stmt, args, err := fn(ent, driverPostgres)
+		require.NoError(t, err)
+		require.NotContains(t, strings.ToLower(stmt), "password")
+		require.NotContains(t, args, "secret")
+	}
+
+	db := newTestDB(t, `CREATE TABLE hook (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT NOT NULL)`)
+	ctx := context.Background()
+
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	ent = &IgnoredFieldEntity{ID: 1, Password: "keep"}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo@example.com", ent.Email)
+	require.Equal(t, "keep", ent.Password)
+}
+
+func TestReloadAfterInsert(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE reload (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, status TEXT NOT NULL DEFAULT 'new')`)
+	ctx := context.Background()
+
+	ent := &ReloadEntity{Name: "foo", reload: true}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NotZero(t, ent.ID)
+	require.Equal(t, "new", ent.Status)
+	require.Equal(t, "new", ent.statusAfterInsert)
+
+	// 没有开启时不重新读取
+	ent = &ReloadEntity{Name: "bar"}
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NotZero(t, ent.ID)
+	require.Equal(t, "", ent.Status)
+}
+
+func TestSave(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE users (user_id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`,
+		`CREATE TABLE natural_key (code TEXT PRIMARY KEY, name TEXT)`,
+	)
+	ctx := context.Background()
+
+	// 主键为零值时插入
+	ent := &AutoIncrementEntity{Name: "foo"}
+	require.NoError(t, Save(ctx, ent, db))
+	require.True(t, ent.UserID > 0)
+
+	ent.Name = "bar"
+	require.NoError(t, Save(ctx, ent, db))
+
+	loaded := &AutoIncrementEntity{UserID: ent.UserID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, "bar", loaded.Name)
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM users`))
+	require.Equal(t, 1, n)
+
+	// 自然主键先查询记录是否存在
+	nk := &NaturalKeyEntity{Code: "a", Name: "foo"}
+	require.NoError(t, Save(ctx, nk, db))
+
+	nk.Name = "bar"
+	require.NoError(t, Save(ctx, nk, db))
+	require.NoError(t, db.Get(&nk.Name, `SELECT name FROM natural_key WHERE code = 'a'`))
+	require.Equal(t, "bar", nk.Name)
+}
+
+// 创建sqlite内存数据库，并执行建表语句
+func newTestDB(t *testing.T, schema ...string) *sqlx.DB {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	for _, stmt := range schema {
+		db.MustExec(stmt)
+	}
+	return db
+}
+
+// 使用ENTITY_POSTGRES_DSN指定的postgresql执行测试，没有设置时跳过
+// schema创建的表在测试结束时删除
+func newPostgresDB(t *testing.T, schema ...string) *sqlx.DB {
+	dsn := os.Getenv("ENTITY_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("ENTITY_POSTGRES_DSN not set")
+	}
+
+	db := sqlx.MustOpen("postgres", dsn)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	for _, stmt := range schema {
+		db.MustExec(stmt)
+		if fields := strings.Fields(stmt); len(fields) > 2 && strings.EqualFold(fields[1], "TABLE") {
+			table := fields[2]
+			t.Cleanup(func() {
+				db.MustExec("DROP TABLE IF EXISTS " + table)
+			})
+		}
+	}
+	return db
+}
+
 type TestExtra struct {
 	E1 string `json:"e1"`
 	E2 int    `json:"e2"`
@@ -202,3 +1029,526 @@ func (npe NoPrimaryKeyEntity) TableName() string {
 func (npe *NoPrimaryKeyEntity) OnEntityEvent(ctx context.Context, ev Event) error {
 	return nil
 }
+
+type MirrorEntity struct {
+	ID    int64  `db:"id,primaryKey,autoIncrement,returningInsert"`
+	Email string `db:"email,mirror=email_copy"`
+}
+
+func (me MirrorEntity) TableName() string {
+	return "mirror"
+}
+
+func (me *MirrorEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadMirrorEntity struct {
+	ID    int64  `db:"id,primaryKey"`
+	Email string `db:"email,mirror=id"`
+}
+
+func (bme BadMirrorEntity) TableName() string {
+	return "bad_mirror"
+}
+
+func (bme *BadMirrorEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type DuplicateColumnBase struct {
+	ID   int    `db:"id,primaryKey"`
+	Name string `db:"name"`
+}
+
+func (dcb DuplicateColumnBase) TableName() string {
+	return "duplicate_column"
+}
+
+func (dcb *DuplicateColumnBase) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type DuplicateColumnEntity struct {
+	DuplicateColumnBase
+	Name string `db:"name"`
+}
+
+type NullableKeyEntity struct {
+	Code   string         `db:"code,primaryKey"`
+	Region sql.NullString `db:"region,primaryKey,nullableKey"`
+	Name   string         `db:"name"`
+}
+
+func (nke NullableKeyEntity) TableName() string {
+	return "nullable_key"
+}
+
+func (nke *NullableKeyEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type ScanDestEntity struct {
+	ID   int    `db:"id,primaryKey"`
+	Name string `db:"name"`
+
+	scanned []string
+}
+
+func (sde ScanDestEntity) TableName() string {
+	return "scan_dest"
+}
+
+func (sde *ScanDestEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func (sde *ScanDestEntity) ScanDests(cols []string) []interface{} {
+	sde.scanned = cols
+
+	dests := make([]interface{}, 0, len(cols))
+	for _, col := range cols {
+		switch col {
+		case "id":
+			dests = append(dests, &sde.ID)
+		case "name":
+			dests = append(dests, upperString{&sde.Name})
+		}
+	}
+	return dests
+}
+
+type upperString struct {
+	s *string
+}
+
+func (us upperString) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*us.s = strings.ToUpper(v)
+	case []byte:
+		*us.s = strings.ToUpper(string(v))
+	}
+	return nil
+}
+
+type ReturningExtraEntity struct {
+	ID      int `db:"id,primaryKey"`
+	Amount  int `db:"amount"`
+	Version int `db:"version,returningUpdate"`
+}
+
+func (ree ReturningExtraEntity) TableName() string {
+	return "returning_extra"
+}
+
+func (ree *ReturningExtraEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type SizedEntity struct {
+	ID       int            `db:"id,primaryKey,returningInsert"`
+	Name     string         `db:"name,size=4"`
+	Nickname sql.NullString `db:"nickname,size=5"`
+}
+
+func (se SizedEntity) TableName() string {
+	return "sized"
+}
+
+func (se *SizedEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadSizeEntity struct {
+	ID   int    `db:"id,primaryKey"`
+	Name string `db:"name,size=abc"`
+}
+
+func (bse BadSizeEntity) TableName() string {
+	return "bad_size"
+}
+
+func (bse *BadSizeEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type NullPolicyEntity struct {
+	ID     int    `db:"id,primaryKey,returningInsert"`
+	AsNull string `db:"as_null,nullPolicy=null"`
+	AsZero string `db:"as_zero,nullPolicy=zero"`
+	AsOmit string `db:"as_omit,nullPolicy=omit"`
+}
+
+func (npe NullPolicyEntity) TableName() string {
+	return "null_policy"
+}
+
+func (npe *NullPolicyEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadNullPolicyEntity struct {
+	ID   int    `db:"id,primaryKey"`
+	Name string `db:"name,nullPolicy=empty"`
+}
+
+func (bnpe BadNullPolicyEntity) TableName() string {
+	return "bad_null_policy"
+}
+
+func (bnpe *BadNullPolicyEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type NormalizeEntity struct {
+	ID       int     `db:"id,primaryKey,returningInsert"`
+	Email    string  `db:"email,normalize=lower_trim"`
+	Nickname *string `db:"nickname,normalize=trim"`
+}
+
+func (ne NormalizeEntity) TableName() string {
+	return "normalize"
+}
+
+func (ne *NormalizeEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadNormalizeEntity struct {
+	ID   int    `db:"id,primaryKey"`
+	Name string `db:"name,normalize=upper"`
+}
+
+func (bne BadNormalizeEntity) TableName() string {
+	return "bad_normalize"
+}
+
+func (bne *BadNormalizeEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type GeneratedEntity struct {
+	ID       int `db:"id,primaryKey,returningInsert"`
+	Price    int `db:"price"`
+	Quantity int `db:"quantity"`
+	Total    int `db:"total,generated=price*quantity,stored"`
+}
+
+func (ge GeneratedEntity) TableName() string {
+	return "generated"
+}
+
+func (ge *GeneratedEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadGeneratedEntity struct {
+	ID    int `db:"id,primaryKey"`
+	Total int `db:"total,stored"`
+}
+
+func (bge BadGeneratedEntity) TableName() string {
+	return "bad_generated"
+}
+
+func (bge *BadGeneratedEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type VersionEntity struct {
+	ID      int    `db:"id,primaryKey,returningInsert"`
+	Name    string `db:"name"`
+	Version int    `db:"version,version"`
+}
+
+func (ve VersionEntity) TableName() string {
+	return "version"
+}
+
+func (ve *VersionEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadVersionEntity struct {
+	ID      int    `db:"id,primaryKey"`
+	Version string `db:"version,version"`
+}
+
+func (bve BadVersionEntity) TableName() string {
+	return "bad_version"
+}
+
+func (bve *BadVersionEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type TimestampEntity struct {
+	ID       int        `db:"id,primaryKey,returningInsert"`
+	Name     string     `db:"name"`
+	CreateAt time.Time  `db:"create_at,created"`
+	UpdateAt *time.Time `db:"update_at,updated"`
+}
+
+func (te TimestampEntity) TableName() string {
+	return "timestamp"
+}
+
+func (te *TimestampEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadTimestampEntity struct {
+	ID       int   `db:"id,primaryKey"`
+	CreateAt int64 `db:"create_at,created"`
+}
+
+func (bte BadTimestampEntity) TableName() string {
+	return "bad_timestamp"
+}
+
+func (bte *BadTimestampEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+var errConflictHook = errors.New("conflict hook failed")
+
+type ConflictEntity struct {
+	ID     int    `db:"id,primaryKey,returningInsert"`
+	Email  string `db:"email"`
+	Visits int    `db:"visits"`
+
+	conflicted   bool
+	failConflict bool
+}
+
+func (ce ConflictEntity) TableName() string {
+	return "conflict"
+}
+
+func (ce *ConflictEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func (ce *ConflictEntity) OnConflict(ctx context.Context, db DB) error {
+	ce.conflicted = true
+	if ce.failConflict {
+		return errConflictHook
+	}
+
+	var existing ConflictEntity
+	if err := sqlx.GetContext(ctx, db, &existing, db.Rebind(`SELECT id, email, visits FROM conflict WHERE email = ?`), ce.Email); err != nil {
+		return err
+	}
+
+	ce.ID = existing.ID
+	ce.Visits += existing.Visits
+	return Update(ctx, ce, db)
+}
+
+type EmbeddedPtrBase struct {
+	Name     string `db:"name"`
+	CreateAt string `db:"create_at,returningInsert"`
+}
+
+type EmbeddedPtrEntity struct {
+	ID int `db:"id,primaryKey"`
+	*EmbeddedPtrBase
+}
+
+func (epe EmbeddedPtrEntity) TableName() string {
+	return "embedded_ptr"
+}
+
+func (epe *EmbeddedPtrEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type AutoIncrementEntity struct {
+	UserID int64  `db:"user_id,primaryKey,autoIncrement"`
+	Name   string `db:"name"`
+}
+
+func (aie AutoIncrementEntity) TableName() string {
+	return "users"
+}
+
+func (aie *AutoIncrementEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type PGEnumEntity struct {
+	ID   int    `db:"id,primaryKey"`
+	Mood string `db:"mood,pgenum=mood"`
+}
+
+func (pee PGEnumEntity) TableName() string {
+	return "pgenum"
+}
+
+func (pee *PGEnumEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type NaturalKeyEntity struct {
+	Code string `db:"code,primaryKey"`
+	Name string `db:"name"`
+}
+
+func (nke NaturalKeyEntity) TableName() string {
+	return "natural_key"
+}
+
+func (nke *NaturalKeyEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func (nke *NaturalKeyEntity) SaveCheckExists() bool {
+	return true
+}
+
+var errHookFailed = errors.New("hook failed")
+
+type HookEntity struct {
+	ID    int64  `db:"id,primaryKey,autoIncrement"`
+	Email string `db:"email"`
+
+	events     []Event
+	fail       Event
+	insertedID int64
+	domain     string
+}
+
+func (he HookEntity) TableName() string {
+	return "hook"
+}
+
+func (he *HookEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	he.events = append(he.events, ev)
+	if ev == he.fail {
+		return errHookFailed
+	}
+
+	switch ev {
+	case EventBeforeInsert:
+		he.Email = strings.ToLower(strings.TrimSpace(he.Email))
+	case EventAfterInsert:
+		he.insertedID = he.ID
+	case EventAfterLoad:
+		he.domain = he.Email[strings.Index(he.Email, "@")+1:]
+	}
+	return nil
+}
+
+type validationError struct {
+	Field string
+}
+
+func (e *validationError) Error() string {
+	return "invalid " + e.Field
+}
+
+type ValidatedEntity struct {
+	ID    int64  `db:"id,primaryKey,autoIncrement"`
+	Email string `db:"email"`
+}
+
+func (ve ValidatedEntity) TableName() string {
+	return "hook"
+}
+
+func (ve *ValidatedEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func (ve *ValidatedEntity) Validate() error {
+	if !strings.Contains(ve.Email, "@") {
+		return &validationError{Field: "email"}
+	}
+	return nil
+}
+
+type IgnoredFieldEntity struct {
+	ID       int64  `db:"id,primaryKey,autoIncrement"`
+	Email    string `db:"email"`
+	Password string `db:"-"`
+}
+
+func (ife IgnoredFieldEntity) TableName() string {
+	return "hook"
+}
+
+func (ife *IgnoredFieldEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BaseModel struct {
+	ID       int64     `db:"id,primaryKey,autoIncrement"`
+	CreateAt time.Time `db:"create_at,created"`
+	UpdateAt time.Time `db:"update_at,updated"`
+}
+
+type EmbeddedBaseEntity struct {
+	BaseModel
+	Email string `db:"email"`
+}
+
+func (ebe EmbeddedBaseEntity) TableName() string {
+	return "embedded_base"
+}
+
+func (ebe *EmbeddedBaseEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type OrderedKeyEntity struct {
+	Line     int   `db:"line,primaryKey"`
+	OrderID  int64 `db:"order_id,primaryKey=2"`
+	TenantID int64 `db:"tenant_id,primaryKey=1"`
+	Amount   int   `db:"amount"`
+}
+
+func (oke OrderedKeyEntity) TableName() string {
+	return "ordered_key"
+}
+
+func (oke *OrderedKeyEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadKeyOrderEntity struct {
+	OrderID  int64 `db:"order_id,primaryKey=1"`
+	TenantID int64 `db:"tenant_id,primaryKey=1"`
+}
+
+func (bkoe BadKeyOrderEntity) TableName() string {
+	return "bad_key_order"
+}
+
+func (bkoe *BadKeyOrderEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type ReloadEntity struct {
+	ID     int64  `db:"id,primaryKey,autoIncrement"`
+	Name   string `db:"name"`
+	Status string `db:"status,nullPolicy=omit"`
+
+	reload            bool
+	statusAfterInsert string
+}
+
+func (re ReloadEntity) TableName() string {
+	return "reload"
+}
+
+func (re *ReloadEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	if ev == EventAfterInsert {
+		re.statusAfterInsert = re.Status
+	}
+	return nil
+}
+
+func (re *ReloadEntity) ReloadAfterInsert() bool {
+	return re.reload
+}
@@ -0,0 +1,89 @@
+// Package entitytest 测试entity时使用的辅助方法
+package entitytest
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/joyparty/entity"
+)
+
+var update = flag.Bool("entitytest.update", false, "update entity statement golden files")
+
+// GoldenDir golden文件所在的目录，相对于执行测试的目录
+var GoldenDir = "testdata"
+
+// AssertStatements 检查entity在各个数据库下生成的Load、Insert、Update、Delete语句是否与golden文件一致
+// 用于锁定entity生成的SQL，避免升级或者修改tag时发生意外的变化
+// drivers为空时检查mysql、postgres、sqlite3，使用 go test -entitytest.update 更新golden文件
+func AssertStatements(t testing.TB, ent entity.Entity, drivers ...string) {
+	t.Helper()
+
+	if len(drivers) == 0 {
+		drivers = []string{"mysql", "postgres", "sqlite3"}
+	}
+
+	actual := map[string]map[string]string{}
+	for _, driver := range drivers {
+		stmts, err := entity.Statements(ent, driver)
+		if err != nil {
+			t.Fatalf("%s statements, %v", driver, err)
+			return
+		}
+		actual[driver] = stmts
+	}
+
+	file := filepath.Join(GoldenDir, reflectx.Deref(reflect.TypeOf(ent)).Name()+".statements.json")
+
+	expected := map[string]map[string]string{}
+	if data, err := os.ReadFile(file); err == nil {
+		if err := json.Unmarshal(data, &expected); err != nil {
+			t.Fatalf("decode golden %s, %v", file, err)
+			return
+		}
+	} else if !*update {
+		t.Fatalf("read golden, %v", err)
+		return
+	}
+
+	if *update {
+		// 只更新本次检查的数据库，保留golden文件内的其它数据库
+		for driver, stmts := range actual {
+			expected[driver] = stmts
+		}
+
+		data, err := json.MarshalIndent(expected, "", "\t")
+		if err != nil {
+			t.Fatalf("encode golden, %v", err)
+			return
+		}
+
+		if err := os.MkdirAll(GoldenDir, 0o755); err != nil {
+			t.Fatalf("create golden dir, %v", err)
+			return
+		}
+		if err := os.WriteFile(file, append(data, '\n'), 0o644); err != nil {
+			t.Fatalf("write golden, %v", err)
+		}
+		return
+	}
+
+	for _, driver := range drivers {
+		stmts, ok := expected[driver]
+		if !ok {
+			t.Errorf("%s golden file missing driver %s", file, driver)
+			continue
+		}
+
+		for op, stmt := range actual[driver] {
+			if e := stmts[op]; e != stmt {
+				t.Errorf("%s %s %s, Expected=%s, Actual=%s", reflectx.Deref(reflect.TypeOf(ent)), driver, op, e, stmt)
+			}
+		}
+	}
+}
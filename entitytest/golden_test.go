@@ -0,0 +1,70 @@
+package entitytest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/joyparty/entity"
+)
+
+type User struct {
+	ID       int64  `db:"user_id,primaryKey,autoIncrement"`
+	Name     string `db:"name"`
+	CreateAt int64  `db:"create_at,refuseUpdate,returningInsert"`
+}
+
+func (u User) TableName() string {
+	return "users"
+}
+
+func (u *User) OnEntityEvent(ctx context.Context, ev entity.Event) error {
+	return nil
+}
+
+type Renamed struct {
+	ID   int64  `db:"id,primaryKey"`
+	Name string `db:"full_name"`
+}
+
+func (r Renamed) TableName() string {
+	return "users"
+}
+
+func (r *Renamed) OnEntityEvent(ctx context.Context, ev entity.Event) error {
+	return nil
+}
+
+func TestAssertStatements(t *testing.T) {
+	AssertStatements(t, &User{})
+}
+
+func TestAssertStatementsMismatch(t *testing.T) {
+	// Renamed的golden文件与生成的语句不一致
+	rt := &recordT{TB: t}
+	AssertStatements(rt, &Renamed{}, "postgres")
+	if len(rt.errors) != 4 {
+		t.Fatalf("mismatch errors, Expected=4, Actual=%d", len(rt.errors))
+	}
+
+	rt = &recordT{TB: t}
+	AssertStatements(rt, &Renamed{}, "mysql")
+	if len(rt.errors) != 1 {
+		t.Fatalf("missing golden driver, Expected=1, Actual=%d", len(rt.errors))
+	}
+}
+
+type recordT struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordT) Helper() {}
+
+func (r *recordT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordT) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
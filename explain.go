@@ -0,0 +1,95 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ExplainQuery 返回entity指定操作对应语句的执行计划，用于诊断缺少索引等问题
+// op为OpLoad、OpInsert、OpUpdate、OpDelete之一，语句参数取自ent的字段值
+// analyze为true时使用EXPLAIN ANALYZE，会真正执行语句，所以只允许用于OpLoad，sqlite不支持
+func ExplainQuery(ctx context.Context, ent Entity, db DB, op string, analyze bool) (string, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return "", fmt.Errorf("get metadata, %w", err)
+	}
+
+	driver := dbDriver(db)
+
+	var stmt string
+	switch op {
+	case OpLoad:
+		stmt = selectStatement(ent, md, driver)
+	case OpInsert:
+		stmt = insertStatement(ent, md, driver)
+	case OpUpdate:
+		stmt = updateStatement(ent, md, driver)
+	case OpDelete:
+		stmt = deleteStatement(ent, md, driver)
+	default:
+		return "", fmt.Errorf("unsupported explain operation %q", op)
+	}
+
+	if analyze && op != OpLoad {
+		return "", fmt.Errorf("explain analyze will execute %q statement", op)
+	}
+
+	keyword, err := explainKeyword(driver, analyze)
+	if err != nil {
+		return "", err
+	}
+
+	stmt, args, err := sqlx.Named(keyword+" "+stmt, ent)
+	if err != nil {
+		return "", fmt.Errorf("bind named, %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	rows, err := db.QueryxContext(ctx, rebind(db, stmt), args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	lines := []string{}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return "", fmt.Errorf("scan plan, %w", err)
+		}
+
+		cols := make([]string, 0, len(values))
+		for _, v := range values {
+			if b, ok := v.([]byte); ok {
+				cols = append(cols, string(b))
+			} else {
+				cols = append(cols, fmt.Sprint(v))
+			}
+		}
+		lines = append(lines, strings.Join(cols, "\t"))
+	}
+
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+func explainKeyword(driver string, analyze bool) (string, error) {
+	if driver == driverSqlserver {
+		// sqlserver使用SET SHOWPLAN_TEXT，不能和查询在同一个批次内执行
+		return "", fmt.Errorf("driver %q explain, %w", driver, ErrUnsupported)
+	} else if driver == driverSqlite3 {
+		if analyze {
+			return "", fmt.Errorf("driver %q does not support explain analyze", driver)
+		}
+		return "EXPLAIN QUERY PLAN", nil
+	}
+
+	if analyze {
+		return "EXPLAIN ANALYZE", nil
+	}
+	return "EXPLAIN", nil
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainQuery(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	plan, err := ExplainQuery(ctx, &MirrorEntity{}, db, OpLoad, false)
+	require.NoError(t, err)
+	require.Contains(t, plan, "mirror")
+
+	for _, op := range []string{OpInsert, OpUpdate, OpDelete} {
+		_, err := ExplainQuery(ctx, &MirrorEntity{}, db, op, false)
+		require.NoError(t, err, op)
+	}
+
+	_, err = ExplainQuery(ctx, &MirrorEntity{}, db, OpLoad, true)
+	require.Error(t, err)
+	_, err = ExplainQuery(ctx, &MirrorEntity{}, db, OpDelete, true)
+	require.Error(t, err)
+	_, err = ExplainQuery(ctx, &MirrorEntity{}, db, OpUpsert, false)
+	require.Error(t, err)
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM mirror`))
+	require.Equal(t, 0, n)
+}
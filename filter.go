@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// FilterBuilder 根据过滤条件构造WHERE条件
+// 过滤条件是一个struct，每个指针类型的属性对应一个过滤字段，属性的db tag必须是entity的字段
+// 值为nil的属性会被忽略，其它属性以AND组合
+type FilterBuilder struct {
+	md     *Metadata
+	driver string
+}
+
+// NewFilterBuilder 构造过滤条件生成器
+func NewFilterBuilder(ent Entity, driver string) (*FilterBuilder, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return nil, fmt.Errorf("get metadata, %w", err)
+	}
+
+	return &FilterBuilder{
+		md:     md,
+		driver: driver,
+	}, nil
+}
+
+// Build 生成WHERE条件以及对应的命名参数，条件内不包含WHERE关键字
+// 所有过滤字段都为空时，返回空字符串，表示没有过滤条件
+func (fb *FilterBuilder) Build(filter interface{}) (string, map[string]interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(filter))
+	if v.Kind() != reflect.Struct {
+		return "", nil, fmt.Errorf("filter must be a struct, got %T", filter)
+	}
+
+	conds := []string{}
+	args := map[string]interface{}{}
+	for _, fi := range getFields(mapper.TypeMap(v.Type()).Tree) {
+		if fi.Field.Type.Kind() != reflect.Ptr {
+			continue
+		}
+
+		col, ok := fb.md.Column(fi.Name)
+		if !ok {
+			return "", nil, fmt.Errorf("filter field %q, column %q not found", fi.Field.Name, fi.Name)
+		}
+
+		f := reflectx.FieldByIndexesReadOnly(v, fi.Index)
+		if f.IsNil() {
+			continue
+		}
+
+		conds = append(conds, fmt.Sprintf("%s = %s", quoteColumn(fi.Name, fb.driver), bindParam(col, fb.driver, ":"+fi.Name)))
+		args[fi.Name] = f.Elem().Interface()
+	}
+
+	// 保证生成的条件顺序固定
+	sort.Strings(conds)
+
+	return strings.Join(conds, " AND "), args, nil
+}
@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterBuilder(t *testing.T) {
+	type Filter struct {
+		Name *string `db:"name"`
+		ID2  *int    `db:"id2"`
+		Page int
+	}
+
+	fb, err := NewFilterBuilder(&GenernalEntity{}, driverPostgres)
+	require.NoError(t, err)
+
+	name, id2 := "foo", 2
+	cases := []struct {
+		filter Filter
+		where  string
+		args   map[string]interface{}
+	}{
+		{
+			filter: Filter{},
+			where:  "",
+			args:   map[string]interface{}{},
+		},
+		{
+			filter: Filter{Name: &name},
+			where:  `"name" = :name`,
+			args:   map[string]interface{}{"name": "foo"},
+		},
+		{
+			filter: Filter{ID2: &id2, Page: 1},
+			where:  `"id2" = :id2`,
+			args:   map[string]interface{}{"id2": 2},
+		},
+		{
+			filter: Filter{Name: &name, ID2: &id2},
+			where:  `"id2" = :id2 AND "name" = :name`,
+			args:   map[string]interface{}{"name": "foo", "id2": 2},
+		},
+	}
+
+	for _, c := range cases {
+		where, args, err := fb.Build(&c.filter)
+		require.NoError(t, err)
+		require.Equal(t, c.where, where)
+		require.Equal(t, c.args, args)
+	}
+
+	type BadFilter struct {
+		Unknown *string `db:"unknown"`
+	}
+	_, _, err = fb.Build(BadFilter{})
+	require.Error(t, err)
+
+	_, _, err = fb.Build("name")
+	require.Error(t, err)
+}
+
+func TestFilterBuilderQuery(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (email, email_copy) VALUES ('foo', 'a'), ('foo', 'b'), ('bar', 'a')`,
+	)
+
+	type Filter struct {
+		ID    *int    `db:"id"`
+		Email *string `db:"email"`
+	}
+
+	fb, err := NewFilterBuilder(&MirrorEntity{}, driverSqlite3)
+	require.NoError(t, err)
+
+	email := "foo"
+	where, args, err := fb.Build(Filter{Email: &email})
+	require.NoError(t, err)
+
+	stmt, params, err := sqlx.Named("SELECT COUNT(*) FROM mirror WHERE "+where, args)
+	require.NoError(t, err)
+
+	var n int
+	require.NoError(t, db.GetContext(context.Background(), &n, db.Rebind(stmt), params...))
+	require.Equal(t, 2, n)
+}
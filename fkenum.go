@@ -0,0 +1,115 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// FKEnumCacheTTL 参照表检查结果的缓存时间，0表示不缓存，每次写入都查询参照表
+// 只缓存存在的值，参照表内删除的值在缓存过期之前仍然被认为有效
+var FKEnumCacheTTL time.Duration
+
+var (
+	fkEnumPattern = regexp.MustCompile(`^([\w.]+)\((\w+)\)$`)
+
+	fkEnumCache    = map[string]time.Time{}
+	fkEnumCacheMux sync.Mutex
+)
+
+// 解析table(column)格式的参照表设置
+func parseFKEnum(s string) (table, column string, ok bool) {
+	m := fkEnumPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// 检查fkEnum字段的值是否存在于参照表内，NULL不检查
+func checkFKEnums(ctx context.Context, ent Entity, md *Metadata, db DB) error {
+	if !md.hasFKEnum {
+		return nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, col := range md.Columns {
+		if col.FKEnum == "" {
+			continue
+		}
+
+		f, ok := readField(v, col.DBField)
+		if !ok {
+			continue
+		}
+
+		value, err := columnValue(f)
+		if err != nil {
+			return fmt.Errorf("column %q value, %w", col.DBField, err)
+		} else if value == nil {
+			continue
+		}
+
+		if err := checkFKEnum(ctx, db, col, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFKEnum(ctx context.Context, db DB, col Column, value interface{}) error {
+	table, column, _ := parseFKEnum(col.FKEnum)
+	key := fmt.Sprintf("%s\x00%v", col.FKEnum, value)
+
+	if FKEnumCacheTTL > 0 {
+		fkEnumCacheMux.Lock()
+		expire, ok := fkEnumCache[key]
+		fkEnumCacheMux.Unlock()
+
+		if ok && time.Now().Before(expire) {
+			return nil
+		}
+	}
+
+	driver := dbDriver(db)
+	stmt := newSQLBuilder("SELECT", quoteIdentifier(table, driver), driver).
+		expr("1").
+		where(quoteColumn(column, driver) + " = ?").
+		limit(1).
+		String()
+
+	var n int
+	if err := db.QueryRowxContext(ctx, rebind(db, stmt), value).Scan(&n); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("column %q value %v not found in %s, %w", col.DBField, value, col.FKEnum, ErrInvalidEnum)
+		}
+		return fmt.Errorf("check %s, %w", col.FKEnum, err)
+	}
+
+	if FKEnumCacheTTL > 0 {
+		fkEnumCacheMux.Lock()
+		fkEnumCache[key] = time.Now().Add(FKEnumCacheTTL)
+		fkEnumCacheMux.Unlock()
+	}
+	return nil
+}
+
+// 字段写入数据库时的值，nil指针以及driver.Valuer返回的nil都是NULL
+func columnValue(f reflect.Value) (interface{}, error) {
+	if f.Kind() == reflect.Ptr && f.IsNil() {
+		return nil, nil
+	}
+
+	if v, ok := f.Interface().(driver.Valuer); ok {
+		return v.Value()
+	} else if f.Kind() == reflect.Ptr {
+		return f.Elem().Interface(), nil
+	}
+	return f.Interface(), nil
+}
@@ -0,0 +1,80 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type FKEnumEntity struct {
+	ID       int     `db:"id,primaryKey"`
+	Status   string  `db:"status,fkEnum=statuses(code)"`
+	Category *string `db:"category,fk_enum=statuses(code)"`
+}
+
+func (fe FKEnumEntity) TableName() string {
+	return "fk_enum"
+}
+
+func (fe *FKEnumEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type InvalidFKEnumEntity struct {
+	ID     int    `db:"id,primaryKey"`
+	Status string `db:"status,fkEnum=statuses"`
+}
+
+func (ie InvalidFKEnumEntity) TableName() string {
+	return "fk_enum"
+}
+
+func (ie *InvalidFKEnumEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func TestFKEnum(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE statuses (code TEXT PRIMARY KEY)`,
+		`INSERT INTO statuses (code) VALUES ('active'), ('blocked')`,
+		`CREATE TABLE fk_enum (id INTEGER PRIMARY KEY, status TEXT, category TEXT)`,
+	)
+	ctx := context.Background()
+
+	md, err := getMetadata(&FKEnumEntity{})
+	require.NoError(t, err)
+	require.True(t, md.hasFKEnum)
+
+	_, err = getMetadata(&InvalidFKEnumEntity{})
+	require.Error(t, err)
+
+	// NULL不检查
+	ent := &FKEnumEntity{ID: 1, Status: "active"}
+	_, err = Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	ent.Status = "deleted"
+	require.True(t, errors.Is(Update(ctx, ent, db), ErrInvalidEnum))
+
+	category := "unknown"
+	_, err = Insert(ctx, &FKEnumEntity{ID: 2, Status: "active", Category: &category}, db)
+	require.True(t, errors.Is(err, ErrInvalidEnum))
+
+	ent = &FKEnumEntity{ID: 1}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "active", ent.Status)
+
+	// 缓存有效期内不再查询参照表
+	defer func(ttl time.Duration) { FKEnumCacheTTL = ttl }(FKEnumCacheTTL)
+	FKEnumCacheTTL = time.Minute
+
+	ent.Status = "blocked"
+	require.NoError(t, Update(ctx, ent, db))
+
+	db.MustExec(`DELETE FROM statuses WHERE code = 'blocked'`)
+	_, err = Insert(ctx, &FKEnumEntity{ID: 3, Status: "blocked"}, db)
+	require.NoError(t, err)
+}
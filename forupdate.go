@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported 当前数据库不支持此操作
+var ErrUnsupported = errors.New("unsupported by database driver")
+
+// LockOptions LoadForUpdate的加锁方式
+type LockOptions struct {
+	// 记录已经被锁定时立即返回错误，不等待，可以用IsLockNotAvailable()判断
+	NoWait bool
+	// 记录已经被锁定时跳过，LoadForUpdate返回sql.ErrNoRows
+	SkipLocked bool
+}
+
+// LoadForUpdate 使用SELECT ... FOR UPDATE读取entity并锁定记录，必须在事务内使用，事务结束时释放锁
+// 不读取也不更新缓存，sqlite没有行锁，返回ErrUnsupported
+//
+//	err := entity.Transaction(db, func(tx *sqlx.Tx) error {
+//		if err := entity.LoadForUpdate(ctx, order, tx); err != nil {
+//			return err
+//		}
+//		order.Status = "paid"
+//		return entity.Update(ctx, order, tx)
+//	})
+func LoadForUpdate(ctx context.Context, ent Entity, db DB, opts ...LockOptions) error {
+	var opt LockOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	lock, err := lockClause(dbDriver(db), opt)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	db = withLogger(db)
+	if err := handle(ctx, db, OpLoad, ent.TableName(), func(ctx context.Context) error {
+		return loadEntity(ctx, ent, db, lock)
+	}); err != nil {
+		return err
+	}
+
+	if err := ent.OnEntityEvent(ctx, EventAfterLoad); err != nil {
+		return fmt.Errorf("after load, %w", err)
+	}
+	return nil
+}
+
+func lockClause(driver string, opt LockOptions) (string, error) {
+	if driver != driverPostgres && driver != driverMysql {
+		return "", fmt.Errorf("driver %q row lock, %w", driver, ErrUnsupported)
+	}
+
+	switch {
+	case opt.NoWait && opt.SkipLocked:
+		return "", fmt.Errorf("NoWait and SkipLocked are exclusive")
+	case opt.NoWait:
+		return "FOR UPDATE NOWAIT", nil
+	case opt.SkipLocked:
+		return "FOR UPDATE SKIP LOCKED", nil
+	}
+	return "FOR UPDATE", nil
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadForUpdate(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`)
+
+	err := LoadForUpdate(context.Background(), &ScoreEntity{ID: 1}, db)
+	require.True(t, errors.Is(err, ErrUnsupported))
+
+	for _, c := range []struct {
+		driver   string
+		opt      LockOptions
+		expected string
+	}{
+		{driverPostgres, LockOptions{}, "FOR UPDATE"},
+		{driverPostgres, LockOptions{NoWait: true}, "FOR UPDATE NOWAIT"},
+		{driverMysql, LockOptions{SkipLocked: true}, "FOR UPDATE SKIP LOCKED"},
+	} {
+		actual, err := lockClause(c.driver, c.opt)
+		require.NoError(t, err)
+		require.Equal(t, c.expected, actual)
+	}
+
+	_, err = lockClause(driverPostgres, LockOptions{NoWait: true, SkipLocked: true})
+	require.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Get 按主键载入T类型的entity，主键值按元数据的主键顺序传入，数量必须与主键字段数量一致
+// 主键顺序由primaryKey=N指定，没有指定顺序的主键按照声明顺序排在后面
+// 记录不存在时返回sql.ErrNoRows
+//
+//	user, err := entity.Get[*User](ctx, db, 1)
+func Get[T Entity](ctx context.Context, db DB, pk ...interface{}) (T, error) {
+	var zero T
+
+	ent, result := newAddressable[T]()
+	md, err := getMetadata(ent)
+	if err != nil {
+		return zero, fmt.Errorf("get metadata, %w", err)
+	} else if len(pk) != len(md.PrimaryKeys) {
+		return zero, fmt.Errorf("entity %q, expect %d primary key values, got %d", md.Type, len(md.PrimaryKeys), len(pk))
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for i, col := range md.PrimaryKeys {
+		if err := setFieldValue(mapper.FieldByName(v, col.DBField), pk[i]); err != nil {
+			return zero, fmt.Errorf("primary key %q, %w", col.DBField, err)
+		}
+	}
+
+	if err := Load(ctx, ent, db); err != nil {
+		return zero, err
+	}
+	return result(), nil
+}
+
+// Create 插入entity，返回插入后的entity，数据库生成的自增主键会写回到返回值内
+//
+//	user, err := entity.Create(ctx, db, &User{Name: "foo"})
+func Create[T Entity](ctx context.Context, db DB, ent T) (T, error) {
+	var zero T
+
+	target, result := addressable(ent)
+	md, err := getMetadata(target)
+	if err != nil {
+		return zero, fmt.Errorf("get metadata, %w", err)
+	}
+
+	lastID, err := Insert(ctx, target, db)
+	if err != nil {
+		return zero, err
+	} else if lastID > 0 && autoIncrementID(target, md) == 0 {
+		setAutoIncrement(target, md, lastID)
+	}
+	return result(), nil
+}
+
+// 构造一个新的T，返回可以写入的entity以及取回T的函数
+func newAddressable[T Entity]() (Entity, func() T) {
+	return addressable(newEntity[T]())
+}
+
+// 执行查询并逐行通过scanEntity读取为T，编解码、网络地址以及转换器字段都会正确处理
+func selectEntities[T Entity](ctx context.Context, db DB, query string, args ...interface{}) ([]T, error) {
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []T{}
+	for rows.Next() {
+		ent, value := newAddressable[T]()
+		if err := scanEntity(rows, ent); err != nil {
+			return nil, fmt.Errorf("scan struct, %w", err)
+		}
+		result = append(result, value())
+	}
+	return result, rows.Err()
+}
+
+// T不是指针类型时，复制到一个新的指针上操作，操作完成后再取回值
+func addressable[T Entity](ent T) (Entity, func() T) {
+	v := reflect.ValueOf(ent)
+	if v.Kind() == reflect.Ptr {
+		return ent, func() T { return ent }
+	}
+
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface().(Entity), func() T {
+		return p.Elem().Interface().(T)
+	}
+}
+
+// 把参数值写入字段，类型不一致时尝试转换
+func setFieldValue(f reflect.Value, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return fmt.Errorf("nil value")
+	}
+
+	if f.Kind() == reflect.Ptr && v.Type() != f.Type() {
+		p := reflect.New(f.Type().Elem())
+		if err := setFieldValue(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	if v.Type().AssignableTo(f.Type()) {
+		f.Set(v)
+	} else if v.Type().ConvertibleTo(f.Type()) && (f.Kind() != reflect.String || v.Kind() == reflect.String) {
+		f.Set(v.Convert(f.Type()))
+	} else {
+		return fmt.Errorf("cannot use %T as %s", value, f.Type())
+	}
+	return nil
+}
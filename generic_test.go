@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAndCreate(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE users (user_id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+	)
+	ctx := context.Background()
+
+	user, err := Create(ctx, db, &AutoIncrementEntity{Name: "foo"})
+	require.NoError(t, err)
+	require.True(t, user.UserID > 0)
+
+	loaded, err := Get[*AutoIncrementEntity](ctx, db, user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, "foo", loaded.Name)
+
+	// 主键值类型与字段类型不一致时自动转换
+	loaded, err = Get[*AutoIncrementEntity](ctx, db, int32(user.UserID))
+	require.NoError(t, err)
+	require.Equal(t, user.UserID, loaded.UserID)
+
+	_, err = Get[*AutoIncrementEntity](ctx, db, user.UserID+1)
+	require.True(t, errors.Is(err, sql.ErrNoRows))
+
+	_, err = Get[*AutoIncrementEntity](ctx, db)
+	require.Error(t, err)
+
+	_, err = Get[*AutoIncrementEntity](ctx, db, user.UserID, 2)
+	require.Error(t, err)
+
+	_, err = Get[*AutoIncrementEntity](ctx, db, "1")
+	require.Error(t, err)
+
+	score, err := Create(ctx, db, &ScoreEntity{ID: 10, Team: "a", Points: 5})
+	require.NoError(t, err)
+	require.Equal(t, 10, score.ID)
+
+	score, err = Get[*ScoreEntity](ctx, db, 10)
+	require.NoError(t, err)
+	require.Equal(t, "a", score.Team)
+	require.Equal(t, 5, score.Points)
+}
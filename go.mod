@@ -1,12 +1,19 @@
 module github.com/joyparty/entity
 
-go 1.14
+go 1.18
 
 require (
 	github.com/jmoiron/sqlx v1.2.0
-	github.com/json-iterator/go v1.1.9
-	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
-	github.com/modern-go/reflect2 v1.0.1 // indirect
+	github.com/json-iterator/go v1.1.12
+	github.com/lib/pq v1.0.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/stretchr/testify v1.3.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	google.golang.org/appengine v1.6.5 // indirect
 )
@@ -0,0 +1,139 @@
+package entity
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+)
+
+var (
+	netipAddrType   = reflect.TypeOf(netip.Addr{})
+	netipPrefixType = reflect.TypeOf(netip.Prefix{})
+	netIPType       = reflect.TypeOf(net.IP{})
+	netIPNetType    = reflect.TypeOf(net.IPNet{})
+)
+
+// 根据字段类型返回postgresql的网络地址类型
+// netip.Addr及net.IP对应inet，netip.Prefix及net.IPNet对应cidr，其它类型返回空字符串
+func inetType(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case netipAddrType, netIPType:
+		return "inet"
+	case netipPrefixType, netIPNetType:
+		return "cidr"
+	}
+	return ""
+}
+
+// 网络地址转换为文本形式写入数据库，空值写入NULL
+func inetValue(v interface{}) interface{} {
+	switch ip := v.(type) {
+	case netip.Addr:
+		if ip.IsValid() {
+			return ip.String()
+		}
+	case *netip.Addr:
+		if ip != nil {
+			return inetValue(*ip)
+		}
+	case netip.Prefix:
+		if ip.IsValid() {
+			return ip.String()
+		}
+	case *netip.Prefix:
+		if ip != nil {
+			return inetValue(*ip)
+		}
+	case net.IP:
+		if len(ip) > 0 {
+			return ip.String()
+		}
+	case *net.IP:
+		if ip != nil {
+			return inetValue(*ip)
+		}
+	case net.IPNet:
+		if ip.IP != nil {
+			return ip.String()
+		}
+	case *net.IPNet:
+		if ip != nil {
+			return inetValue(*ip)
+		}
+	}
+	return nil
+}
+
+// 把数据库返回的文本形式网络地址解析到entity字段
+type inetScanner struct {
+	field reflect.Value
+}
+
+var _ sql.Scanner = inetScanner{}
+
+func (s inetScanner) Scan(src interface{}) error {
+	f := s.field
+	if src == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+
+	var text string
+	switch v := src.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("unsupported inet value type %T", src)
+	}
+
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		f = f.Elem()
+	}
+
+	switch f.Type() {
+	case netipAddrType:
+		addr, err := netip.ParseAddr(text)
+		if err != nil {
+			// inet可以带有掩码，例如10.0.0.1/24
+			prefix, perr := netip.ParsePrefix(text)
+			if perr != nil {
+				return err
+			}
+			addr = prefix.Addr()
+		}
+		f.Set(reflect.ValueOf(addr))
+	case netipPrefixType:
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(prefix))
+	case netIPType:
+		ip := net.ParseIP(text)
+		if ip == nil {
+			var err error
+			if ip, _, err = net.ParseCIDR(text); err != nil {
+				return err
+			}
+		}
+		f.Set(reflect.ValueOf(ip))
+	case netIPNetType:
+		_, ipnet, err := net.ParseCIDR(text)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(*ipnet))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInetStatement(t *testing.T) {
+	md, err := newTestMetadata(&InetEntity{})
+	require.NoError(t, err)
+
+	col, _ := md.Column("addr")
+	require.Equal(t, "inet", col.Inet)
+	col, _ = md.Column("network")
+	require.Equal(t, "cidr", col.Inet)
+
+	expected := `INSERT INTO "inet" ("addr", "legacy", "network") VALUES (CAST(:addr AS inet), CAST(:legacy AS inet), CAST(:network AS cidr)) RETURNING "id"`
+	require.Equal(t, expected, insertStatement(&InetEntity{}, md, driverPostgres))
+
+	expected = `INSERT INTO "inet" ("addr", "legacy", "network") VALUES (:addr, :legacy, :network) RETURNING "id"`
+	require.Equal(t, expected, insertStatement(&InetEntity{}, md, driverSqlite3))
+}
+
+func TestInet(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE inet (id INTEGER PRIMARY KEY, addr TEXT, legacy TEXT, network TEXT)`)
+	ctx := context.Background()
+
+	ent := &InetEntity{
+		Addr:    netip.MustParseAddr("192.168.1.10"),
+		Legacy:  net.ParseIP("2001:db8::1"),
+		Network: netip.MustParsePrefix("10.0.0.0/8"),
+	}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	var addr, legacy, network string
+	require.NoError(t, db.QueryRow(`SELECT addr, legacy, network FROM inet WHERE id = ?`, ent.ID).Scan(&addr, &legacy, &network))
+	require.Equal(t, "192.168.1.10", addr)
+	require.Equal(t, "2001:db8::1", legacy)
+	require.Equal(t, "10.0.0.0/8", network)
+
+	loaded := &InetEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, ent.Addr, loaded.Addr)
+	require.True(t, ent.Legacy.Equal(loaded.Legacy))
+	require.Equal(t, ent.Network, loaded.Network)
+
+	// 零值写入NULL，读取NULL得到零值
+	loaded.Addr = netip.Addr{}
+	loaded.Legacy = nil
+	require.NoError(t, Update(ctx, loaded, db))
+	require.NoError(t, Load(ctx, loaded, db))
+	require.False(t, loaded.Addr.IsValid())
+	require.Nil(t, loaded.Legacy)
+}
+
+func TestInetIPNet(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE subnet (id INTEGER PRIMARY KEY, network TEXT)`)
+	ctx := context.Background()
+
+	// 零值写入NULL，而不是"<nil>"
+	require.Nil(t, inetValue(net.IPNet{}))
+	ent := &SubnetEntity{}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	var network sql.NullString
+	require.NoError(t, db.QueryRow(`SELECT network FROM subnet WHERE id = ?`, ent.ID).Scan(&network))
+	require.False(t, network.Valid)
+
+	_, ipnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	ent.Network = *ipnet
+	require.NoError(t, Update(ctx, ent, db))
+
+	loaded := &SubnetEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, "10.0.0.0/8", loaded.Network.String())
+}
+
+func TestInetPostgres(t *testing.T) {
+	db := newPostgresDB(t,
+		`CREATE TABLE inet (id SERIAL PRIMARY KEY, addr inet, legacy inet, network cidr)`,
+		`CREATE TABLE subnet (id SERIAL PRIMARY KEY, network cidr)`,
+	)
+	ctx := context.Background()
+
+	ent := &InetEntity{
+		Addr:    netip.MustParseAddr("192.168.1.10"),
+		Legacy:  net.ParseIP("2001:db8::1"),
+		Network: netip.MustParsePrefix("10.0.0.0/8"),
+	}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	loaded := &InetEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, ent.Addr, loaded.Addr)
+	require.True(t, ent.Legacy.Equal(loaded.Legacy))
+	require.Equal(t, ent.Network, loaded.Network)
+
+	loaded.Addr = netip.Addr{}
+	loaded.Legacy = nil
+	require.NoError(t, Update(ctx, loaded, db))
+	require.NoError(t, Load(ctx, loaded, db))
+	require.False(t, loaded.Addr.IsValid())
+	require.Nil(t, loaded.Legacy)
+
+	subnet := &SubnetEntity{}
+	_, err = Insert(ctx, subnet, db)
+	require.NoError(t, err)
+	require.NoError(t, Load(ctx, subnet, db))
+	require.Nil(t, subnet.Network.IP)
+}
+
+type InetEntity struct {
+	ID      int          `db:"id,primaryKey,returningInsert"`
+	Addr    netip.Addr   `db:"addr"`
+	Legacy  net.IP       `db:"legacy"`
+	Network netip.Prefix `db:"network"`
+}
+
+func (ie InetEntity) TableName() string {
+	return "inet"
+}
+
+func (ie *InetEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type SubnetEntity struct {
+	ID      int       `db:"id,primaryKey,returningInsert"`
+	Network net.IPNet `db:"network"`
+}
+
+func (se SubnetEntity) TableName() string {
+	return "subnet"
+}
+
+func (se *SubnetEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build go1.23
+
+package entity
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// Iterate 逐行读取符合条件的entity，用于遍历大量数据而不需要一次全部载入内存
+// where条件可以为空，使用?作为参数占位符，同样适用entity的默认条件(DefaultScoper)
+// 查询不设置ReadTimeout，由ctx控制遍历的时间
+// 遍历结束或者提前break时关闭查询结果，发生错误时返回一次错误后结束遍历
+//
+//	for user, err := range entity.Iterate[*User](ctx, db, "status = ?", "active") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func Iterate[T Entity](ctx context.Context, db DB, where string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		md, err := getMetadata(newEntity[T]())
+		if err != nil {
+			yield(zero, fmt.Errorf("get metadata, %w", err))
+			return
+		}
+
+		scope, scopeArgs, err := scopeConds(ctx, newEntity[T](), md)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		driver := dbDriver(db)
+		b := newSelect(md, driver).column(columnNames(md.Columns)...)
+		if where != "" {
+			b.where("(" + where + ")")
+		}
+		stmt := b.where(notDeleted(md, driver)...).where(scope...).String()
+
+		rows, err := db.QueryxContext(ctx, rebind(db, stmt), append(args[:len(args):len(args)], scopeArgs...)...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			ent, result := newAddressable[T]()
+			if err := scanEntity(rows, ent); err != nil {
+				yield(zero, fmt.Errorf("scan struct, %w", err))
+				return
+			}
+
+			if !yield(result(), nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
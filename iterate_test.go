@@ -0,0 +1,60 @@
+//go:build go1.23
+
+package entity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterate(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+		`INSERT INTO score (id, team, points) VALUES (1, 'a', 10), (2, 'a', 30), (3, 'b', 20)`,
+	)
+	ctx := context.Background()
+
+	ids := []int{}
+	for ent, err := range Iterate[*ScoreEntity](ctx, db, "team = ?", "a") {
+		require.NoError(t, err)
+		ids = append(ids, ent.ID)
+	}
+	require.Equal(t, []int{1, 2}, ids)
+
+	ids = ids[:0]
+	for ent, err := range Iterate[*ScoreEntity](ctx, db, "") {
+		require.NoError(t, err)
+		ids = append(ids, ent.ID)
+		if len(ids) == 2 {
+			break
+		}
+	}
+	require.Equal(t, []int{1, 2}, ids)
+
+	// 提前break以后连接已经放回连接池
+	require.Equal(t, 0, db.Stats().InUse)
+
+	var lastErr error
+	for _, err := range Iterate[*ScoreEntity](ctx, db, "unknown = ?", 1) {
+		lastErr = err
+	}
+	require.Error(t, lastErr)
+	require.Equal(t, 0, db.Stats().InUse)
+}
+
+func TestIterateDefaultScope(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT)`,
+		`INSERT INTO tenant (id, tenant_id, name) VALUES (1, 1, 'foo'), (2, 2, 'foo'), (3, 1, 'bar')`,
+	)
+	ctx := context.WithValue(context.Background(), tenantKey{}, 1)
+
+	ids := []int{}
+	for ent, err := range Iterate[*TenantEntity](ctx, db, "id > ?", 0) {
+		require.NoError(t, err)
+		ids = append(ids, ent.ID)
+	}
+	require.ElementsMatch(t, []int{1, 3}, ids)
+}
@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// KeyLocker 按照entity主键加锁，串行化当前进程内对同一条记录的写操作
+// 用于热点记录的"读取-修改-写入"，减少数据库层面的锁竞争和死锁
+// 只在当前进程内有效，不是分布式锁，多个进程之间仍然需要依赖数据库锁或者乐观锁
+// 零值可以直接使用，使用之后不能复制
+type KeyLocker struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock 锁定entity主键对应的记录，返回解锁方法
+func (kl *KeyLocker) Lock(ent Entity) (unlock func(), err error) {
+	key, err := lockKey(ent)
+	if err != nil {
+		return nil, err
+	}
+
+	kl.mu.Lock()
+	if kl.locks == nil {
+		kl.locks = map[string]*keyLock{}
+	}
+	l, ok := kl.locks[key]
+	if !ok {
+		l = &keyLock{}
+		kl.locks[key] = l
+	}
+	l.refs++
+	kl.mu.Unlock()
+
+	l.mu.Lock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Unlock()
+
+			kl.mu.Lock()
+			defer kl.mu.Unlock()
+
+			if l.refs--; l.refs == 0 {
+				delete(kl.locks, key)
+			}
+		})
+	}, nil
+}
+
+// Do 在锁定entity主键的情况下执行fn
+func (kl *KeyLocker) Do(ent Entity, fn func() error) error {
+	unlock, err := kl.Lock(ent)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fn()
+}
+
+// 表名加上主键值作为锁的key
+func lockKey(ent Entity) (string, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return "", fmt.Errorf("get metadata, %w", err)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+
+	keys := []string{md.TableName}
+	for _, col := range md.PrimaryKeys {
+		keys = append(keys, fmt.Sprint(mapper.FieldByName(v, col.DBField).Interface()))
+	}
+	return strings.Join(keys, "\x00"), nil
+}
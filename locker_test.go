@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyLocker(t *testing.T) {
+	var kl KeyLocker
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := kl.Do(&MirrorEntity{ID: 1}, func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), maxRunning)
+	require.Empty(t, kl.locks)
+
+	// 不同的key可以同时持有锁
+	unlock, err := kl.Lock(&MirrorEntity{ID: 1})
+	require.NoError(t, err)
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		unlock, err := kl.Lock(&MirrorEntity{ID: 2})
+		require.NoError(t, err)
+		unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("lock different key blocked")
+	}
+}
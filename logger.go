@@ -0,0 +1,107 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type logFunc func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error)
+
+// LoggingMiddleware 记录entity读写操作执行的每条语句，通过Use()添加
+// query和args是绑定之后实际发送给数据库的语句和参数，dur为语句的执行时间，不包括读取结果的时间
+// log会在语句执行之后同步调用
+func LoggingMiddleware(log func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error)) func(next Handler) Handler {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op string, exec func() error) error {
+			o, ok := operationFrom(ctx)
+			if !ok {
+				return next(ctx, op, exec)
+			}
+
+			// 只在本次调用内有效，外层中间件重试时不会重复添加
+			n := len(o.loggers)
+			o.loggers = append(o.loggers, log)
+			defer func() { o.loggers = o.loggers[:n] }()
+
+			return next(ctx, op, exec)
+		}
+	}
+}
+
+// 执行语句时调用LoggingMiddleware日志方法的DB
+type loggedDB struct {
+	DB
+}
+
+// 日志方法在执行时从ctx读取，没有添加LoggingMiddleware时直接执行，不产生额外开销
+func withLogger(db DB) DB {
+	if _, ok := db.(loggedDB); ok {
+		return db
+	}
+	return loggedDB{DB: db}
+}
+
+func queryLoggers(ctx context.Context) []logFunc {
+	if o, ok := operationFrom(ctx); ok {
+		return o.loggers
+	}
+	return nil
+}
+
+func (db loggedDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	loggers := queryLoggers(ctx)
+	if len(loggers) == 0 {
+		return db.DB.QueryxContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	rows, err := db.DB.QueryxContext(ctx, query, args...)
+	for _, log := range loggers {
+		log(ctx, query, args, time.Since(start), err)
+	}
+	return rows, err
+}
+
+func (db loggedDB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	loggers := queryLoggers(ctx)
+	if len(loggers) == 0 {
+		return db.DB.QueryRowxContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	row := db.DB.QueryRowxContext(ctx, query, args...)
+	for _, log := range loggers {
+		log(ctx, query, args, time.Since(start), row.Err())
+	}
+	return row
+}
+
+func (db loggedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	loggers := queryLoggers(ctx)
+	if len(loggers) == 0 {
+		return db.DB.ExecContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	for _, log := range loggers {
+		log(ctx, query, args, time.Since(start), err)
+	}
+	return result, err
+}
+
+// 先绑定命名参数，记录的语句与参数和实际执行的一致
+func (db loggedDB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	if len(queryLoggers(ctx)) == 0 {
+		return db.DB.NamedExecContext(ctx, query, arg)
+	}
+
+	q, args, err := bindNamedDB(db.DB, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, q, args...)
+}
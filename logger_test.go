@@ -0,0 +1,78 @@
+package entity
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type loggedQuery struct {
+	query string
+	args  []interface{}
+	err   error
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var queries []loggedQuery
+	Use(LoggingMiddleware(func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error) {
+		queries = append(queries, loggedQuery{query: query, args: args, err: err})
+	}))
+	defer resetMiddlewares()
+
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NoError(t, Load(ctx, ent, db))
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, Delete(ctx, ent, db))
+
+	prefixes := []string{"INSERT", "SELECT", "UPDATE", "DELETE"}
+	require.Len(t, queries, len(prefixes))
+	for i, q := range queries {
+		require.True(t, strings.HasPrefix(q.query, prefixes[i]), q.query)
+		require.NoError(t, q.err)
+	}
+
+	// 记录的是绑定之后的位置参数
+	require.NotContains(t, queries[2].query, ":email")
+	require.Equal(t, []interface{}{"foo@example.com", "foo@example.com", ent.ID}, queries[2].args)
+
+	// 执行失败的语句同样记录
+	_, err = Insert(ctx, &SizedEntity{ID: 1}, db)
+	require.Error(t, err)
+	require.Len(t, queries, len(prefixes)+1)
+	require.Error(t, queries[len(prefixes)].err)
+
+	resetMiddlewares()
+	require.NoError(t, Save(ctx, &MirrorEntity{Email: "bar@example.com"}, db))
+	require.Len(t, queries, len(prefixes)+1)
+}
+
+// ForceDelete、Restore执行的语句同样记录
+func TestLoggingMiddlewareSoftDelete(t *testing.T) {
+	var queries []string
+	Use(LoggingMiddleware(func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error) {
+		queries = append(queries, query)
+	}))
+	defer resetMiddlewares()
+
+	db := newTestDB(t,
+		`CREATE TABLE soft_delete (id INTEGER PRIMARY KEY, name TEXT, deleted_at TIMESTAMP)`,
+		`INSERT INTO soft_delete (id, name, deleted_at) VALUES (1, 'foo', CURRENT_TIMESTAMP)`,
+	)
+	ctx := context.Background()
+
+	ent := &SoftDeleteEntity{ID: 1}
+	require.NoError(t, Restore(ctx, ent, db))
+	require.NoError(t, ForceDelete(ctx, ent, db))
+
+	require.Len(t, queries, 2)
+	require.True(t, strings.HasPrefix(queries[0], "UPDATE"), queries[0])
+	require.True(t, strings.HasPrefix(queries[1], "DELETE"), queries[1])
+}
@@ -0,0 +1,183 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+type columnMaskKey struct{}
+
+// WithColumnMask 限制ctx内的Load和Update只能读写allowed内的字段，用于字段级别的权限控制
+// Load只查询允许的字段，其它字段保持原值，并且不读取也不写入缓存，Update只写入允许的字段
+// 主键字段必须在允许范围内，否则返回错误
+func WithColumnMask(ctx context.Context, allowed []string) context.Context {
+	mask := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		mask[name] = true
+	}
+	return context.WithValue(ctx, columnMaskKey{}, mask)
+}
+
+// LoadedColumns 部分读取时实际读取了的字段，没有读取的字段值不可信，更新时应该跳过
+type LoadedColumns map[string]bool
+
+// Has 字段是否已经读取
+func (lc LoadedColumns) Has(column string) bool {
+	return lc[column]
+}
+
+// Columns 已经读取的字段名，按字段名排序
+func (lc LoadedColumns) Columns() []string {
+	names := make([]string, 0, len(lc))
+	for name := range lc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadColumns 从数据库只读取entity的部分字段，主键字段总是被读取，其它字段保持原值
+// 返回实际读取的字段，包括主键以及不受字段限制的版本号、更新时间字段
+// ctx内已有字段限制(WithColumnMask)时，columns和主键都必须在允许范围内，否则返回错误
+func LoadColumns(ctx context.Context, ent Entity, db DB, columns ...string) (LoadedColumns, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return nil, fmt.Errorf("get metadata, %w", err)
+	}
+
+	allowed := make([]string, 0, len(md.PrimaryKeys)+len(columns))
+	for _, col := range md.PrimaryKeys {
+		allowed = append(allowed, col.DBField)
+	}
+	for _, name := range columns {
+		if _, ok := md.Column(name); !ok {
+			return nil, fmt.Errorf("entity %q, unknown column %q", md.Type, name)
+		}
+		allowed = append(allowed, name)
+	}
+
+	ctx, err = restrictColumnMask(ctx, md, allowed)
+	if err != nil {
+		return nil, err
+	}
+	mmd, _, err := maskMetadata(ctx, md)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	if err := doLoad(ctx, ent, db); err != nil {
+		return nil, err
+	} else if err := ent.OnEntityEvent(ctx, EventAfterLoad); err != nil {
+		return nil, fmt.Errorf("after load, %w", err)
+	}
+
+	loaded := make(LoadedColumns, len(mmd.Columns))
+	for _, col := range mmd.Columns {
+		loaded[col.DBField] = true
+	}
+	return loaded, nil
+}
+
+// UpdateColumns 只更新entity的部分字段，SET子句只包含columns以及版本号、更新时间字段
+// 用于只修改个别字段的场景，避免覆盖其它字段上并发写入的数据
+// columns不能为空，不能包含主键或refuseUpdate字段，未知字段返回错误
+// ctx内已有字段限制(WithColumnMask)时，columns必须在允许范围内，否则返回错误
+func UpdateColumns(ctx context.Context, ent Entity, db DB, columns ...string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("empty update columns")
+	}
+
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	allowed := make([]string, 0, len(md.PrimaryKeys)+len(columns))
+	for _, col := range md.PrimaryKeys {
+		allowed = append(allowed, col.DBField)
+	}
+	for _, name := range columns {
+		col, ok := md.Column(name)
+		if !ok {
+			return fmt.Errorf("entity %q, unknown column %q", md.Type, name)
+		} else if col.PrimaryKey || col.RefuseUpdate {
+			return fmt.Errorf("entity %q, column %q refuse update", md.Type, name)
+		}
+		allowed = append(allowed, name)
+	}
+
+	ctx, err = restrictColumnMask(ctx, md, allowed)
+	if err != nil {
+		return err
+	}
+	return update(ctx, ent, db, func(ctx context.Context) error {
+		return doUpdate(ctx, ent, db)
+	})
+}
+
+// 在ctx已有的字段限制范围内进一步限制为columns，不能扩大调用方的权限
+// columns内有ctx不允许的字段时返回错误
+func restrictColumnMask(ctx context.Context, md *Metadata, columns []string) (context.Context, error) {
+	if mask, ok := ctx.Value(columnMaskKey{}).(map[string]bool); ok {
+		for _, name := range columns {
+			if !mask[name] {
+				return nil, fmt.Errorf("entity %q, column %q is masked", md.Type, name)
+			}
+		}
+	}
+	return WithColumnMask(ctx, columns), nil
+}
+
+// ctx内是否有字段限制
+func hasColumnMask(ctx context.Context) bool {
+	_, ok := ctx.Value(columnMaskKey{}).(map[string]bool)
+	return ok
+}
+
+// 按照ctx内的字段限制返回新的元数据，ctx内没有字段限制时返回false
+func maskMetadata(ctx context.Context, md *Metadata) (*Metadata, bool, error) {
+	mask, ok := ctx.Value(columnMaskKey{}).(map[string]bool)
+	if !ok {
+		return md, false, nil
+	}
+
+	for _, col := range md.PrimaryKeys {
+		if !mask[col.DBField] {
+			return nil, false, fmt.Errorf("entity %q, primary key %q is masked", md.Type, col.DBField)
+		}
+	}
+
+	mmd := *md
+	mmd.Columns = []Column{}
+	mmd.hasReturningInsert = false
+	mmd.hasReturningUpdate = false
+	for _, col := range md.Columns {
+		// 版本号及更新时间字段不受限制，保证乐观锁和更新时间在字段限制下仍然有效
+		if !mask[col.DBField] && !col.Version && !col.Updated {
+			continue
+		}
+
+		mmd.Columns = append(mmd.Columns, col)
+		if col.ReturningInsert {
+			mmd.hasReturningInsert = true
+		}
+		if col.ReturningUpdate {
+			mmd.hasReturningUpdate = true
+		}
+	}
+
+	return &mmd, true, nil
+}
+
+func hasUpdateColumn(md *Metadata) bool {
+	for _, col := range md.Columns {
+		if !col.RefuseUpdate && !col.ReturningUpdate && !col.Version && !col.Updated {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnMask(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE sized (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT)`,
+		`INSERT INTO sized (id, name, nickname) VALUES (1, 'foo', 'bar')`,
+	)
+	ctx := context.Background()
+
+	ent := &SizedEntity{ID: 1, Nickname: sql.NullString{String: "keep", Valid: true}}
+	require.NoError(t, Load(WithColumnMask(ctx, []string{"id", "name"}), ent, db))
+	require.Equal(t, "foo", ent.Name)
+	require.Equal(t, "keep", ent.Nickname.String)
+
+	ent = &SizedEntity{ID: 1, Name: "baz", Nickname: sql.NullString{String: "new", Valid: true}}
+	require.NoError(t, Update(WithColumnMask(ctx, []string{"id", "nickname"}), ent, db))
+
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo", ent.Name)
+	require.Equal(t, "new", ent.Nickname.String)
+
+	require.Error(t, Load(WithColumnMask(ctx, []string{"name"}), ent, db))
+	require.Error(t, Update(WithColumnMask(ctx, []string{"id"}), ent, db))
+
+	// 字段限制不影响缓存的语句
+	ent = &SizedEntity{ID: 1}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo", ent.Name)
+	require.Equal(t, "new", ent.Nickname.String)
+}
+
+func TestLoadColumns(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE sized (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT)`,
+		`INSERT INTO sized (id, name, nickname) VALUES (1, 'foo', '')`,
+	)
+	ctx := context.Background()
+
+	ent := &SizedEntity{ID: 1, Name: "keep"}
+	loaded, err := LoadColumns(ctx, ent, db, "nickname")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "nickname"}, loaded.Columns())
+	require.True(t, loaded.Has("nickname"))
+	require.False(t, loaded.Has("name"))
+
+	// 读取到的零值与没有读取的字段可以区分
+	require.Equal(t, "", ent.Nickname.String)
+	require.Equal(t, "keep", ent.Name)
+
+	_, err = LoadColumns(ctx, ent, db, "unknown")
+	require.Error(t, err)
+
+	_, err = LoadColumns(ctx, &SizedEntity{ID: 2}, db, "name")
+	require.True(t, errors.Is(err, sql.ErrNoRows))
+
+	// 不能读取调用方字段限制以外的字段
+	masked := WithColumnMask(ctx, []string{"id", "nickname"})
+	ent = &SizedEntity{ID: 1}
+	_, err = LoadColumns(masked, ent, db, "name")
+	require.Error(t, err)
+	require.Equal(t, "", ent.Name)
+
+	loaded, err = LoadColumns(masked, ent, db, "nickname")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "nickname"}, loaded.Columns())
+}
+
+func TestUpdateColumns(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE sized (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT)`,
+		`INSERT INTO sized (id, name, nickname) VALUES (1, 'foo', 'bar')`,
+	)
+	ctx := context.Background()
+
+	// 其它字段即使是过期的值也不会被写入
+	ent := &SizedEntity{ID: 1, Name: "stale", Nickname: sql.NullString{String: "new", Valid: true}}
+	require.NoError(t, UpdateColumns(ctx, ent, db, "nickname"))
+
+	ent = &SizedEntity{ID: 1}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo", ent.Name)
+	require.Equal(t, "new", ent.Nickname.String)
+
+	require.Error(t, UpdateColumns(ctx, ent, db))
+	require.Error(t, UpdateColumns(ctx, ent, db, "unknown"))
+	require.Error(t, UpdateColumns(ctx, ent, db, "id"))
+
+	err := UpdateColumns(ctx, &SizedEntity{ID: 2}, db, "name")
+	require.True(t, errors.Is(err, sql.ErrNoRows))
+
+	// 不能写入调用方字段限制以外的字段
+	masked := WithColumnMask(ctx, []string{"id", "nickname"})
+	ent = &SizedEntity{ID: 1, Name: "forbidden", Nickname: sql.NullString{String: "ok", Valid: true}}
+	require.Error(t, UpdateColumns(masked, ent, db, "name"))
+	require.NoError(t, UpdateColumns(masked, ent, db, "nickname"))
+
+	ent = &SizedEntity{ID: 1}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "foo", ent.Name)
+	require.Equal(t, "ok", ent.Nickname.String)
+}
@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"context"
+	"time"
+)
+
+// MetricsCollector 数据库操作耗时统计，例如记录到prometheus的histogram，用于统计各个表的p99延迟
+// op为OpLoad、OpInsert等操作类型，table为entity的表名
+// d为MetricsMiddleware内层中间件以及数据库操作的执行时间，执行失败的操作同样会统计
+// Observe会在每次数据库操作之后同步调用，实现时不能有耗时的操作
+type MetricsCollector interface {
+	Observe(op, table string, d time.Duration)
+}
+
+// MetricsMiddleware 把每次数据库操作的耗时交给c统计，通过Use()添加
+// 需要统计其它中间件的耗时，应该先于这些中间件添加
+func MetricsMiddleware(c MetricsCollector) func(next Handler) Handler {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op string, exec func() error) error {
+			start := time.Now()
+			err := next(ctx, op, exec)
+
+			var table string
+			if o, ok := operationFrom(ctx); ok {
+				table = o.table
+			}
+			c.Observe(op, table, time.Since(start))
+			return err
+		}
+	}
+}
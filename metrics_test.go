@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type observation struct {
+	op    string
+	table string
+	d     time.Duration
+}
+
+type recordCollector struct {
+	mu   sync.Mutex
+	list []observation
+}
+
+func (c *recordCollector) Observe(op, table string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.list = append(c.list, observation{op: op, table: table, d: d})
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	c := &recordCollector{}
+	Use(MetricsMiddleware(c))
+	defer resetMiddlewares()
+
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NoError(t, Load(ctx, ent, db))
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, Delete(ctx, ent, db))
+
+	// 执行失败的操作同样统计
+	require.Error(t, Load(ctx, &MirrorEntity{ID: ent.ID}, db))
+
+	ops := []string{OpInsert, OpLoad, OpUpdate, OpDelete, OpLoad}
+	require.Len(t, c.list, len(ops))
+	for i, o := range c.list {
+		require.Equal(t, ops[i], o.op)
+		require.Equal(t, "mirror", o.table)
+		require.True(t, o.d > 0, "%s duration should be positive", o.op)
+	}
+
+	resetMiddlewares()
+	require.NoError(t, Save(ctx, &MirrorEntity{Email: "bar@example.com"}, db))
+	require.Len(t, c.list, len(ops))
+}
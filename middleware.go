@@ -0,0 +1,92 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// 数据库操作类型，传递给Handler的op参数
+const (
+	OpLoad   = "load"
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	OpUpsert = "upsert"
+)
+
+var (
+	middlewares  []func(next Handler) Handler
+	middlewareMu sync.Mutex
+	handler      atomic.Value
+)
+
+// Handler 数据库操作处理方法，exec执行实际的数据库操作
+type Handler func(ctx context.Context, op string, exec func() error) error
+
+// 当前数据库操作的信息，由handle()放入ctx，内置中间件通过ctx读取或修改
+type operation struct {
+	table string
+	// LoggingMiddleware添加的日志方法，执行语句时调用
+	loggers []logFunc
+}
+
+type operationKey struct{}
+
+func operationFrom(ctx context.Context) (*operation, bool) {
+	o, ok := ctx.Value(operationKey{}).(*operation)
+	return o, ok
+}
+
+func init() {
+	handler.Store(Handler(execHandler))
+}
+
+// Use 添加中间件，用于在所有数据库操作上实现日志、监控、重试等通用逻辑
+// 内置了LoggingMiddleware、MetricsMiddleware，例如 Use(MetricsMiddleware(c), LoggingMiddleware(log))
+// 先添加的中间件在外层，先于后添加的中间件执行
+// 中间件应该在程序初始化阶段添加
+func Use(mw ...func(next Handler) Handler) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+
+	middlewares = append(middlewares, mw...)
+
+	h := Handler(execHandler)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	handler.Store(h)
+}
+
+func execHandler(ctx context.Context, op string, exec func() error) error {
+	return exec()
+}
+
+// table用于耗时统计及链路追踪，见MetricsMiddleware、SetTracer
+// exec使用span所在的ctx执行，数据库驱动可以在同一条链路上记录子span
+// 日志、耗时统计等都由中间件实现，handle只执行中间件链
+func handle(ctx context.Context, db DB, op string, table string, exec func(ctx context.Context) error) (err error) {
+	end, err := beginOperation()
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	ctx = context.WithValue(ctx, operationKey{}, &operation{table: table})
+	ctx, endSpan := startSpan(ctx, db, op, table)
+	defer func() {
+		// panic时同样结束span，然后继续panic
+		if r := recover(); r != nil {
+			endSpan(fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+		endSpan(err)
+	}()
+
+	err = handler.Load().(Handler)(ctx, op, func() error {
+		return exec(ctx)
+	})
+	return classifyError(db, err)
+}
@@ -0,0 +1,110 @@
+package entity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	defer resetMiddlewares()
+
+	calls := []string{}
+	record := func(name string) func(next Handler) Handler {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, op string, exec func() error) error {
+				calls = append(calls, name+" before "+op)
+				err := next(ctx, op, exec)
+				calls = append(calls, name+" after "+op)
+				return err
+			}
+		}
+	}
+
+	Use(record("outer"))
+	Use(record("inner"))
+
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NoError(t, Load(ctx, ent, db))
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, Delete(ctx, ent, db))
+
+	expected := []string{}
+	for _, op := range []string{OpInsert, OpLoad, OpUpdate, OpDelete} {
+		expected = append(expected,
+			"outer before "+op,
+			"inner before "+op,
+			"inner after "+op,
+			"outer after "+op,
+		)
+	}
+	require.Equal(t, expected, calls)
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	defer resetMiddlewares()
+
+	Use(func(next Handler) Handler {
+		return func(ctx context.Context, op string, exec func() error) error {
+			if op == OpDelete {
+				return context.Canceled
+			}
+			return next(ctx, op, exec)
+		}
+	})
+
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.Equal(t, context.Canceled, Delete(ctx, ent, db))
+	require.NoError(t, Load(ctx, ent, db))
+}
+
+// 内置的日志和耗时统计中间件可以与其它中间件一起组合
+func TestBuiltinMiddlewares(t *testing.T) {
+	defer resetMiddlewares()
+
+	c := &recordCollector{}
+	var queries []string
+	Use(
+		MetricsMiddleware(c),
+		// 内层中间件重试时，日志不会重复记录
+		func(next Handler) Handler {
+			return func(ctx context.Context, op string, exec func() error) error {
+				if err := next(ctx, op, exec); err != nil {
+					return err
+				}
+				return next(ctx, op, exec)
+			}
+		},
+		LoggingMiddleware(func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error) {
+			queries = append(queries, query)
+		}),
+	)
+
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (id, email, email_copy) VALUES (1, 'foo@example.com', 'foo@example.com')`,
+	)
+	require.NoError(t, Load(context.Background(), &MirrorEntity{ID: 1}, db))
+
+	require.Len(t, c.list, 1)
+	require.Equal(t, OpLoad, c.list[0].op)
+	require.Equal(t, "mirror", c.list[0].table)
+	require.Len(t, queries, 2)
+}
+
+func resetMiddlewares() {
+	middlewares = nil
+	handler.Store(Handler(execHandler))
+}
@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CallProc 执行存储过程，按顺序把每个结果集读取到dests内
+// proc为CALL之后的部分，参数使用命名参数，例如CallProc(ctx, db, "user_report(:since)", args, &users, &total)
+// dest为slice指针时读取结果集的所有行，否则只读取第一行，struct按照db tag读取，其它类型直接Scan
+// 依赖驱动的多结果集支持(sql.Rows.NextResultSet)，mysql驱动需要开启multiStatements
+// postgresql的存储过程不能直接返回结果集，sqlite不支持存储过程
+func CallProc(ctx context.Context, db DB, proc string, args map[string]interface{}, dests ...interface{}) error {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+
+	stmt, params, err := sqlx.Named("CALL "+proc, args)
+	if err != nil {
+		return fmt.Errorf("bind named, %w", err)
+	}
+
+	rows, err := db.QueryxContext(ctx, rebind(db, stmt), params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for i, dest := range dests {
+		if i > 0 && !rows.NextResultSet() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("call %s, missing result set %d", proc, i)
+		}
+
+		if err := scanResultSet(rows, dest); err != nil {
+			return fmt.Errorf("call %s, result set %d, %w", proc, i, err)
+		}
+	}
+
+	return rows.Err()
+}
+
+// 把当前结果集读取到dest
+func scanResultSet(rows *sqlx.Rows, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("dest must be a non-nil pointer, got %T", dest)
+	}
+
+	if v.Elem().Kind() == reflect.Slice && v.Elem().Type().Elem().Kind() != reflect.Uint8 {
+		return sqlx.StructScan(rows, dest)
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	if ent, ok := dest.(Entity); ok {
+		return scanEntity(rows, ent)
+	} else if isStructDest(v.Type().Elem()) {
+		return rows.StructScan(dest)
+	}
+	return rows.Scan(dest)
+}
+
+// struct按照db tag读取，实现了sql.Scanner或者没有可读取字段的struct(例如time.Time)直接Scan
+func isStructDest(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()) {
+		return false
+	}
+	return len(mapper.TypeMap(t).Index) > 0
+}
@@ -0,0 +1,147 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallProc(t *testing.T) {
+	db, err := sqlx.Open("procmock", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	var (
+		mirrors []*MirrorEntity
+		total   int
+	)
+	err = CallProc(ctx, db, "mirror_report(:email)", map[string]interface{}{"email": "foo@example.com"}, &mirrors, &total)
+	require.NoError(t, err)
+	require.Equal(t, "CALL mirror_report(?)", procMock.query)
+	require.Equal(t, []driver.Value{"foo@example.com"}, procMock.args)
+
+	require.Len(t, mirrors, 2)
+	require.Equal(t, int64(1), mirrors[0].ID)
+	require.Equal(t, "foo@example.com", mirrors[0].Email)
+	require.Equal(t, "bar@example.com", mirrors[1].Email)
+	require.Equal(t, 2, total)
+
+	var first MirrorEntity
+	require.NoError(t, CallProc(ctx, db, "mirror_report(:email)", map[string]interface{}{"email": "foo@example.com"}, &first))
+	require.Equal(t, "foo@example.com", first.Email)
+
+	err = CallProc(ctx, db, "mirror_report(:email)", map[string]interface{}{"email": "foo@example.com"}, &mirrors, &total, &total)
+	require.Error(t, err)
+}
+
+// 模拟返回多个结果集的存储过程
+var procMock = &procDriver{}
+
+func init() {
+	sql.Register("procmock", procMock)
+}
+
+type procDriver struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *procDriver) Open(name string) (driver.Conn, error) {
+	return procConn{d}, nil
+}
+
+type procConn struct {
+	d *procDriver
+}
+
+func (c procConn) Prepare(query string) (driver.Stmt, error) {
+	return procStmt{d: c.d, query: query}, nil
+}
+
+func (c procConn) Close() error {
+	return nil
+}
+
+func (c procConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+type procStmt struct {
+	d     *procDriver
+	query string
+}
+
+func (s procStmt) Close() error {
+	return nil
+}
+
+func (s procStmt) NumInput() int {
+	return -1
+}
+
+func (s procStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s procStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.query, s.d.args = s.query, args
+	return &procRows{sets: []procResultSet{
+		{
+			columns: []string{"id", "email"},
+			rows:    [][]driver.Value{{int64(1), "foo@example.com"}, {int64(2), "bar@example.com"}},
+		},
+		{
+			columns: []string{"total"},
+			rows:    [][]driver.Value{{int64(2)}},
+		},
+	}}, nil
+}
+
+type procResultSet struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+type procRows struct {
+	sets []procResultSet
+	set  int
+	row  int
+}
+
+func (r *procRows) Columns() []string {
+	return r.sets[r.set].columns
+}
+
+func (r *procRows) Close() error {
+	return nil
+}
+
+func (r *procRows) Next(dest []driver.Value) error {
+	rows := r.sets[r.set].rows
+	if r.row >= len(rows) {
+		return io.EOF
+	}
+	copy(dest, rows[r.row])
+	r.row++
+	return nil
+}
+
+func (r *procRows) HasNextResultSet() bool {
+	return r.set+1 < len(r.sets)
+}
+
+func (r *procRows) NextResultSet() error {
+	if !r.HasNextResultSet() {
+		return io.EOF
+	}
+	r.set, r.row = r.set+1, 0
+	return nil
+}
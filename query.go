@@ -0,0 +1,452 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Exists 按entity已经设置的主键检查记录是否存在，只查询常量不读取整行数据
+// 记录不存在时返回false，不返回sql.ErrNoRows
+func Exists(ctx context.Context, ent Entity, db DB) (bool, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return false, fmt.Errorf("get metadata, %w", err)
+	}
+
+	allocEmbedded(ent, md)
+
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	driver := dbDriver(db)
+	stmt := newSelect(md, driver).
+		expr("1").
+		where(primaryKeyWhere(md, driver)).
+		where(notDeleted(md, driver)...).
+		where(scope...).
+		limit(1).
+		String()
+
+	rows, err := namedQuery(ctx, db, stmt, arg)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return true, nil
+	}
+	return false, rows.Err()
+}
+
+// ExistsWhere 检查entity对应的表内是否存在符合条件的记录
+// where条件使用?作为参数占位符，同样适用entity的默认条件(DefaultScoper)
+func ExistsWhere(ctx context.Context, ent Entity, db DB, where string, args ...interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	md, err := getMetadata(ent)
+	if err != nil {
+		return false, fmt.Errorf("get metadata, %w", err)
+	}
+
+	scope, scopeArgs, err := scopeConds(ctx, ent, md)
+	if err != nil {
+		return false, err
+	}
+	stmt := rebind(db, existsStatement(md, dbDriver(db), where, scope...))
+
+	var v int
+	if err := db.QueryRowxContext(ctx, stmt, append(args[:len(args):len(args)], scopeArgs...)...).Scan(&v); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Query 执行自定义查询，把结果按照db tag写入R类型的对象内
+// 用于JOIN或者只查询部分字段的读模型，R不需要实现Entity接口，但是查询结果的字段名必须与R的db tag一致
+// R可以是struct或者struct指针，例如Query[User]()返回[]User，Query[*User]()返回[]*User
+// 查询语句使用?作为参数占位符
+func Query[R any](ctx context.Context, db DB, query string, args ...interface{}) ([]R, error) {
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	result := []R{}
+	if err := sqlx.SelectContext(ctx, db, &result, rebind(db, query), args...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListOption List的查询参数
+type ListOption func(*listOptions)
+
+type listOptions struct {
+	orderBy []string
+	limit   int
+	offset  int
+}
+
+// WithOrderBy 查询结果排序，每一项为字段名，可以加上ASC或DESC，例如"create_at DESC"
+func WithOrderBy(orders ...string) ListOption {
+	return func(o *listOptions) {
+		o.orderBy = append(o.orderBy, orders...)
+	}
+}
+
+// WithLimit 限制返回的记录数
+func WithLimit(n int) ListOption {
+	return func(o *listOptions) {
+		o.limit = n
+	}
+}
+
+// WithOffset 跳过前n条记录，mysql及sqlite必须同时使用WithLimit
+func WithOffset(n int) ListOption {
+	return func(o *listOptions) {
+		o.offset = n
+	}
+}
+
+// List 按字段值查询多条entity，where的key为数据库字段名，多个条件使用AND连接，值为nil时匹配NULL
+// where为空时查询所有记录，分页时应该同时使用WithOrderBy保证结果顺序稳定，同样适用entity的默认条件(DefaultScoper)
+//
+//	var users []*User
+//	err := entity.List(ctx, db, &users, map[string]interface{}{"status": "active"}, entity.WithOrderBy("id"), entity.WithLimit(20), entity.WithOffset(40))
+func List[T Entity](ctx context.Context, db DB, dest *[]T, where map[string]interface{}, opts ...ListOption) error {
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	opt := listOptions{}
+	for _, fn := range opts {
+		fn(&opt)
+	}
+
+	scope, params, err := scopeParams(ctx, newEntity[T](), md, where)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := listStatement(md, dbDriver(db), where, opt, scope...)
+	if err != nil {
+		return err
+	}
+
+	stmt, args, err := sqlx.Named(stmt, params)
+	if err != nil {
+		return fmt.Errorf("bind where, %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	rows, err := selectEntities[T](ctx, db, rebind(db, stmt), args...)
+	if err != nil {
+		return err
+	}
+	*dest = rows
+	return nil
+}
+
+// scope为默认条件，使用命名参数
+func listStatement(md *Metadata, driver string, where map[string]interface{}, opt listOptions, scope ...string) (string, error) {
+	if opt.limit < 0 {
+		return "", fmt.Errorf("entity %q, invalid limit %d", md.Type, opt.limit)
+	} else if opt.offset < 0 {
+		return "", fmt.Errorf("entity %q, invalid offset %d", md.Type, opt.offset)
+	} else if opt.offset > 0 && opt.limit == 0 && driver != driverPostgres && driver != driverSqlserver {
+		return "", fmt.Errorf("entity %q, driver %q requires limit with offset", md.Type, driver)
+	}
+
+	orders, err := orderByExprs(md, driver, opt.orderBy)
+	if err != nil {
+		return "", err
+	}
+
+	conds, err := columnConds(md, driver, where)
+	if err != nil {
+		return "", err
+	}
+
+	return newSelect(md, driver).
+		column(columnNames(md.Columns)...).
+		where(conds...).
+		where(notDeleted(md, driver)...).
+		where(scope...).
+		orderBy(orders...).
+		limit(opt.limit).
+		offset(opt.offset).
+		String(), nil
+}
+
+// Count 按字段值统计entity的记录数，where的规则与List相同，where为空时统计所有记录
+// 同样适用entity的默认条件(DefaultScoper)
+func Count(ctx context.Context, ent Entity, db DB, where map[string]interface{}) (int64, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return 0, fmt.Errorf("get metadata, %w", err)
+	}
+
+	driver := dbDriver(db)
+	conds, err := columnConds(md, driver, where)
+	if err != nil {
+		return 0, err
+	}
+
+	scope, params, err := scopeParams(ctx, ent, md, where)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, args, err := sqlx.Named(
+		newSelect(md, driver).
+			expr("COUNT(*)").
+			where(conds...).
+			where(notDeleted(md, driver)...).
+			where(scope...).
+			String(),
+		params,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("bind where, %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	var n int64
+	if err := db.QueryRowxContext(ctx, rebind(db, stmt), args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// 按字段值生成的查询条件，字段名必须是entity的字段，按字段名排序保证语句稳定
+func columnConds(md *Metadata, driver string, where map[string]interface{}) ([]string, error) {
+	names := make([]string, 0, len(where))
+	for name := range where {
+		if _, ok := md.Column(name); !ok {
+			return nil, fmt.Errorf("entity %q, unknown where column %q", md.Type, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	conds := make([]string, 0, len(names))
+	for _, name := range names {
+		if where[name] == nil {
+			conds = append(conds, quoteColumn(name, driver)+" IS NULL")
+		} else {
+			conds = append(conds, fmt.Sprintf("%s = :%s", quoteColumn(name, driver), name))
+		}
+	}
+	return conds, nil
+}
+
+// LoadManyOrdered 按照主键批量读取entity，结果顺序与ids一致
+// 只支持单一主键的entity，数据库内不存在的id会被跳过
+func LoadManyOrdered[T Entity, K comparable](ctx context.Context, db DB, dest *[]T, ids []K) error {
+	*dest = []T{}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	} else if len(md.PrimaryKeys) != 1 {
+		return fmt.Errorf("entity %q, load many requires single primary key", md.Type)
+	}
+
+	rows, err := selectByIDs[T](ctx, db, md, ids)
+	if err != nil {
+		return err
+	}
+
+	pk := md.PrimaryKeys[0]
+	kt := reflect.TypeOf((*K)(nil)).Elem()
+	found := make(map[K]T, len(rows))
+	for _, row := range rows {
+		f := mapper.FieldByName(reflect.Indirect(reflect.ValueOf(row)), pk.DBField)
+		if !f.Type().ConvertibleTo(kt) {
+			return fmt.Errorf("entity %q, primary key %q can not convert to %s", md.Type, pk.DBField, kt)
+		}
+		found[f.Convert(kt).Interface().(K)] = row
+	}
+
+	for _, id := range ids {
+		if row, ok := found[id]; ok {
+			*dest = append(*dest, row)
+		}
+	}
+	return nil
+}
+
+// FindByIDs 按照主键批量读取entity，只支持单一主键的entity
+// 结果顺序由数据库决定，需要与ids顺序一致时使用LoadManyOrdered，ids为空时不查询数据库
+func FindByIDs[T Entity](ctx context.Context, db DB, dest *[]T, ids []interface{}) error {
+	*dest = []T{}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	} else if len(md.PrimaryKeys) != 1 {
+		return fmt.Errorf("entity %q, find by ids requires single primary key", md.Type)
+	}
+
+	rows, err := selectByIDs[T](ctx, db, md, ids)
+	if err != nil {
+		return err
+	}
+	*dest = rows
+	return nil
+}
+
+// 使用IN查询单一主键的entity，ids必须是slice，同样适用entity的默认条件
+func selectByIDs[T Entity](ctx context.Context, db DB, md *Metadata, ids interface{}) ([]T, error) {
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	scope, scopeArgs, err := scopeConds(ctx, newEntity[T](), md)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := dbDriver(db)
+	stmt, args, err := sqlx.In(
+		newSelect(md, driver).
+			column(columnNames(md.Columns)...).
+			where(fmt.Sprintf("%s IN (?)", quoteColumn(md.PrimaryKeys[0].DBField, driver))).
+			where(notDeleted(md, driver)...).
+			where(scope...).
+			String(),
+		append([]interface{}{ids}, scopeArgs...)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("bind ids, %w", err)
+	}
+
+	return selectEntities[T](ctx, db, rebind(db, stmt), args...)
+}
+
+// SelectRanked 按partitionBy分组，每组按orderBy排序后取前topN条记录，结果按分组及组内顺序排列
+// orderBy的每一项为字段名，可以加上ASC或DESC，例如"create_at DESC"
+// where条件可以为空，使用?作为参数占位符，同样适用entity的默认条件(DefaultScoper)
+func SelectRanked[T Entity](ctx context.Context, db DB, dest *[]T, partitionBy []string, orderBy []string, topN int, where string, args ...interface{}) error {
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	scope, scopeArgs, err := scopeConds(ctx, newEntity[T](), md)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := rankedStatement(md, dbDriver(db), partitionBy, orderBy, topN, where, scope...)
+	if err != nil {
+		return err
+	}
+	args = append(args[:len(args):len(args)], scopeArgs...)
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	rows, err := selectEntities[T](ctx, db, rebind(db, stmt), args...)
+	if err != nil {
+		return err
+	}
+	*dest = rows
+	return nil
+}
+
+// scope为已经绑定了参数的默认条件，放在where之后
+func rankedStatement(md *Metadata, driver string, partitionBy []string, orderBy []string, topN int, where string, scope ...string) (string, error) {
+	if topN <= 0 {
+		return "", fmt.Errorf("entity %q, invalid top n %d", md.Type, topN)
+	} else if len(orderBy) == 0 {
+		return "", fmt.Errorf("entity %q, ranking requires order by", md.Type)
+	}
+
+	partitions := make([]string, 0, len(partitionBy))
+	for _, name := range partitionBy {
+		if _, ok := md.Column(name); !ok {
+			return "", fmt.Errorf("entity %q, unknown partition column %q", md.Type, name)
+		}
+		partitions = append(partitions, quoteColumn(name, driver))
+	}
+
+	orders, err := orderByExprs(md, driver, orderBy)
+	if err != nil {
+		return "", err
+	}
+
+	over := "ORDER BY " + strings.Join(orders, ", ")
+	if len(partitions) > 0 {
+		over = "PARTITION BY " + strings.Join(partitions, ", ") + " " + over
+	}
+
+	inner := newSelect(md, driver).
+		column(columnNames(md.Columns)...).
+		expr(fmt.Sprintf("ROW_NUMBER() OVER (%s) AS entity_rank", over))
+	if where != "" {
+		inner.where(where)
+	}
+	inner.where(notDeleted(md, driver)...).where(scope...)
+
+	return fmt.Sprintf(
+		"WITH ranked AS (%s) SELECT %s FROM ranked WHERE entity_rank <= %d ORDER BY %s",
+		inner,
+		columnList(md, driver),
+		topN,
+		strings.Join(append(partitions, "entity_rank"), ", "),
+	), nil
+}
+
+// 检查并转换ORDER BY的每一项，格式为字段名，可以加上ASC或DESC
+func orderByExprs(md *Metadata, driver string, orderBy []string) ([]string, error) {
+	orders := make([]string, 0, len(orderBy))
+	for _, order := range orderBy {
+		parts := strings.Fields(order)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("entity %q, invalid order by %q", md.Type, order)
+		} else if _, ok := md.Column(parts[0]); !ok {
+			return nil, fmt.Errorf("entity %q, unknown order column %q", md.Type, parts[0])
+		}
+
+		expr := quoteColumn(parts[0], driver)
+		if len(parts) == 2 {
+			dir := strings.ToUpper(parts[1])
+			if dir != "ASC" && dir != "DESC" {
+				return nil, fmt.Errorf("entity %q, invalid order direction %q", md.Type, parts[1])
+			}
+			expr += " " + dir
+		}
+		orders = append(orders, expr)
+	}
+	return orders, nil
+}
+
+func existsStatement(md *Metadata, driver string, where string, scope ...string) string {
+	return newSelect(md, driver).expr("1").where(where).where(notDeleted(md, driver)...).where(scope...).limit(1).String()
+}
@@ -0,0 +1,282 @@
+package entity
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistsWhere(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (email) VALUES ('foo@example.com')`,
+	)
+	ctx := context.Background()
+
+	exists, err := ExistsWhere(ctx, &MirrorEntity{}, db, "email = ?", "foo@example.com")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = ExistsWhere(ctx, &MirrorEntity{}, db, "email = ?", "bar@example.com")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestLoadManyOrdered(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (id, email) VALUES (1, 'a@example.com'), (2, 'b@example.com'), (3, 'c@example.com')`,
+	)
+	ctx := context.Background()
+
+	var result []*MirrorEntity
+	require.NoError(t, LoadManyOrdered(ctx, db, &result, []int64{3, 9, 1, 2}))
+
+	emails := []string{}
+	for _, ent := range result {
+		emails = append(emails, ent.Email)
+	}
+	require.Equal(t, []string{"c@example.com", "a@example.com", "b@example.com"}, emails)
+
+	require.NoError(t, LoadManyOrdered(ctx, db, &result, []int{}))
+	require.Empty(t, result)
+}
+
+func TestFindByIDs(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (id, email) VALUES (1, 'a@example.com'), (2, 'b@example.com'), (3, 'c@example.com')`,
+	)
+	ctx := context.Background()
+
+	var result []*MirrorEntity
+	require.NoError(t, FindByIDs(ctx, db, &result, []interface{}{3, 9, 1}))
+
+	emails := []string{}
+	for _, ent := range result {
+		emails = append(emails, ent.Email)
+	}
+	sort.Strings(emails)
+	require.Equal(t, []string{"a@example.com", "c@example.com"}, emails)
+
+	require.NoError(t, FindByIDs(ctx, db, &result, nil))
+	require.NotNil(t, result)
+	require.Empty(t, result)
+
+	var composite []*GenernalEntity
+	require.Error(t, FindByIDs(ctx, db, &composite, []interface{}{1}))
+}
+
+func TestQuery(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`CREATE TABLE nullable_key (code TEXT NOT NULL, region TEXT, name TEXT)`,
+		`INSERT INTO mirror (id, email) VALUES (1, 'foo@example.com'), (2, 'bar@example.com')`,
+		`INSERT INTO nullable_key (code, name) VALUES ('foo@example.com', 'foo')`,
+	)
+
+	type Projection struct {
+		ID    int    `db:"id"`
+		Email string `db:"email"`
+		Name  string `db:"name"`
+	}
+
+	result, err := Query[Projection](context.Background(), db,
+		`SELECT m.id, m.email, n.name FROM mirror m JOIN nullable_key n ON n.code = m.email WHERE m.id > ?`, 0)
+	require.NoError(t, err)
+	require.Equal(t, []Projection{{ID: 1, Email: "foo@example.com", Name: "foo"}}, result)
+
+	result, err = Query[Projection](context.Background(), db, `SELECT id, email, '' AS name FROM mirror WHERE id > ?`, 10)
+	require.NoError(t, err)
+	require.Empty(t, result)
+}
+
+func TestQueryDestination(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (id, email) VALUES (1, 'foo@example.com'), (2, 'bar@example.com')`,
+	)
+	ctx := context.Background()
+	query := `SELECT id, email FROM mirror ORDER BY id`
+
+	values, err := Query[MirrorEntity](ctx, db, query)
+	require.NoError(t, err)
+	require.Equal(t, []MirrorEntity{
+		{ID: 1, Email: "foo@example.com"},
+		{ID: 2, Email: "bar@example.com"},
+	}, values)
+
+	pointers, err := Query[*MirrorEntity](ctx, db, query)
+	require.NoError(t, err)
+	require.Equal(t, []*MirrorEntity{
+		{ID: 1, Email: "foo@example.com"},
+		{ID: 2, Email: "bar@example.com"},
+	}, pointers)
+}
+
+func TestSelectRanked(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+		`INSERT INTO score (id, team, points) VALUES (1, 'a', 10), (2, 'a', 30), (3, 'a', 20), (4, 'b', 5), (5, 'b', 15), (6, 'c', 1)`,
+	)
+	ctx := context.Background()
+
+	var result []*ScoreEntity
+	require.NoError(t, SelectRanked(ctx, db, &result, []string{"team"}, []string{"points DESC"}, 2, ""))
+
+	ids := []int{}
+	for _, ent := range result {
+		ids = append(ids, ent.ID)
+	}
+	require.Equal(t, []int{2, 3, 5, 4, 6}, ids)
+
+	require.NoError(t, SelectRanked(ctx, db, &result, []string{"team"}, []string{"points"}, 1, "points > ?", 5))
+	require.Len(t, result, 2)
+	require.Equal(t, 1, result[0].ID)
+	require.Equal(t, 5, result[1].ID)
+
+	require.Error(t, SelectRanked(ctx, db, &result, []string{"unknown"}, []string{"points"}, 1, ""))
+	require.Error(t, SelectRanked(ctx, db, &result, []string{"team"}, []string{"points; DROP"}, 1, ""))
+	require.Error(t, SelectRanked(ctx, db, &result, []string{"team"}, []string{"points"}, 0, ""))
+}
+
+type ScoreEntity struct {
+	ID     int    `db:"id,primaryKey"`
+	Team   string `db:"team"`
+	Points int    `db:"points"`
+}
+
+func (se ScoreEntity) TableName() string {
+	return "score"
+}
+
+func (se *ScoreEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func TestList(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+		`INSERT INTO score (id, team, points) VALUES (1, 'a', 10), (2, 'a', 30), (3, 'a', 20), (4, 'b', 5), (5, 'b', 15)`,
+		`CREATE TABLE preserve (code TEXT PRIMARY KEY, nickname TEXT)`,
+		`INSERT INTO preserve (code, nickname) VALUES ('a', 'foo'), ('b', NULL)`,
+	)
+	ctx := context.Background()
+
+	var result []*ScoreEntity
+	require.NoError(t, List(ctx, db, &result, map[string]interface{}{"team": "a"}, WithOrderBy("points DESC")))
+	require.Len(t, result, 3)
+	require.Equal(t, 2, result[0].ID)
+	require.Equal(t, 3, result[1].ID)
+	require.Equal(t, 1, result[2].ID)
+
+	require.NoError(t, List(ctx, db, &result, map[string]interface{}{"team": "a", "points": 20}))
+	require.Len(t, result, 1)
+	require.Equal(t, 3, result[0].ID)
+
+	var preserves []*PreserveEntity
+	require.NoError(t, List(ctx, db, &preserves, map[string]interface{}{"nickname": nil}))
+	require.Len(t, preserves, 1)
+	require.Equal(t, "b", preserves[0].Code)
+
+	require.NoError(t, List(ctx, db, &result, nil, WithOrderBy("id")))
+	require.Len(t, result, 5)
+	require.Equal(t, 1, result[0].ID)
+
+	err := List(ctx, db, &result, map[string]interface{}{"team = 'a' OR 1": 1})
+	require.Error(t, err)
+
+	err = List(ctx, db, &result, nil, WithOrderBy("points; DROP TABLE score"))
+	require.Error(t, err)
+}
+
+func TestListPagination(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+		`INSERT INTO score (id, team, points) VALUES (1, 'a', 10), (2, 'a', 30), (3, 'a', 20), (4, 'b', 5), (5, 'b', 15)`,
+	)
+	ctx := context.Background()
+
+	var result []*ScoreEntity
+	require.NoError(t, List(ctx, db, &result, nil, WithOrderBy("id"), WithLimit(2), WithOffset(2)))
+	require.Len(t, result, 2)
+	require.Equal(t, 3, result[0].ID)
+	require.Equal(t, 4, result[1].ID)
+
+	require.NoError(t, List(ctx, db, &result, map[string]interface{}{"team": "b"}, WithOrderBy("id"), WithLimit(10), WithOffset(1)))
+	require.Len(t, result, 1)
+	require.Equal(t, 5, result[0].ID)
+
+	require.Error(t, List(ctx, db, &result, nil, WithLimit(-1)))
+	require.Error(t, List(ctx, db, &result, nil, WithLimit(1), WithOffset(-1)))
+	require.Error(t, List(ctx, db, &result, nil, WithOffset(1)))
+
+	md, err := getMetadata(&ScoreEntity{})
+	require.NoError(t, err)
+
+	stmt, err := listStatement(md, driverPostgres, nil, listOptions{orderBy: []string{"id"}, offset: 10})
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "id", "team", "points" FROM "score" ORDER BY "id" OFFSET 10`, stmt)
+
+	stmt, err = listStatement(md, driverMysql, map[string]interface{}{"team": "a"}, listOptions{limit: 10, offset: 20})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT `id`, `team`, `points` FROM `score` WHERE `team` = :team LIMIT 10 OFFSET 20", stmt)
+
+	_, err = listStatement(md, driverMysql, nil, listOptions{offset: 20})
+	require.Error(t, err)
+}
+
+func TestCount(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+		`INSERT INTO score (id, team, points) VALUES (1, 'a', 10), (2, 'a', 30), (3, 'b', 20)`,
+		`CREATE TABLE soft_delete (id INTEGER PRIMARY KEY, name TEXT, deleted_at TIMESTAMP)`,
+		`INSERT INTO soft_delete (id, name, deleted_at) VALUES (1, 'foo', NULL), (2, 'foo', CURRENT_TIMESTAMP), (3, 'bar', NULL)`,
+	)
+	ctx := context.Background()
+
+	n, err := Count(ctx, &ScoreEntity{}, db, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+
+	n, err = Count(ctx, &ScoreEntity{}, db, map[string]interface{}{"team": "a", "points": 30})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	// 已经软删除的记录不计算在内
+	n, err = Count(ctx, &SoftDeleteEntity{}, db, map[string]interface{}{"name": "foo"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	_, err = Count(ctx, &ScoreEntity{}, db, map[string]interface{}{"1 = 1 OR team": "a"})
+	require.Error(t, err)
+}
+
+func TestExists(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+		`INSERT INTO score (id, team, points) VALUES (1, 'a', 10)`,
+		`CREATE TABLE soft_delete (id INTEGER PRIMARY KEY, name TEXT, deleted_at TIMESTAMP)`,
+		`INSERT INTO soft_delete (id, name, deleted_at) VALUES (1, 'foo', NULL), (2, 'bar', CURRENT_TIMESTAMP)`,
+	)
+	ctx := context.Background()
+
+	exists, err := Exists(ctx, &ScoreEntity{ID: 1}, db)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = Exists(ctx, &ScoreEntity{ID: 2}, db)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	exists, err = Exists(ctx, &SoftDeleteEntity{ID: 1}, db)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// 已经软删除的记录视为不存在
+	exists, err = Exists(ctx, &SoftDeleteEntity{ID: 2}, db)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
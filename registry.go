@@ -0,0 +1,86 @@
+package entity
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// Registry 在程序启动时集中注册entity
+// 注册时按照严格模式检查元数据，并且提前生成各类语句，配置错误在启动时就能发现，首次请求也不需要再做反射
+//
+//	registry := entity.NewRegistry("postgres")
+//	registry.MustRegister(&User{}, &Order{})
+type Registry struct {
+	driver string
+
+	mu    sync.Mutex
+	types map[reflect.Type]bool
+}
+
+// NewRegistry 构造Registry，driver为数据库驱动名
+func NewRegistry(driver string) *Registry {
+	return &Registry{
+		driver: resolveDriver(driver),
+		types:  map[reflect.Type]bool{},
+	}
+}
+
+// Register 注册entity，返回第一个检查失败的entity错误
+func (r *Registry) Register(ents ...Entity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ent := range ents {
+		t := reflectx.Deref(reflect.TypeOf(ent))
+		if r.types[t] {
+			continue
+		}
+
+		if err := r.register(ent); err != nil {
+			return fmt.Errorf("register entity %q, %w", t, err)
+		}
+		r.types[t] = true
+	}
+	return nil
+}
+
+// MustRegister 注册entity，失败时panic，用于init()
+func (r *Registry) MustRegister(ents ...Entity) {
+	if err := r.Register(ents...); err != nil {
+		panic(err)
+	}
+}
+
+// Registered entity是否已经注册
+func (r *Registry) Registered(ent Entity) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.types[reflectx.Deref(reflect.TypeOf(ent))]
+}
+
+func (r *Registry) register(ent Entity) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return err
+	}
+
+	if err := validateMetadata(md); err != nil {
+		return err
+	} else if err := validateReturning(md, r.driver); err != nil {
+		return err
+	}
+
+	if cl, ok := ent.(ColumnList); ok {
+		if expected, actual := columnNames(md.Columns), cl.Columns(); strings.Join(expected, ",") != strings.Join(actual, ",") {
+			return fmt.Errorf("generated columns %v mismatch metadata %v, regenerate the code", actual, expected)
+		}
+	}
+
+	warmStatements(ent, md, r.driver)
+	return nil
+}
@@ -0,0 +1,36 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry("sqlite")
+	require.NoError(t, registry.Register(&MirrorEntity{}, &SizedEntity{}))
+	require.True(t, registry.Registered(&MirrorEntity{}))
+	require.True(t, registry.Registered(&SizedEntity{}))
+
+	md, err := getMetadata(&MirrorEntity{})
+	require.NoError(t, err)
+	require.Equal(t, selectStatement(&MirrorEntity{}, md, driverSqlite3), cachedStatement(selectStatements, md))
+	require.Equal(t, insertStatement(&MirrorEntity{}, md, driverSqlite3), cachedStatement(insertStatements, md))
+	require.Equal(t, updateStatement(&MirrorEntity{}, md, driverSqlite3), cachedStatement(updateStatements, md))
+	require.Equal(t, deleteStatement(&MirrorEntity{}, md, driverSqlite3), cachedStatement(deleteStatements, md))
+
+	err = registry.Register(&DuplicateColumnEntity{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "DuplicateColumnEntity")
+	require.False(t, registry.Registered(&DuplicateColumnEntity{}))
+
+	require.Error(t, NewRegistry("mysql").Register(&MirrorEntity{}))
+	require.Panics(t, func() {
+		registry.MustRegister(&BadMirrorEntity{})
+	})
+}
+
+func cachedStatement(c *statementCache, md *Metadata) string {
+	stmt, _ := c.get(md.Type)
+	return stmt
+}
@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// InsertRetryBackoff InsertWithRetry第一次重试之前的等待时间，之后每次重试等待时间翻倍
+var InsertRetryBackoff = 10 * time.Millisecond
+
+// InsertWithRetry 插入entity，因为数据冲突(ErrConflict)或者事务无法串行化而失败时重试
+// 最多执行maxAttempts次，小于1时按1次处理，重试之间按照InsertRetryBackoff指数退避
+// 其它错误立即返回，返回的错误包含已经执行的次数，可以用errors.Is判断原始错误
+// ctx被取消时停止等待，返回ctx.Err()
+//
+// 数据冲突通常需要entity在EventBeforeInsert里重新生成冲突的字段值(例如随机编码)，否则重试同样会冲突
+// db应该是*sqlx.DB，postgresql的事务在发生错误以后无法继续执行，重试应该针对整个事务
+func InsertWithRetry(ctx context.Context, ent Entity, db DB, maxAttempts int) (int64, error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	backoff := InsertRetryBackoff
+	for attempt := 1; ; attempt++ {
+		lastID, err := Insert(ctx, ent, db)
+		if err == nil {
+			return lastID, nil
+		} else if !retryableInsert(db, err) || attempt >= maxAttempts {
+			return 0, fmt.Errorf("insert after %d attempts, %w", attempt, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, fmt.Errorf("insert after %d attempts, last error %v, %w", attempt, err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func retryableInsert(db DB, err error) bool {
+	return errors.Is(err, ErrConflict) || IsSerializationFailure(db, err)
+}
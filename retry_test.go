@@ -0,0 +1,69 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertWithRetry(t *testing.T) {
+	InsertRetryBackoff = time.Millisecond
+	defer func() { InsertRetryBackoff = 10 * time.Millisecond }()
+
+	ctx := context.Background()
+	db := newTestDB(t, ensureSchema,
+		`INSERT INTO ensure (email) VALUES ('0@example.com')`,
+		`INSERT INTO ensure (email) VALUES ('1@example.com')`,
+	)
+
+	// 每次插入前重新生成，前两次都冲突
+	attempts := 0
+	ent := &EnsureEntity{}
+	ent.beforeInsert = func() error {
+		ent.Email = fmt.Sprintf("%d@example.com", attempts)
+		attempts++
+		return nil
+	}
+	_, err := InsertWithRetry(ctx, ent, db, 3)
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, "2@example.com", ent.Email)
+
+	// 超过次数，返回最后一次的错误
+	attempts = 0
+	_, err = InsertWithRetry(ctx, ent, db, 2)
+	require.True(t, errors.Is(err, ErrConflict))
+	require.Contains(t, err.Error(), "after 2 attempts")
+	require.Equal(t, 2, attempts)
+
+	// 不可重试的错误立即返回
+	attempts = 0
+	errStop := errors.New("stop")
+	ent.beforeInsert = func() error {
+		attempts++
+		return errStop
+	}
+	_, err = InsertWithRetry(ctx, ent, db, 3)
+	require.True(t, errors.Is(err, errStop))
+	require.Equal(t, 1, attempts)
+
+	// 等待重试时ctx被取消
+	InsertRetryBackoff = time.Hour
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	attempts = 0
+	ent.beforeInsert = func() error {
+		ent.Email = "0@example.com"
+		attempts++
+		return nil
+	}
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = InsertWithRetry(cctx, ent, db, 3)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Contains(t, err.Error(), "after 1 attempts")
+	require.Equal(t, 1, attempts)
+}
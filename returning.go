@@ -0,0 +1,109 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// UpdateWhereReturning 按照条件批量更新，被更新记录的最新数据写入dest，不会更新已经被软删除的记录
+// set的key为字段名，where条件使用?作为参数占位符
+// 批量操作不会触发entity事件，也不会清除缓存，mysql不支持RETURNING，会直接返回错误
+// 同样适用entity的默认条件(DefaultScoper)
+func UpdateWhereReturning[T Entity](ctx context.Context, db DB, dest *[]T, set map[string]interface{}, where string, args ...interface{}) error {
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	driver := dbDriver(db)
+	if err := checkReturning(md, driver, true); err != nil {
+		return err
+	}
+
+	scope, scopeArgs, err := scopeConds(ctx, newEntity[T](), md)
+	if err != nil {
+		return err
+	}
+
+	stmt, setArgs, err := updateWhereStatement(md, driver, set, where, scope...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	*dest = []T{}
+	args = append(append(setArgs, args...), scopeArgs...)
+	return db.SelectContext(ctx, dest, rebind(db, stmt), args...)
+}
+
+// DeleteWhereReturning 按照条件批量删除，被删除的记录写入dest
+// 有softdelete字段的entity会改为软删除，已经被软删除的记录不会被处理
+// where条件使用?作为参数占位符
+// 批量操作不会触发entity事件，也不会清除缓存，mysql不支持RETURNING，会直接返回错误
+// 同样适用entity的默认条件(DefaultScoper)
+func DeleteWhereReturning[T Entity](ctx context.Context, db DB, dest *[]T, where string, args ...interface{}) error {
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	driver := dbDriver(db)
+	if err := checkReturning(md, driver, true); err != nil {
+		return err
+	}
+
+	scope, scopeArgs, err := scopeConds(ctx, newEntity[T](), md)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	*dest = []T{}
+	args = append(append(softDeleteArgs(md), args...), scopeArgs...)
+	return db.SelectContext(ctx, dest, rebind(db, deleteWhereStatement(md, driver, where, scope...)), args...)
+}
+
+// scope为已经绑定了参数的默认条件，放在where之后
+func updateWhereStatement(md *Metadata, driver string, set map[string]interface{}, where string, scope ...string) (string, []interface{}, error) {
+	if len(set) == 0 {
+		return "", nil, fmt.Errorf("entity %q, empty update columns", md.Type)
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := newUpdate(md, driver)
+	args := []interface{}{}
+	for _, k := range keys {
+		col, ok := md.Column(k)
+		if !ok {
+			return "", nil, fmt.Errorf("entity %q, undefined column %q", md.Type, k)
+		} else if col.RefuseUpdate {
+			return "", nil, fmt.Errorf("entity %q, column %q refuse update", md.Type, k)
+		}
+
+		for _, name := range append([]string{col.DBField}, col.Mirrors...) {
+			b.set(name, bindParam(col, driver, "?"))
+			args = append(args, set[k])
+		}
+	}
+
+	return b.where(where).where(notDeleted(md, driver)...).where(scope...).returning(columnNames(md.Columns)...).String(), args, nil
+}
+
+func deleteWhereStatement(md *Metadata, driver string, where string, scope ...string) string {
+	return newBulkDelete(md, driver).
+		where(where).
+		where(notDeleted(md, driver)...).
+		where(scope...).
+		returning(columnNames(md.Columns)...).
+		String()
+}
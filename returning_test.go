@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhereReturningStatement(t *testing.T) {
+	md, _ := newTestMetadata(&MirrorEntity{})
+
+	stmt, args, err := updateWhereStatement(md, driverPostgres, map[string]interface{}{"email": "foo"}, "id > ?")
+	require.NoError(t, err)
+	require.Equal(t, `UPDATE "mirror" SET "email" = ?, "email_copy" = ? WHERE id > ? RETURNING "email", "id"`, stmt)
+	require.Equal(t, []interface{}{"foo", "foo"}, args)
+
+	_, _, err = updateWhereStatement(md, driverPostgres, map[string]interface{}{"id": 1}, "id > ?")
+	require.Error(t, err)
+	_, _, err = updateWhereStatement(md, driverPostgres, map[string]interface{}{"email_copy": "foo"}, "id > ?")
+	require.Error(t, err)
+
+	require.Equal(t,
+		`DELETE FROM "mirror" WHERE id > ? RETURNING "email", "id"`,
+		deleteWhereStatement(md, driverPostgres, "id > ?"),
+	)
+}
+
+func TestWhereReturning(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (id, email) VALUES (1, 'a'), (2, 'b'), (3, 'c')`,
+	)
+	ctx := context.Background()
+
+	var updated []*MirrorEntity
+	require.NoError(t, UpdateWhereReturning(ctx, db, &updated, map[string]interface{}{"email": "x"}, "id >= ?", 2))
+	require.Len(t, updated, 2)
+	for _, ent := range updated {
+		require.Equal(t, "x", ent.Email)
+	}
+
+	var deleted []*MirrorEntity
+	require.NoError(t, DeleteWhereReturning(ctx, db, &deleted, "email = ?", "a"))
+	require.Equal(t, []*MirrorEntity{{ID: 1, Email: "a"}}, deleted)
+
+	var left int
+	require.NoError(t, db.Get(&left, `SELECT COUNT(*) FROM mirror`))
+	require.Equal(t, 2, left)
+}
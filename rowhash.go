@@ -0,0 +1,63 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RowHashFunc RowHash使用的哈希算法，默认为sha256
+var RowHashFunc func() hash.Hash = sha256.New
+
+// RowHash 计算entity所有字段值的哈希，用于判断记录是否发生了变化
+// 按字段名排序后逐个序列化字段值，同样的数据总是得到同样的结果
+func RowHash(ent Entity) (string, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return "", fmt.Errorf("get metadata, %w", err)
+	}
+
+	cols := append([]Column{}, md.Columns...)
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].DBField < cols[j].DBField
+	})
+
+	h := RowHashFunc()
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	for _, col := range cols {
+		s := "NULL"
+		if f, ok := readField(v, col.DBField); ok {
+			if s, err = canonicalValue(f); err != nil {
+				return "", fmt.Errorf("column %q, %w", col.DBField, err)
+			}
+		}
+		fmt.Fprintf(h, "%s=%s;", strconv.Quote(col.DBField), s)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 字段值的规范化文本，字符串加上引号避免与其它类型或者分隔符混淆
+func canonicalValue(f reflect.Value) (string, error) {
+	val, err := columnValue(f)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := val.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return strconv.Quote(v), nil
+	case []byte:
+		return "x" + hex.EncodeToString(v), nil
+	case time.Time:
+		return strconv.Quote(v.UTC().Format(time.RFC3339Nano)), nil
+	}
+	return strconv.Quote(fmt.Sprintf("%v", val)), nil
+}
@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"crypto/md5"
+	"hash"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowHash(t *testing.T) {
+	now := time.Now()
+	ent := &TimestampEntity{ID: 1, Name: "foo", CreateAt: now, UpdateAt: &now}
+
+	want, err := RowHash(ent)
+	require.NoError(t, err)
+
+	same := &TimestampEntity{ID: 1, Name: "foo", CreateAt: now.In(time.FixedZone("UTC+8", 8*3600)), UpdateAt: &now}
+	actual, err := RowHash(same)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	changes := []func(e *TimestampEntity){
+		func(e *TimestampEntity) { e.ID = 2 },
+		func(e *TimestampEntity) { e.Name = "bar" },
+		func(e *TimestampEntity) { e.CreateAt = now.Add(time.Second) },
+		func(e *TimestampEntity) { e.UpdateAt = nil },
+	}
+	for i, change := range changes {
+		changed := &TimestampEntity{ID: 1, Name: "foo", CreateAt: now, UpdateAt: &now}
+		change(changed)
+
+		actual, err := RowHash(changed)
+		require.NoError(t, err)
+		require.NotEqual(t, want, actual, "change %d", i)
+	}
+
+	// NULL与字符串"NULL"不相同
+	a, err := RowHash(&PreserveEntity{Code: "a"})
+	require.NoError(t, err)
+	null := "NULL"
+	b, err := RowHash(&PreserveEntity{Code: "a", Nickname: &null})
+	require.NoError(t, err)
+	require.NotEqual(t, a, b)
+
+	defer func(f func() hash.Hash) { RowHashFunc = f }(RowHashFunc)
+	RowHashFunc = md5.New
+	actual, err = RowHash(ent)
+	require.NoError(t, err)
+	require.Len(t, actual, 32)
+}
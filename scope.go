@@ -0,0 +1,92 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultScoper 为entity的Load、Update、Delete以及Count、List等按条件查询的语句自动加上额外的查询条件，例如按租户隔离数据
+// 条件使用命名参数，参数名不能与entity的字段名相同，条件为空时不做限制
+// 条件不为空时Load不读取也不写入缓存
+//
+//	func (u *User) DefaultScope(ctx context.Context) (string, map[string]interface{}) {
+//		return "tenant_id = :tenant", map[string]interface{}{"tenant": TenantFromContext(ctx)}
+//	}
+type DefaultScoper interface {
+	DefaultScope(ctx context.Context) (string, map[string]interface{})
+}
+
+// 返回entity的默认查询条件，以及绑定语句时使用的参数
+// 没有默认条件时直接使用entity作为参数
+func defaultScope(ctx context.Context, ent Entity, md *Metadata) ([]string, interface{}, error) {
+	ds, ok := ent.(DefaultScoper)
+	if !ok {
+		return nil, ent, nil
+	}
+
+	cond, params := ds.DefaultScope(ctx)
+	if cond == "" {
+		return nil, ent, nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	args := make(map[string]interface{}, len(md.Columns)+len(params))
+	for _, col := range md.Columns {
+		args[col.DBField] = mapper.FieldByName(v, col.DBField).Interface()
+	}
+
+	for k, v := range params {
+		if _, ok := args[k]; ok {
+			return nil, nil, fmt.Errorf("entity %q, scope param %q conflicts with column", md.Type, k)
+		}
+		args[k] = v
+	}
+
+	return []string{"(" + cond + ")"}, args, nil
+}
+
+// 使用命名参数的按条件查询(例如Count、List)，返回默认条件以及与where合并后的参数
+// where的key都是字段名，defaultScope已经保证默认条件的参数名不会与字段名冲突
+func scopeParams(ctx context.Context, ent Entity, md *Metadata, where map[string]interface{}) ([]string, map[string]interface{}, error) {
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return nil, nil, err
+	} else if len(scope) == 0 {
+		return nil, where, nil
+	}
+
+	params := arg.(map[string]interface{})
+	for k, v := range where {
+		params[k] = v
+	}
+	return scope, params, nil
+}
+
+// 使用?占位符的按条件查询，返回绑定了参数的默认条件以及对应的参数
+// 条件应该放在语句内其它?占位符之后，参数追加在调用方的参数后面
+func scopeConds(ctx context.Context, ent Entity, md *Metadata) ([]string, []interface{}, error) {
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil || len(scope) == 0 {
+		return nil, nil, err
+	}
+
+	cond, args, err := sqlx.Named(scope[0], arg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bind scope, %w", err)
+	}
+	return []string{cond}, args, nil
+}
+
+// ctx内entity是否有默认条件
+func hasDefaultScope(ctx context.Context, ent Entity) bool {
+	ds, ok := ent.(DefaultScoper)
+	if !ok {
+		return false
+	}
+
+	cond, _ := ds.DefaultScope(ctx)
+	return cond != ""
+}
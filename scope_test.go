@@ -0,0 +1,206 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type tenantKey struct{}
+
+type TenantEntity struct {
+	ID       int    `db:"id,primaryKey"`
+	TenantID int    `db:"tenant_id,refuseUpdate"`
+	Name     string `db:"name"`
+}
+
+func (te TenantEntity) TableName() string {
+	return "tenant"
+}
+
+func (te *TenantEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func (te *TenantEntity) DefaultScope(ctx context.Context) (string, map[string]interface{}) {
+	tenant, ok := ctx.Value(tenantKey{}).(int)
+	if !ok {
+		return "", nil
+	}
+	return "tenant_id = :tenant", map[string]interface{}{"tenant": tenant}
+}
+
+type VersionedTenantEntity struct {
+	TenantEntity
+	Version int `db:"version,version"`
+}
+
+// 默认条件之外的记录不存在，版本号不一致时返回sql.ErrNoRows而不是ErrVersionMismatch
+func TestDefaultScopeVersionMissed(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT, version INTEGER)`,
+		`INSERT INTO tenant (id, tenant_id, name, version) VALUES (1, 1, 'foo', 1), (2, 2, 'bar', 1)`,
+	)
+	ctx := context.WithValue(context.Background(), tenantKey{}, 1)
+
+	ent := &VersionedTenantEntity{TenantEntity: TenantEntity{ID: 2, Name: "baz"}, Version: 1}
+	require.True(t, errors.Is(Update(ctx, ent, db), sql.ErrNoRows))
+
+	ent = &VersionedTenantEntity{TenantEntity: TenantEntity{ID: 1, Name: "baz"}, Version: 2}
+	require.True(t, errors.Is(Update(ctx, ent, db), ErrVersionMismatch))
+}
+
+func TestDefaultScope(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT)`,
+		`INSERT INTO tenant (id, tenant_id, name) VALUES (1, 1, 'foo'), (2, 2, 'bar')`,
+	)
+	ctx := context.Background()
+	ctx1 := context.WithValue(ctx, tenantKey{}, 1)
+
+	ent := &TenantEntity{ID: 1}
+	require.NoError(t, Load(ctx1, ent, db))
+	require.Equal(t, "foo", ent.Name)
+
+	ent = &TenantEntity{ID: 2}
+	require.True(t, errors.Is(Load(ctx1, ent, db), sql.ErrNoRows))
+
+	ent = &TenantEntity{ID: 2, Name: "baz"}
+	require.True(t, errors.Is(Update(ctx1, ent, db), sql.ErrNoRows))
+	require.NoError(t, Delete(ctx1, ent, db))
+
+	// 没有租户条件时不做限制
+	ent = &TenantEntity{ID: 2}
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "bar", ent.Name)
+
+	ent = &TenantEntity{ID: 1, Name: "qux"}
+	require.NoError(t, Update(ctx1, ent, db))
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "qux", ent.Name)
+
+	require.NoError(t, Delete(ctx1, ent, db))
+	require.True(t, errors.Is(Load(ctx, ent, db), sql.ErrNoRows))
+}
+
+// 按条件查询多条记录的方法同样适用默认条件
+func TestScopedReads(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT)`,
+		`INSERT INTO tenant (id, tenant_id, name) VALUES (1, 1, 'foo'), (2, 2, 'foo'), (3, 1, 'bar')`,
+	)
+	ctx := context.Background()
+	ctx1 := context.WithValue(ctx, tenantKey{}, 1)
+
+	t.Run("count", func(t *testing.T) {
+		n, err := Count(ctx1, &TenantEntity{}, db, map[string]interface{}{"name": "foo"})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		n, err = Count(ctx1, &TenantEntity{}, db, nil)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+
+		n, err = Count(ctx, &TenantEntity{}, db, nil)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var list []*TenantEntity
+		require.NoError(t, List(ctx1, db, &list, map[string]interface{}{"name": "foo"}))
+		require.Len(t, list, 1)
+		require.Equal(t, 1, list[0].ID)
+
+		require.NoError(t, List(ctx1, db, &list, nil, WithOrderBy("id DESC")))
+		require.Len(t, list, 2)
+		require.Equal(t, 3, list[0].ID)
+	})
+
+	t.Run("by ids", func(t *testing.T) {
+		var list []*TenantEntity
+		require.NoError(t, FindByIDs(ctx1, db, &list, []interface{}{1, 2, 3}))
+		require.Len(t, list, 2)
+
+		require.NoError(t, LoadManyOrdered(ctx1, db, &list, []int{3, 2, 1}))
+		require.Len(t, list, 2)
+		require.Equal(t, 3, list[0].ID)
+		require.Equal(t, 1, list[1].ID)
+	})
+
+	t.Run("ranked", func(t *testing.T) {
+		var list []*TenantEntity
+		require.NoError(t, SelectRanked(ctx1, db, &list, []string{"name"}, []string{"id DESC"}, 1, "id > ?", 0))
+		require.Len(t, list, 2)
+		for _, ent := range list {
+			require.Equal(t, 1, ent.TenantID)
+		}
+	})
+
+	t.Run("select", func(t *testing.T) {
+		q := Select[*TenantEntity]().Where("name = ?", "foo")
+
+		list, err := q.All(ctx1, db)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		require.Equal(t, 1, list[0].ID)
+
+		n, err := q.Count(ctx1, db)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		exists, err := Select[*TenantEntity]().Where("id = ?", 2).Exists(ctx1, db)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		_, err = Select[*TenantEntity]().Where("id = ?", 2).First(ctx1, db)
+		require.True(t, errors.Is(err, sql.ErrNoRows))
+	})
+
+	t.Run("exists where", func(t *testing.T) {
+		exists, err := ExistsWhere(ctx1, &TenantEntity{}, db, "id = ?", 2)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("where returning", func(t *testing.T) {
+		var list []*TenantEntity
+		require.NoError(t, UpdateWhereReturning(ctx1, db, &list, map[string]interface{}{"name": "qux"}, "name = ?", "foo"))
+		require.Len(t, list, 1)
+		require.Equal(t, 1, list[0].ID)
+
+		require.NoError(t, DeleteWhereReturning(ctx1, db, &list, "name = ?", "foo"))
+		require.Len(t, list, 0)
+
+		ent := &TenantEntity{ID: 2}
+		require.NoError(t, Load(ctx, ent, db))
+		require.Equal(t, "foo", ent.Name)
+	})
+}
+
+// UpdateReturningExtra同样适用默认条件，不能更新其它租户的记录
+func TestDefaultScopeUpdateReturningExtra(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE tenant (id INTEGER PRIMARY KEY, tenant_id INTEGER, name TEXT)`,
+		`INSERT INTO tenant (id, tenant_id, name) VALUES (1, 1, 'foo'), (2, 2, 'bar')`,
+	)
+	ctx := context.WithValue(context.Background(), tenantKey{}, 1)
+
+	var result struct {
+		Total int `db:"total"`
+	}
+
+	err := UpdateReturningExtra(ctx, &TenantEntity{ID: 2, TenantID: 2, Name: "baz"}, db, &result, "(SELECT COUNT(*) FROM tenant) AS total")
+	require.True(t, errors.Is(err, sql.ErrNoRows))
+
+	var name string
+	require.NoError(t, db.Get(&name, `SELECT name FROM tenant WHERE id = 2`))
+	require.Equal(t, "bar", name)
+
+	err = UpdateReturningExtra(ctx, &TenantEntity{ID: 1, TenantID: 1, Name: "baz"}, db, &result, "(SELECT COUNT(*) FROM tenant) AS total")
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Total)
+}
@@ -0,0 +1,166 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SelectQuery 针对某个entity类型的链式查询，查询字段来自entity元数据，同样适用entity的默认条件(DefaultScoper)
+//
+//	users, err := entity.Select[*User]().Where("status = ?", "active").OrderBy("create_at DESC").Limit(10).All(ctx, db)
+type SelectQuery[T Entity] struct {
+	conds   []string
+	args    []interface{}
+	orderBy []string
+	limit   int
+}
+
+// Select 构造T类型entity的链式查询
+func Select[T Entity]() *SelectQuery[T] {
+	return &SelectQuery[T]{}
+}
+
+// Where 添加查询条件，多次调用之间使用AND连接，条件使用?作为参数占位符
+func (q *SelectQuery[T]) Where(cond string, args ...interface{}) *SelectQuery[T] {
+	q.conds = append(q.conds, "("+cond+")")
+	q.args = append(q.args, args...)
+	return q
+}
+
+// OrderBy 添加排序，每一项为字段名，可以加上ASC或DESC，例如"create_at DESC"
+// 字段名在执行查询时检查，不是entity字段时返回错误
+func (q *SelectQuery[T]) OrderBy(orders ...string) *SelectQuery[T] {
+	q.orderBy = append(q.orderBy, orders...)
+	return q
+}
+
+// Limit 限制返回的记录数，0表示不限制
+func (q *SelectQuery[T]) Limit(n int) *SelectQuery[T] {
+	q.limit = n
+	return q
+}
+
+// All 返回所有符合条件的记录
+func (q *SelectQuery[T]) All(ctx context.Context, db DB) ([]T, error) {
+	return q.all(ctx, db, q.limit)
+}
+
+// First 返回第一条符合条件的记录，没有记录时返回sql.ErrNoRows
+func (q *SelectQuery[T]) First(ctx context.Context, db DB) (T, error) {
+	var zero T
+
+	rows, err := q.all(ctx, db, 1)
+	if err != nil {
+		return zero, err
+	} else if len(rows) == 0 {
+		return zero, sql.ErrNoRows
+	}
+	return rows[0], nil
+}
+
+// Count 返回符合条件的记录数，忽略OrderBy和Limit
+func (q *SelectQuery[T]) Count(ctx context.Context, db DB) (int64, error) {
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return 0, fmt.Errorf("get metadata, %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	scope, args, err := q.scope(ctx, md)
+	if err != nil {
+		return 0, err
+	}
+
+	driver := dbDriver(db)
+	stmt := newSelect(md, driver).
+		expr("COUNT(*)").
+		where(q.conds...).
+		where(notDeleted(md, driver)...).
+		where(scope...).
+		String()
+
+	var n int64
+	if err := db.QueryRowxContext(ctx, rebind(db, stmt), args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Exists 检查是否存在符合条件的记录
+func (q *SelectQuery[T]) Exists(ctx context.Context, db DB) (bool, error) {
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return false, fmt.Errorf("get metadata, %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	scope, args, err := q.scope(ctx, md)
+	if err != nil {
+		return false, err
+	}
+
+	driver := dbDriver(db)
+	stmt := newSelect(md, driver).
+		expr("1").
+		where(q.conds...).
+		where(notDeleted(md, driver)...).
+		where(scope...).
+		limit(1).
+		String()
+
+	var v int
+	if err := db.QueryRowxContext(ctx, rebind(db, stmt), args...).Scan(&v); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (q *SelectQuery[T]) all(ctx context.Context, db DB, limit int) ([]T, error) {
+	md, err := getMetadata(newEntity[T]())
+	if err != nil {
+		return nil, fmt.Errorf("get metadata, %w", err)
+	}
+
+	driver := dbDriver(db)
+	orders, err := orderByExprs(md, driver, q.orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, args, err := q.scope(ctx, md)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := newSelect(md, driver).
+		column(columnNames(md.Columns)...).
+		where(q.conds...).
+		where(notDeleted(md, driver)...).
+		where(scope...).
+		orderBy(orders...).
+		limit(limit).
+		String()
+
+	ctx, cancel := context.WithTimeout(ctx, ReadTimeout)
+	defer cancel()
+
+	return selectEntities[T](ctx, db, rebind(db, stmt), args...)
+}
+
+// entity的默认条件，以及追加了默认条件参数的查询参数
+func (q *SelectQuery[T]) scope(ctx context.Context, md *Metadata) ([]string, []interface{}, error) {
+	scope, scopeArgs, err := scopeConds(ctx, newEntity[T](), md)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scope, append(q.args[:len(q.args):len(q.args)], scopeArgs...), nil
+}
@@ -0,0 +1,58 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectQuery(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE score (id INTEGER PRIMARY KEY, team TEXT, points INTEGER)`,
+		`INSERT INTO score (id, team, points) VALUES (1, 'a', 10), (2, 'a', 30), (3, 'a', 20), (4, 'b', 5), (5, 'b', 15)`,
+	)
+	ctx := context.Background()
+
+	q := Select[*ScoreEntity]().Where("team = ?", "a").Where("points > ?", 10).OrderBy("points DESC", "id")
+	result, err := q.All(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	require.Equal(t, 2, result[0].ID)
+	require.Equal(t, 3, result[1].ID)
+
+	first, err := q.First(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, 2, first.ID)
+
+	n, err := q.Count(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	exists, err := q.Exists(ctx, db)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	result, err = Select[*ScoreEntity]().OrderBy("points").Limit(2).All(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	require.Equal(t, 4, result[0].ID)
+	require.Equal(t, 1, result[1].ID)
+
+	n, err = Select[*ScoreEntity]().Count(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n)
+
+	q = Select[*ScoreEntity]().Where("team = ?", "c")
+	_, err = q.First(ctx, db)
+	require.True(t, errors.Is(err, sql.ErrNoRows))
+
+	exists, err = q.Exists(ctx, db)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = Select[*ScoreEntity]().OrderBy("points; DROP TABLE score").All(ctx, db)
+	require.Error(t, err)
+}
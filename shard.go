@@ -0,0 +1,63 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+// ErrNoShardKey ctx内没有分片key
+var ErrNoShardKey = errors.New("no shard key in context")
+
+type shardKey struct{}
+
+// ShardResolver 根据分片key选择数据库
+type ShardResolver interface {
+	ResolveShard(key string) (DB, error)
+}
+
+// HashShards 按照分片key的hash值选择数据库
+type HashShards []DB
+
+// ResolveShard implements ShardResolver
+func (hs HashShards) ResolveShard(key string) (DB, error) {
+	if len(hs) == 0 {
+		return nil, fmt.Errorf("empty shards")
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return hs[h.Sum32()%uint32(len(hs))], nil
+}
+
+// WithShardKey 在ctx内设置分片key，例如租户ID
+func WithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKey{}, key)
+}
+
+// ShardKey 取出ctx内的分片key
+func ShardKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(shardKey{}).(string)
+	return key, ok
+}
+
+// ShardDB 使用ctx内的分片key选择数据库，再把结果传给Load、Insert等方法
+//
+//	db, err := entity.ShardDB(ctx, shards)
+//	if err != nil {
+//		return err
+//	}
+//	return entity.Load(ctx, ent, db)
+func ShardDB(ctx context.Context, resolver ShardResolver) (DB, error) {
+	key, ok := ShardKey(ctx)
+	if !ok {
+		return nil, ErrNoShardKey
+	}
+
+	db, err := resolver.ResolveShard(key)
+	if err != nil {
+		return nil, fmt.Errorf("resolve shard %q, %w", key, err)
+	}
+	return db, nil
+}
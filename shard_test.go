@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardDB(t *testing.T) {
+	schema := `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`
+	shards := HashShards{newTestDB(t, schema), newTestDB(t, schema)}
+
+	ctx := context.Background()
+	_, err := ShardDB(ctx, shards)
+	require.True(t, errors.Is(err, ErrNoShardKey))
+
+	expected := map[string]int{"foo": 1, "bar": 0, "baz": 0, "qux": 1}
+	for key, i := range expected {
+		ctx := WithShardKey(ctx, key)
+
+		db, err := ShardDB(ctx, shards)
+		require.NoError(t, err)
+		require.True(t, db == shards[i], key)
+
+		_, err = Insert(ctx, &MirrorEntity{Email: key}, db)
+		require.NoError(t, err)
+	}
+
+	for _, db := range shards {
+		var n int
+		require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM mirror`))
+		require.Equal(t, 2, n)
+	}
+
+	_, err = ShardDB(WithShardKey(ctx, "foo"), HashShards{})
+	require.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShuttingDown 调用Shutdown之后再发起的数据库操作会返回此错误
+var ErrShuttingDown = errors.New("entity is shutting down")
+
+var (
+	shutdownMu   sync.RWMutex
+	shuttingDown bool
+	inflight     = &sync.WaitGroup{}
+)
+
+// Shutdown 拒绝新的数据库操作，并等待执行中的操作完成
+// ctx过期时不再等待，返回ctx.Err()，执行中的操作不会被中断
+func Shutdown(ctx context.Context) error {
+	shutdownMu.Lock()
+	shuttingDown = true
+	wg := inflight
+	shutdownMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 登记一个执行中的操作，返回的方法需要在操作结束时调用
+func beginOperation() (end func(), err error) {
+	shutdownMu.RLock()
+	defer shutdownMu.RUnlock()
+
+	if shuttingDown {
+		return nil, ErrShuttingDown
+	}
+
+	inflight.Add(1)
+	return inflight.Done, nil
+}
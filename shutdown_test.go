@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	defer resetMiddlewares()
+	defer resetShutdown()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	Use(func(next Handler) Handler {
+		return func(ctx context.Context, op string, exec func() error) error {
+			if op == OpLoad {
+				close(started)
+				<-release
+			}
+			return next(ctx, op, exec)
+		}
+	})
+
+	db := newTestDB(t,
+		`CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`,
+		`INSERT INTO mirror (id, email, email_copy) VALUES (1, 'foo@example.com', 'foo@example.com')`,
+	)
+	ctx := context.Background()
+
+	loaded := make(chan error, 1)
+	go func() {
+		loaded <- Load(ctx, &MirrorEntity{ID: 1}, db)
+	}()
+	<-started
+
+	// 执行中的操作没有结束之前，Shutdown等待至ctx过期
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.True(t, errors.Is(Shutdown(timeout), context.DeadlineExceeded))
+
+	_, err := Insert(ctx, &MirrorEntity{Email: "bar@example.com"}, db)
+	require.True(t, errors.Is(err, ErrShuttingDown))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Shutdown(ctx)
+	}()
+
+	close(release)
+	require.NoError(t, <-loaded)
+	require.NoError(t, <-done)
+}
+
+func resetShutdown() {
+	shutdownMu.Lock()
+	shuttingDown = false
+	inflight = &sync.WaitGroup{}
+	shutdownMu.Unlock()
+}
@@ -0,0 +1,134 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var nullTimeType = reflect.TypeOf(sql.NullTime{})
+
+// ForceDelete 物理删除entity，忽略softdelete设置
+func ForceDelete(ctx context.Context, ent Entity, db DB) error {
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	if err := ent.OnEntityEvent(ctx, EventBeforeDelete); err != nil {
+		return fmt.Errorf("before delete, %w", err)
+	}
+
+	db = withLogger(db)
+	if err := handle(ctx, db, OpDelete, ent.TableName(), func(ctx context.Context) error {
+		return deleteEntity(ctx, ent, db, true)
+	}); err != nil {
+		return err
+	}
+
+	if v, ok := ent.(Cacheable); ok {
+		if err := DeleteCache(v); err != nil {
+			return fmt.Errorf("delete cache, %w", err)
+		}
+	}
+
+	if err := ent.OnEntityEvent(ctx, EventAfterDelete); err != nil {
+		return fmt.Errorf("after delete, %w", err)
+	}
+	return nil
+}
+
+// Restore 恢复被软删除的entity，把softdelete字段设置为NULL
+// entity没有softdelete字段时返回错误，记录不存在时返回sql.ErrNoRows
+func Restore(ctx context.Context, ent Entity, db DB) error {
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	db = withLogger(db)
+	if err := handle(ctx, db, OpUpdate, ent.TableName(), func(ctx context.Context) error {
+		return restoreEntity(ctx, ent, db)
+	}); err != nil {
+		return err
+	}
+
+	if v, ok := ent.(Cacheable); ok {
+		if err := DeleteCache(v); err != nil {
+			return fmt.Errorf("delete cache, %w", err)
+		}
+	}
+	return nil
+}
+
+func restoreEntity(ctx context.Context, ent Entity, db DB) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	} else if md.softDelete == nil {
+		return fmt.Errorf("entity %q, undefined softdelete column", md.Type)
+	}
+
+	allocEmbedded(ent, md)
+
+	scope, arg, err := defaultScope(ctx, ent, md)
+	if err != nil {
+		return err
+	}
+
+	driver := dbDriver(db)
+	stmt := newUpdate(md, driver).
+		set(md.softDelete.DBField, "NULL").
+		where(primaryKeyWhere(md, driver)).
+		where(scope...).
+		String()
+
+	result, err := namedExec(ctx, db, stmt, arg)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("get affected rows, %w", err)
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	setDeletedAt(ent, md, time.Time{})
+	return nil
+}
+
+// 软删除的条件，只查询没有被删除的记录，没有softdelete字段时返回nil
+func notDeleted(md *Metadata, driver string) []string {
+	if md.softDelete == nil {
+		return nil
+	}
+	return []string{quoteColumn(md.softDelete.DBField, driver) + " IS NULL"}
+}
+
+// 按条件批量删除的语句，有softdelete字段时改为UPDATE写入删除时间
+// 删除时间使用?占位符，参数由softDeleteArgs()返回，需要放在其它参数之前
+func newBulkDelete(md *Metadata, driver string) *sqlBuilder {
+	if md.softDelete == nil {
+		return newDelete(md, driver)
+	}
+	return newUpdate(md, driver).set(md.softDelete.DBField, bindParam(*md.softDelete, driver, "?"))
+}
+
+// newBulkDelete()语句SET子句的参数，没有softdelete字段时返回nil
+func softDeleteArgs(md *Metadata) []interface{} {
+	if md.softDelete == nil {
+		return nil
+	}
+	return []interface{}{nowFunc()}
+}
+
+// 把softdelete字段设置为指定时间，零值表示没有被删除
+func setDeletedAt(ent Entity, md *Metadata, t time.Time) {
+	f := mapper.FieldByName(reflect.Indirect(reflect.ValueOf(ent)), md.softDelete.DBField)
+	if f.Type() == nullTimeType {
+		f.Set(reflect.ValueOf(sql.NullTime{Time: t, Valid: !t.IsZero()}))
+	} else if t.IsZero() {
+		f.Set(reflect.Zero(f.Type()))
+	} else {
+		f.Set(reflect.ValueOf(&t))
+	}
+}
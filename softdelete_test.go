@@ -0,0 +1,219 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDeleteStatement(t *testing.T) {
+	md, err := newTestMetadata(&SoftDeleteEntity{})
+	require.NoError(t, err)
+
+	require.Equal(t, `SELECT "deleted_at", "id", "name" FROM "soft_delete" WHERE "id" = :id AND "deleted_at" IS NULL LIMIT 1`, selectStatement(&SoftDeleteEntity{}, md, driverPostgres))
+	require.Equal(t, `UPDATE "soft_delete" SET "deleted_at" = :deleted_at WHERE "id" = :id AND "deleted_at" IS NULL`, deleteStatement(&SoftDeleteEntity{}, md, driverPostgres))
+	require.Equal(t, `DELETE FROM "soft_delete" WHERE "id" = :id`, forceDeleteStatement(&SoftDeleteEntity{}, md, driverPostgres))
+	require.Equal(t, `UPDATE "soft_delete" SET "name" = :name WHERE "id" = :id`, updateStatement(&SoftDeleteEntity{}, md, driverPostgres))
+
+	// 按条件批量删除改为软删除，并且排除已经被删除的记录
+	require.Equal(t,
+		`UPDATE "soft_delete" SET "deleted_at" = ? WHERE name = ? AND "deleted_at" IS NULL RETURNING "deleted_at", "id", "name"`,
+		deleteWhereStatement(md, driverPostgres, "name = ?"),
+	)
+	require.Equal(t,
+		"UPDATE `soft_delete` SET `deleted_at` = ? WHERE name = ? AND `deleted_at` IS NULL LIMIT 100",
+		deleteChunkStatement(md, driverMysql, "name = ?", 100),
+	)
+	require.Equal(t,
+		`UPDATE "soft_delete" SET "deleted_at" = ? WHERE rowid IN (SELECT rowid FROM "soft_delete" WHERE name = ? AND "deleted_at" IS NULL LIMIT 100)`,
+		deleteChunkStatement(md, driverSqlite3, "name = ?", 100),
+	)
+
+	stmt, _, err := updateWhereStatement(md, driverPostgres, map[string]interface{}{"name": "foo"}, "id > ?")
+	require.NoError(t, err)
+	require.Equal(t, `UPDATE "soft_delete" SET "name" = ? WHERE id > ? AND "deleted_at" IS NULL RETURNING "deleted_at", "id", "name"`, stmt)
+
+	_, err = NewMetadata(&BadSoftDeleteEntity{})
+	require.Error(t, err)
+}
+
+func TestSoftDelete(t *testing.T) {
+	defer func() { nowFunc = time.Now }()
+
+	deletedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	nowFunc = func() time.Time { return deletedAt }
+
+	db := newTestDB(t, `CREATE TABLE soft_delete (id INTEGER PRIMARY KEY, name TEXT, deleted_at TIMESTAMP)`)
+	ctx := context.Background()
+
+	ent := &SoftDeleteEntity{Name: "foo"}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+
+	require.NoError(t, Delete(ctx, ent, db))
+	require.NotNil(t, ent.DeletedAt)
+	require.True(t, deletedAt.Equal(*ent.DeletedAt))
+
+	// 记录仍然存在，但是不会被读取
+	var stored sql.NullTime
+	require.NoError(t, db.Get(&stored, `SELECT deleted_at FROM soft_delete WHERE id = ?`, ent.ID))
+	require.True(t, stored.Valid)
+
+	require.True(t, errors.Is(Load(ctx, &SoftDeleteEntity{ID: ent.ID}, db), sql.ErrNoRows))
+
+	exists, err := ExistsWhere(ctx, &SoftDeleteEntity{}, db, "id = ?", ent.ID)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, Restore(ctx, ent, db))
+	require.Nil(t, ent.DeletedAt)
+
+	loaded := &SoftDeleteEntity{ID: ent.ID}
+	require.NoError(t, Load(ctx, loaded, db))
+	require.Equal(t, "foo", loaded.Name)
+
+	require.NoError(t, ForceDelete(ctx, ent, db))
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM soft_delete`))
+	require.Equal(t, 0, n)
+
+	require.True(t, errors.Is(Restore(ctx, ent, db), sql.ErrNoRows))
+	require.Error(t, Restore(ctx, &MirrorEntity{ID: 1}, db))
+}
+
+type SoftDeleteEntity struct {
+	ID        int        `db:"id,primaryKey,returningInsert"`
+	Name      string     `db:"name"`
+	DeletedAt *time.Time `db:"deleted_at,softdelete"`
+}
+
+func (sde SoftDeleteEntity) TableName() string {
+	return "soft_delete"
+}
+
+func (sde *SoftDeleteEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type BadSoftDeleteEntity struct {
+	ID        int       `db:"id,primaryKey"`
+	DeletedAt time.Time `db:"deleted_at,softdelete"`
+}
+
+func (bsde BadSoftDeleteEntity) TableName() string {
+	return "bad_soft_delete"
+}
+
+func (bsde *BadSoftDeleteEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+func TestSoftDeleteCascade(t *testing.T) {
+	db := newTestDB(t,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, deleted_at DATETIME)`,
+		`CREATE TABLE order_items (id INTEGER PRIMARY KEY, order_id INTEGER, deleted_at DATETIME)`,
+		`INSERT INTO orders (id) VALUES (1), (2)`,
+		`INSERT INTO order_items (id, order_id) VALUES (1, 1), (2, 1), (3, 2)`,
+	)
+	ctx := context.Background()
+
+	md, err := getMetadata(&OrderEntity{})
+	require.NoError(t, err)
+	require.Len(t, md.cascades, 1)
+	require.Equal(t, "order_items", md.cascades[0].CascadeDelete)
+	require.Equal(t, "order_id", md.cascades[0].CascadeFK)
+
+	ent := &OrderEntity{ID: 1}
+	require.NoError(t, Delete(ctx, ent, db))
+	require.NotNil(t, ent.DeletedAt)
+
+	var deleted []int
+	require.NoError(t, db.Select(&deleted, `SELECT id FROM order_items WHERE deleted_at IS NOT NULL ORDER BY id`))
+	require.Equal(t, []int{1, 2}, deleted)
+
+	// 子表软删除失败时，父表的软删除一并回滚
+	db.MustExec(`ALTER TABLE order_items RENAME TO order_items_bak`)
+	require.Error(t, Delete(ctx, &OrderEntity{ID: 2}, db))
+
+	var n int
+	require.NoError(t, db.Get(&n, `SELECT COUNT(*) FROM orders WHERE deleted_at IS NULL`))
+	require.Equal(t, 1, n)
+
+	_, err = NewMetadata(&BadCascadeEntity{})
+	require.Error(t, err)
+}
+
+type OrderEntity struct {
+	ID        int        `db:"id,primaryKey" entity:"cascade_delete=order_items,fk=order_id"`
+	DeletedAt *time.Time `db:"deleted_at,softdelete"`
+}
+
+func (oe OrderEntity) TableName() string {
+	return "orders"
+}
+
+func (oe *OrderEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+// 没有softdelete字段时不能级联软删除
+type BadCascadeEntity struct {
+	ID int `db:"id,primaryKey" entity:"cascade_delete=order_items,fk=order_id"`
+}
+
+func (bce BadCascadeEntity) TableName() string {
+	return "bad_cascade"
+}
+
+func (bce *BadCascadeEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+// 按条件批量删除时同样使用软删除，已经被删除的记录不会重复处理
+func TestSoftDeleteWhere(t *testing.T) {
+	defer func() { nowFunc = time.Now }()
+
+	deletedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	nowFunc = func() time.Time { return deletedAt }
+
+	db := newTestDB(t,
+		`CREATE TABLE soft_delete (id INTEGER PRIMARY KEY, name TEXT, deleted_at TIMESTAMP)`,
+		`INSERT INTO soft_delete (id, name, deleted_at) VALUES (1, 'foo', NULL), (2, 'foo', NULL), (3, 'foo', '2020-01-01 00:00:00'), (4, 'bar', NULL)`,
+	)
+	ctx := context.Background()
+
+	n, err := DeleteWhereChunked(ctx, &SoftDeleteEntity{}, db, 1, "name = ?", "foo")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	var total int
+	require.NoError(t, db.Get(&total, `SELECT COUNT(*) FROM soft_delete`))
+	require.Equal(t, 4, total)
+
+	var ids []int
+	require.NoError(t, db.Select(&ids, `SELECT id FROM soft_delete WHERE deleted_at IS NULL`))
+	require.Equal(t, []int{4}, ids)
+
+	// 之前删除的时间不会被覆盖
+	var stored sql.NullTime
+	require.NoError(t, db.Get(&stored, `SELECT deleted_at FROM soft_delete WHERE id = 3`))
+	require.Equal(t, 2020, stored.Time.Year())
+
+	var deleted []*SoftDeleteEntity
+	require.NoError(t, DeleteWhereReturning(ctx, db, &deleted, "id >= ?", 3))
+	require.Len(t, deleted, 1)
+	require.Equal(t, 4, deleted[0].ID)
+	require.NotNil(t, deleted[0].DeletedAt)
+
+	var updated []*SoftDeleteEntity
+	require.NoError(t, UpdateWhereReturning(ctx, db, &updated, map[string]interface{}{"name": "baz"}, "id > ?", 0))
+	require.Len(t, updated, 0)
+
+	require.NoError(t, db.Get(&total, `SELECT COUNT(*) FROM soft_delete`))
+	require.Equal(t, 4, total)
+}
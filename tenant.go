@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoTenantSchema ctx内没有租户schema
+var ErrNoTenantSchema = errors.New("no tenant schema in context")
+
+type tenantSchemaKey struct{}
+
+// WithTenantSchema 在ctx内设置租户使用的postgresql schema
+func WithTenantSchema(ctx context.Context, schema string) context.Context {
+	return context.WithValue(ctx, tenantSchemaKey{}, schema)
+}
+
+// TenantSchema 取出ctx内的租户schema
+func TenantSchema(ctx context.Context) (string, bool) {
+	schema, ok := ctx.Value(tenantSchemaKey{}).(string)
+	return schema, ok && schema != ""
+}
+
+// TenantTx 在ctx内租户schema下执行事务过程，只支持postgresql
+// 事务开始时把search_path设置为租户schema，事务内的entity语句不需要带上schema就能访问租户自己的表
+// search_path只在这个事务内有效(等同于SET LOCAL)，事务提交或回滚后连接恢复原来的search_path，放回连接池后不会影响其它租户
+//
+//	ctx = entity.WithTenantSchema(ctx, "tenant_1")
+//	err := entity.TenantTx(ctx, db, func(tx *sqlx.Tx) error {
+//		return entity.Load(ctx, user, tx)
+//	})
+func TenantTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	schema, ok := TenantSchema(ctx)
+	if !ok {
+		return ErrNoTenantSchema
+	}
+
+	return Transaction(db, func(tx *sqlx.Tx) error {
+		stmt := rebind(tx, "SELECT set_config('search_path', ?, true)")
+		if _, err := tx.ExecContext(ctx, stmt, quoteSchema(schema)); err != nil {
+			return fmt.Errorf("set search_path, %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+// search_path内的schema名字，使用双引号避免大小写转换以及特殊字符
+func quoteSchema(schema string) string {
+	return `"` + strings.ReplaceAll(schema, `"`, `""`) + `"`
+}
@@ -0,0 +1,155 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantTx(t *testing.T) {
+	db, err := sqlx.Open("tenantmock", "")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	names := func(ctx context.Context, q sqlx.QueryerContext) []string {
+		result := []string{}
+		require.NoError(t, sqlx.SelectContext(ctx, q, &result, "SELECT name FROM users"))
+		return result
+	}
+
+	for schema, expected := range map[string][]string{
+		"tenant_a": {"alice"},
+		"tenant_b": {"bob", "bill"},
+	} {
+		ctx := WithTenantSchema(context.Background(), schema)
+		err := TenantTx(ctx, db, func(tx *sqlx.Tx) error {
+			require.Equal(t, expected, names(ctx, tx))
+			return nil
+		})
+		require.NoError(t, err)
+
+		// 连接放回连接池后恢复默认的search_path
+		require.Equal(t, []string{"public"}, names(context.Background(), db))
+	}
+
+	ctx := WithTenantSchema(context.Background(), "tenant_a")
+	err = TenantTx(ctx, db, func(tx *sqlx.Tx) error {
+		return errors.New("rollback")
+	})
+	require.Error(t, err)
+	require.Equal(t, []string{"public"}, names(context.Background(), db))
+
+	err = TenantTx(context.Background(), db, func(tx *sqlx.Tx) error {
+		return nil
+	})
+	require.True(t, errors.Is(err, ErrNoTenantSchema))
+
+	require.Equal(t, `"tenant_a"`, quoteSchema("tenant_a"))
+	require.Equal(t, `"a""b"`, quoteSchema(`a"b`))
+}
+
+// 模拟postgresql按search_path读取不同schema内的表，SET LOCAL的设置在事务结束后失效
+func init() {
+	sql.Register("tenantmock", tenantDriver{})
+}
+
+var tenantTables = map[string][]string{
+	`"tenant_a"`: {"alice"},
+	`"tenant_b"`: {"bob", "bill"},
+	"":           {"public"},
+}
+
+type tenantDriver struct{}
+
+func (tenantDriver) Open(name string) (driver.Conn, error) {
+	return &tenantConn{}, nil
+}
+
+type tenantConn struct {
+	searchPath string
+}
+
+func (c *tenantConn) Prepare(query string) (driver.Stmt, error) {
+	return tenantStmt{c: c, query: query}, nil
+}
+
+func (c *tenantConn) Close() error {
+	return nil
+}
+
+func (c *tenantConn) Begin() (driver.Tx, error) {
+	return tenantTx{c}, nil
+}
+
+type tenantTx struct {
+	c *tenantConn
+}
+
+func (tx tenantTx) Commit() error {
+	tx.c.searchPath = ""
+	return nil
+}
+
+func (tx tenantTx) Rollback() error {
+	tx.c.searchPath = ""
+	return nil
+}
+
+type tenantStmt struct {
+	c     *tenantConn
+	query string
+}
+
+func (s tenantStmt) Close() error {
+	return nil
+}
+
+func (s tenantStmt) NumInput() int {
+	return -1
+}
+
+func (s tenantStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.Contains(s.query, "set_config('search_path', ?, true)") || len(args) != 1 {
+		return nil, errors.New("not supported")
+	}
+	s.c.searchPath = args[0].(string)
+	return driver.ResultNoRows, nil
+}
+
+func (s tenantStmt) Query(args []driver.Value) (driver.Rows, error) {
+	names, ok := tenantTables[s.c.searchPath]
+	if !ok {
+		return nil, errors.New("relation users does not exist")
+	}
+	return &tenantRows{names: names}, nil
+}
+
+type tenantRows struct {
+	names []string
+	i     int
+}
+
+func (r *tenantRows) Columns() []string {
+	return []string{"name"}
+}
+
+func (r *tenantRows) Close() error {
+	return nil
+}
+
+func (r *tenantRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.names) {
+		return io.EOF
+	}
+	dest[0] = r.names[r.i]
+	r.i++
+	return nil
+}
@@ -0,0 +1,72 @@
+package entity
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Tracer 链路追踪，每个数据库操作开始时创建一个子span，用于在分布式追踪内看到entity的操作
+// 本包不依赖OpenTelemetry，使用时用几行代码适配，例如
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (ot otelTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, entity.Span) {
+//		kvs := make([]attribute.KeyValue, 0, len(attrs))
+//		for k, v := range attrs {
+//			kvs = append(kvs, attribute.String(k, v))
+//		}
+//		ctx, span := ot.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(kvs...))
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ s trace.Span }
+//
+//	func (os otelSpan) End(err error) {
+//		if err != nil {
+//			os.s.RecordError(err)
+//			os.s.SetStatus(codes.Error, err.Error())
+//		}
+//		os.s.End()
+//	}
+//
+//	entity.SetTracer(otelTracer{t: otel.Tracer("entity")})
+type Tracer interface {
+	// Start 创建span，name为"entity.<op> <table>"，例如"entity.insert users"
+	// attrs包括db.system(驱动名)、db.sql.table(表名)、db.operation(操作类型)
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+// Span 一次数据库操作对应的span，err为操作返回的错误，nil表示成功
+type Span interface {
+	End(err error)
+}
+
+type tracerHolder struct {
+	t Tracer
+}
+
+var tracer atomic.Value
+
+func init() {
+	tracer.Store(tracerHolder{})
+}
+
+// SetTracer 设置链路追踪，默认不追踪，t为nil时取消追踪
+func SetTracer(t Tracer) {
+	tracer.Store(tracerHolder{t: t})
+}
+
+// 没有设置Tracer时返回的end什么都不做
+func startSpan(ctx context.Context, db DB, op, table string) (context.Context, func(err error)) {
+	t := tracer.Load().(tracerHolder).t
+	if t == nil {
+		return ctx, func(error) {}
+	}
+
+	ctx, span := t.Start(ctx, "entity."+op+" "+table, map[string]string{
+		"db.system":    dbDriver(db),
+		"db.sql.table": table,
+		"db.operation": op,
+	})
+	return ctx, span.End
+}
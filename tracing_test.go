@@ -0,0 +1,112 @@
+package entity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+type recordSpan struct {
+	name  string
+	attrs map[string]string
+	err   error
+	ended bool
+}
+
+func (s *recordSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+type recordTracer struct {
+	spans []*recordSpan
+}
+
+type spanKey struct{}
+
+func (t *recordTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	s := &recordSpan{name: name, attrs: attrs}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func TestTracer(t *testing.T) {
+	tr := &recordTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NoError(t, Load(ctx, ent, db))
+	require.NoError(t, Update(ctx, ent, db))
+	require.NoError(t, Delete(ctx, ent, db))
+	require.Error(t, Load(ctx, &MirrorEntity{ID: ent.ID}, db))
+
+	names := []string{"entity.insert mirror", "entity.load mirror", "entity.update mirror", "entity.delete mirror", "entity.load mirror"}
+	require.Len(t, tr.spans, len(names))
+	for i, s := range tr.spans {
+		require.Equal(t, names[i], s.name)
+		require.True(t, s.ended)
+		require.Equal(t, driverSqlite3, s.attrs["db.system"])
+		require.Equal(t, "mirror", s.attrs["db.sql.table"])
+	}
+	require.NoError(t, tr.spans[0].err)
+	require.Error(t, tr.spans[len(names)-1].err)
+
+	SetTracer(nil)
+	require.NoError(t, Save(ctx, &MirrorEntity{Email: "bar@example.com"}, db))
+	require.Len(t, tr.spans, len(names))
+}
+
+// 执行语句时使用span所在的ctx
+func TestTracerContext(t *testing.T) {
+	tr := &recordTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	var spans []interface{}
+	Use(LoggingMiddleware(func(ctx context.Context, query string, args []interface{}, dur time.Duration, err error) {
+		spans = append(spans, ctx.Value(spanKey{}))
+	}))
+	defer resetMiddlewares()
+
+	db := newTestDB(t, `CREATE TABLE mirror (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT, email_copy TEXT)`)
+	ctx := context.Background()
+
+	ent := &MirrorEntity{Email: "foo@example.com"}
+	_, err := Insert(ctx, ent, db)
+	require.NoError(t, err)
+	require.NoError(t, Load(ctx, ent, db))
+
+	require.Len(t, spans, 2)
+	require.True(t, spans[0] == tr.spans[0])
+	require.True(t, spans[1] == tr.spans[1])
+}
+
+// exec发生panic时span同样结束
+func TestTracerPanic(t *testing.T) {
+	tr := &recordTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	db := sqlx.NewDb(nil, driverSqlite3)
+	func() {
+		defer func() {
+			require.Equal(t, "boom", recover())
+		}()
+		_ = handle(context.Background(), db, OpLoad, "mirror", func(ctx context.Context) error {
+			panic("boom")
+		})
+	}()
+
+	require.Len(t, tr.spans, 1)
+	require.True(t, tr.spans[0].ended)
+	require.EqualError(t, tr.spans[0].err, "panic: boom")
+}
@@ -0,0 +1,465 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UpsertReturningAll 插入entity，主键冲突时更新已有记录
+// 执行完毕后entity的所有字段都会被数据库内的最新数据填充，inserted表示是否插入了新记录
+// 冲突判断依据主键，自增主键为零值时直接插入新记录，由数据库生成主键
+func UpsertReturningAll(ctx context.Context, ent Entity, db DB) (inserted bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	if err := validate(ent); err != nil {
+		return false, err
+	}
+
+	inserted, err = doUpsertReturningAll(ctx, ent, db)
+	if err != nil {
+		return false, err
+	}
+
+	if v, ok := ent.(Cacheable); ok {
+		if err := DeleteCache(v); err != nil {
+			return inserted, fmt.Errorf("delete cache, %w", err)
+		}
+	}
+
+	return inserted, nil
+}
+
+// UpsertOptions Upsert的可选设置
+type UpsertOptions struct {
+	// PreserveOnNull 写入的字段值为NULL时保留已有记录的值，不覆盖为NULL
+	PreserveOnNull bool
+}
+
+// Upsert 插入entity，主键冲突时更新已有记录
+// postgresql及sqlite3使用ON CONFLICT DO UPDATE，mysql使用ON DUPLICATE KEY UPDATE
+// refuseUpdate以及autoIncrement字段不会被更新，returningInsert及returningUpdate字段会写回entity(mysql除外)
+// 自增主键为零值时直接插入新记录，由数据库生成主键并写回entity
+func Upsert(ctx context.Context, ent Entity, db DB, opts ...UpsertOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, WriteTimeout)
+	defer cancel()
+
+	var opt UpsertOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	if err := validate(ent); err != nil {
+		return err
+	}
+
+	if err := doUpsert(ctx, ent, db, opt); err != nil {
+		return err
+	}
+
+	if v, ok := ent.(Cacheable); ok {
+		if err := DeleteCache(v); err != nil {
+			return fmt.Errorf("delete cache, %w", err)
+		}
+	}
+
+	return nil
+}
+
+func doUpsert(ctx context.Context, ent Entity, db DB, opt UpsertOptions) error {
+	db = withLogger(db)
+	if err := checkUpsert(db); err != nil {
+		return err
+	}
+
+	return handle(ctx, db, OpUpsert, ent.TableName(), func(ctx context.Context) error {
+		return upsertEntity(ctx, ent, db, opt)
+	})
+}
+
+// sqlserver需要使用MERGE语句，暂不支持
+func checkUpsert(db DB) error {
+	if driver := dbDriver(db); driver == driverSqlserver {
+		return fmt.Errorf("driver %q upsert, %w", driver, ErrUnsupported)
+	}
+	return nil
+}
+
+func upsertEntity(ctx context.Context, ent Entity, db DB, opt UpsertOptions) error {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return fmt.Errorf("get metadata, %w", err)
+	}
+
+	allocEmbedded(ent, md)
+
+	if newAutoIncrement(ent, md) {
+		_, err := insertEntity(ctx, ent, db)
+		return err
+	}
+
+	touchTimestamps(ent, md, true)
+	if err := checkValues(ent, md); err != nil {
+		return err
+	}
+	if err := checkFKEnums(ctx, ent, md, db); err != nil {
+		return err
+	}
+
+	arg, err := encodeArg(ent, md, ent)
+	if err != nil {
+		return err
+	}
+
+	driver := dbDriver(db)
+	var stmt string
+	if opt.PreserveOnNull {
+		stmt = upsertReturningStatement(ent, md, driver, true)
+	} else if s, ok := upsertStatements.get(md.Type); ok {
+		stmt = s
+	} else {
+		stmt = upsertReturningStatement(ent, md, driver, false)
+		upsertStatements.set(md.Type, stmt)
+	}
+
+	if driver != driverMysql && len(upsertReturnings(md, driver)) > 0 {
+		rows, err := namedQuery(ctx, db, stmt, arg)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		// 没有需要更新的字段时，冲突的记录不会返回数据
+		if !rows.Next() {
+			return rows.Err()
+		}
+
+		if err := scanEntity(rows, ent); err != nil {
+			return fmt.Errorf("scan struct, %w", err)
+		}
+		return rows.Err()
+	}
+
+	result, err := namedExec(ctx, db, stmt, arg)
+	if err != nil {
+		return err
+	}
+
+	// ON DUPLICATE KEY UPDATE，插入时affected rows为1
+	if driver == driverMysql {
+		if n, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("get affected rows, %w", err)
+		} else if n == 1 {
+			if id, err := result.LastInsertId(); err != nil {
+				return fmt.Errorf("get last insert id, %w", err)
+			} else if id > 0 {
+				setAutoIncrement(ent, md, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func doUpsertReturningAll(ctx context.Context, ent Entity, db DB) (inserted bool, err error) {
+	db = withLogger(db)
+	if err := checkUpsert(db); err != nil {
+		return false, err
+	}
+
+	err = handle(ctx, db, OpUpsert, ent.TableName(), func(ctx context.Context) error {
+		inserted, err = upsertEntityReturningAll(ctx, ent, db)
+		return err
+	})
+	return
+}
+
+func upsertEntityReturningAll(ctx context.Context, ent Entity, db DB) (bool, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return false, fmt.Errorf("get metadata, %w", err)
+	}
+
+	allocEmbedded(ent, md)
+
+	if newAutoIncrement(ent, md) {
+		if _, err := insertEntity(ctx, ent, db); err != nil {
+			return false, err
+		}
+		return true, doLoad(ctx, ent, db)
+	}
+
+	touchTimestamps(ent, md, true)
+	if err := checkValues(ent, md); err != nil {
+		return false, err
+	}
+	if err := checkFKEnums(ctx, ent, md, db); err != nil {
+		return false, err
+	}
+
+	arg, err := encodeArg(ent, md, ent)
+	if err != nil {
+		return false, err
+	}
+
+	driver := dbDriver(db)
+	returning := " RETURNING " + strings.Join(quoteColumns(md.Columns, driver), ", ")
+
+	switch driver {
+	case driverPostgres:
+		// xmax为0说明这一行是新插入的
+		stmt := upsertStatement(ent, md, driver) + returning + ", (xmax = 0) AS inserted"
+
+		rows, err := namedQuery(ctx, db, stmt, arg)
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			return false, sql.ErrNoRows
+		}
+
+		var inserted bool
+		dests := append(fieldAddrs(ent, md.Columns), &inserted)
+		if err := rows.Scan(dests...); err != nil {
+			return false, fmt.Errorf("scan struct, %w", err)
+		}
+		if err := decodeValues(ent, md, columnNames(md.Columns)); err != nil {
+			return false, err
+		}
+		return inserted, rows.Err()
+	case driverMysql:
+		result, err := namedExec(ctx, db, upsertStatement(ent, md, driver), arg)
+		if err != nil {
+			return false, err
+		}
+
+		// ON DUPLICATE KEY UPDATE，插入时affected rows为1，更新时为2
+		n, err := result.RowsAffected()
+		if err != nil {
+			return false, fmt.Errorf("get affected rows, %w", err)
+		}
+
+		inserted := n == 1
+		if inserted {
+			if id, err := result.LastInsertId(); err != nil {
+				return false, fmt.Errorf("get last insert id, %w", err)
+			} else if id > 0 {
+				setAutoIncrement(ent, md, id)
+			}
+		}
+
+		return inserted, doLoad(ctx, ent, db)
+	default:
+		stmt := upsertInsertBuilder(md, driver).
+			onConflict(fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quoteColumns(md.PrimaryKeys, driver), ", "))).
+			String() + returning
+
+		if ok, err := queryReturning(ctx, ent, db, stmt, ent); err != nil || ok {
+			return ok, err
+		}
+
+		// 没有插入新记录，说明主键冲突，更新已有记录
+		if ok, err := queryReturning(ctx, ent, db, upsertStatement(ent, md, driver)+returning, ent); err != nil {
+			return false, err
+		} else if !ok {
+			// 没有需要更新的字段时不会返回数据，直接重新读取
+			return false, doLoad(ctx, ent, db)
+		}
+		return false, nil
+	}
+}
+
+// 自增主键为零值时是新记录，不会发生主键冲突，按照普通插入处理，由数据库生成主键
+// 否则零值会作为主键写入，多条新记录会互相覆盖
+func newAutoIncrement(ent Entity, md *Metadata) bool {
+	if len(md.PrimaryKeys) != 1 || !md.PrimaryKeys[0].AutoIncrement {
+		return false
+	}
+	f, ok := readField(reflect.ValueOf(ent), md.PrimaryKeys[0].DBField)
+	return !ok || f.IsZero()
+}
+
+// 执行带有RETURNING子句的语句，把返回结果写回entity，没有返回数据时返回false
+func queryReturning(ctx context.Context, ent Entity, db DB, stmt string, arg interface{}) (bool, error) {
+	md, err := getMetadata(ent)
+	if err != nil {
+		return false, fmt.Errorf("get metadata, %w", err)
+	}
+
+	arg, err = encodeArg(ent, md, arg)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := namedQuery(ctx, db, stmt, arg)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+
+	if err := scanEntity(rows, ent); err != nil {
+		return false, fmt.Errorf("scan struct, %w", err)
+	}
+	return true, rows.Err()
+}
+
+// 与insertStatement不同，upsert需要用主键判断冲突，所以主键字段一定会被插入
+func upsertInsertStatement(ent Entity, md *Metadata, driver string) string {
+	return upsertInsertBuilder(md, driver).String()
+}
+
+func upsertInsertBuilder(md *Metadata, driver string) *sqlBuilder {
+	b := newInsert(md, driver)
+	for _, col := range md.Columns {
+		if col.PrimaryKey || (!col.ReturningInsert && !col.AutoIncrement && col.Generated == "") {
+			for _, name := range append([]string{col.DBField}, col.Mirrors...) {
+				b.value(name, bindParam(col, driver, ":"+col.DBField))
+			}
+		}
+	}
+	return b
+}
+
+func upsertStatement(ent Entity, md *Metadata, driver string) string {
+	return upsertSetStatement(ent, md, driver, false)
+}
+
+// preserveOnNull为true时，写入值为NULL的字段保留原值
+func upsertSetStatement(ent Entity, md *Metadata, driver string, preserveOnNull bool) string {
+	table := quoteTable(md, driver)
+	sets := []string{}
+	for _, col := range md.Columns {
+		if col.RefuseUpdate || col.AutoIncrement || col.ReturningUpdate {
+			continue
+		} else if col.Version {
+			// 版本号在原值上递增，不能使用写入的值覆盖
+			c := quoteColumn(col.DBField, driver)
+			if driver == driverMysql {
+				sets = append(sets, fmt.Sprintf("%s = %s + 1", c, c))
+			} else {
+				sets = append(sets, fmt.Sprintf("%s = %s.%s + 1", c, table, c))
+			}
+			continue
+		}
+
+		for _, name := range append([]string{col.DBField}, col.Mirrors...) {
+			c := quoteColumn(name, driver)
+
+			value := fmt.Sprintf("EXCLUDED.%s", c)
+			if driver == driverMysql {
+				value = fmt.Sprintf("VALUES(%s)", c)
+			}
+
+			if !preserveOnNull {
+				sets = append(sets, fmt.Sprintf("%s = %s", c, value))
+			} else if driver == driverMysql {
+				sets = append(sets, fmt.Sprintf("%s = COALESCE(%s, %s)", c, value, c))
+			} else {
+				sets = append(sets, fmt.Sprintf("%s = COALESCE(%s, %s.%s)", c, value, table, c))
+			}
+		}
+	}
+
+	b := upsertInsertBuilder(md, driver)
+	if driver == driverMysql {
+		if len(sets) == 0 {
+			c := quoteColumn(md.PrimaryKeys[0].DBField, driver)
+			sets = append(sets, fmt.Sprintf("%s = %s", c, c))
+		}
+		return b.onConflict("ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")).String()
+	}
+
+	clause := fmt.Sprintf("ON CONFLICT (%s)", strings.Join(quoteColumns(md.PrimaryKeys, driver), ", "))
+	if len(sets) == 0 {
+		return b.onConflict(clause + " DO NOTHING").String()
+	}
+	return b.onConflict(clause + " DO UPDATE SET " + strings.Join(sets, ", ")).String()
+}
+
+// upsert之后需要写回entity的字段，mysql不支持RETURNING
+// 更新时版本号由数据库递增，也需要写回
+func upsertReturnings(md *Metadata, driver string) []string {
+	names := []string{}
+	for _, col := range md.Columns {
+		if col.ReturningInsert || col.ReturningUpdate || col.Version || (col.AutoIncrement && driver == driverPostgres) {
+			names = append(names, col.DBField)
+		}
+	}
+	return names
+}
+
+func upsertReturningStatement(ent Entity, md *Metadata, driver string, preserveOnNull bool) string {
+	stmt := upsertSetStatement(ent, md, driver, preserveOnNull)
+	if names := upsertReturnings(md, driver); driver != driverMysql && len(names) > 0 {
+		stmt += " RETURNING " + strings.Join(quoteNames(names, driver), ", ")
+	}
+	return stmt
+}
+
+func quoteColumns(cols []Column, driver string) []string {
+	return quoteNames(columnNames(cols), driver)
+}
+
+// 按照字段顺序，返回entity对应属性的指针，用于rows.Scan()
+func fieldAddrs(ent Entity, cols []Column) []interface{} {
+	if sd, ok := ent.(ScanDest); ok {
+		return sd.ScanDests(columnNames(cols))
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+
+	dests := make([]interface{}, 0, len(cols))
+	for _, col := range cols {
+		f := mapper.FieldByName(v, col.DBField)
+		if col.Inet != "" {
+			dests = append(dests, inetScanner{field: f})
+		} else if col.Converter != "" {
+			dests = append(dests, converterScanner{field: f, col: col})
+		} else {
+			dests = append(dests, f.Addr().Interface())
+		}
+	}
+	return dests
+}
+
+// 把数据库生成的自增ID写回entity
+func setAutoIncrement(ent Entity, md *Metadata, id int64) {
+	if len(md.PrimaryKeys) != 1 || !md.PrimaryKeys[0].AutoIncrement {
+		return
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	f := mapper.FieldByName(v, md.PrimaryKeys[0].DBField)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.SetUint(uint64(id))
+	}
+}
+
+// 取出entity的自增ID，没有自增主键时返回0
+func autoIncrementID(ent Entity, md *Metadata) int64 {
+	if len(md.PrimaryKeys) != 1 || !md.PrimaryKeys[0].AutoIncrement {
+		return 0
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(ent))
+	f := mapper.FieldByName(v, md.PrimaryKeys[0].DBField)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(f.Uint())
+	}
+	return 0
+}
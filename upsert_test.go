@@ -0,0 +1,195 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertStatement(t *testing.T) {
+	md, _ := newTestMetadata(&GenernalEntity{})
+
+	stmt := upsertStatement(&GenernalEntity{}, md, driverMysql)
+	expected := "INSERT INTO `genernal` (`extra`, `id`, `id2`, `name`) VALUES (:extra, :id, :id2, :name) ON DUPLICATE KEY UPDATE `extra` = VALUES(`extra`), `name` = VALUES(`name`)"
+	if stmt != expected {
+		t.Fatalf("GenernalEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+
+	stmt = upsertStatement(&GenernalEntity{}, md, driverPostgres)
+	expected = `INSERT INTO "genernal" ("extra", "id", "id2", "name") VALUES (:extra, :id, :id2, :name) ON CONFLICT ("id", "id2") DO UPDATE SET "extra" = EXCLUDED."extra", "name" = EXCLUDED."name"`
+	if stmt != expected {
+		t.Fatalf("GenernalEntity, Expected=%s, Actual=%s", expected, stmt)
+	}
+}
+
+func TestUpsertReturningAll(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE upsert (code TEXT PRIMARY KEY, name TEXT, create_at INTEGER DEFAULT 100)`)
+	ctx := context.Background()
+
+	ent := &UpsertEntity{Code: "a", Name: "foo"}
+	inserted, err := UpsertReturningAll(ctx, ent, db)
+	require.NoError(t, err)
+	require.True(t, inserted)
+	require.Equal(t, UpsertEntity{Code: "a", Name: "foo", CreateAt: 100}, *ent)
+
+	db.MustExec(`UPDATE upsert SET create_at = 200 WHERE code = 'a'`)
+
+	ent = &UpsertEntity{Code: "a", Name: "bar"}
+	inserted, err = UpsertReturningAll(ctx, ent, db)
+	require.NoError(t, err)
+	require.False(t, inserted)
+	require.Equal(t, UpsertEntity{Code: "a", Name: "bar", CreateAt: 200}, *ent)
+}
+
+func TestUpsert(t *testing.T) {
+	md, _ := newTestMetadata(&UpsertEntity{})
+	stmt := upsertReturningStatement(&UpsertEntity{}, md, driverPostgres, false)
+	expected := `INSERT INTO "upsert" ("code", "name") VALUES (:code, :name) ON CONFLICT ("code") DO UPDATE SET "name" = EXCLUDED."name" RETURNING "create_at"`
+	require.Equal(t, expected, stmt)
+
+	stmt = upsertReturningStatement(&UpsertEntity{}, md, driverMysql, false)
+	expected = "INSERT INTO `upsert` (`code`, `name`) VALUES (:code, :name) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)"
+	require.Equal(t, expected, stmt)
+
+	db := newTestDB(t, `CREATE TABLE upsert (code TEXT PRIMARY KEY, name TEXT, create_at INTEGER DEFAULT 100)`)
+	ctx := context.Background()
+
+	ent := &UpsertEntity{Code: "a", Name: "foo"}
+	require.NoError(t, Upsert(ctx, ent, db))
+	require.Equal(t, UpsertEntity{Code: "a", Name: "foo", CreateAt: 100}, *ent)
+
+	db.MustExec(`UPDATE upsert SET create_at = 200 WHERE code = 'a'`)
+
+	ent = &UpsertEntity{Code: "a", Name: "bar"}
+	require.NoError(t, Upsert(ctx, ent, db))
+	require.Equal(t, UpsertEntity{Code: "a", Name: "bar", CreateAt: 200}, *ent)
+
+	var name string
+	require.NoError(t, db.Get(&name, `SELECT name FROM upsert WHERE code = 'a'`))
+	require.Equal(t, "bar", name)
+}
+
+func TestUpsertPreserveOnNull(t *testing.T) {
+	md, _ := newTestMetadata(&PreserveEntity{})
+	stmt := upsertReturningStatement(&PreserveEntity{}, md, driverPostgres, true)
+	expected := `INSERT INTO "preserve" ("code", "nickname") VALUES (:code, :nickname) ON CONFLICT ("code") DO UPDATE SET "nickname" = COALESCE(EXCLUDED."nickname", "preserve"."nickname")`
+	require.Equal(t, expected, stmt)
+
+	stmt = upsertReturningStatement(&PreserveEntity{}, md, driverMysql, true)
+	expected = "INSERT INTO `preserve` (`code`, `nickname`) VALUES (:code, :nickname) ON DUPLICATE KEY UPDATE `nickname` = COALESCE(VALUES(`nickname`), `nickname`)"
+	require.Equal(t, expected, stmt)
+
+	db := newTestDB(t, `CREATE TABLE preserve (code TEXT PRIMARY KEY, nickname TEXT)`)
+	ctx := context.Background()
+
+	nickname := "foo"
+	require.NoError(t, Upsert(ctx, &PreserveEntity{Code: "a", Nickname: &nickname}, db))
+
+	// NULL不覆盖已有的值
+	require.NoError(t, Upsert(ctx, &PreserveEntity{Code: "a"}, db, UpsertOptions{PreserveOnNull: true}))
+
+	ent := &PreserveEntity{Code: "a"}
+	require.NoError(t, Load(ctx, ent, db))
+	require.NotNil(t, ent.Nickname)
+	require.Equal(t, "foo", *ent.Nickname)
+
+	nickname = "bar"
+	require.NoError(t, Upsert(ctx, &PreserveEntity{Code: "a", Nickname: &nickname}, db, UpsertOptions{PreserveOnNull: true}))
+	require.NoError(t, Load(ctx, ent, db))
+	require.Equal(t, "bar", *ent.Nickname)
+
+	require.NoError(t, Upsert(ctx, &PreserveEntity{Code: "a"}, db))
+	require.NoError(t, Load(ctx, ent, db))
+	require.Nil(t, ent.Nickname)
+}
+
+type PreserveEntity struct {
+	Code     string  `db:"code,primaryKey"`
+	Nickname *string `db:"nickname"`
+}
+
+func (pe PreserveEntity) TableName() string {
+	return "preserve"
+}
+
+func (pe *PreserveEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+type UpsertEntity struct {
+	Code     string `db:"code,primaryKey"`
+	Name     string `db:"name"`
+	CreateAt int64  `db:"create_at,refuseUpdate,returningInsert"`
+}
+
+func (ue UpsertEntity) TableName() string {
+	return "upsert"
+}
+
+func (ue *UpsertEntity) OnEntityEvent(ctx context.Context, ev Event) error {
+	return nil
+}
+
+// 冲突时版本号在原值上递增，不能被写入的值覆盖
+func TestUpsertVersion(t *testing.T) {
+	md, _ := newTestMetadata(&VersionEntity{})
+	stmt := upsertReturningStatement(&VersionEntity{}, md, driverPostgres, false)
+	expected := `INSERT INTO "version" ("id", "name", "version") VALUES (:id, :name, :version) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "version" = "version"."version" + 1 RETURNING "id", "version"`
+	require.Equal(t, expected, stmt)
+
+	stmt = upsertReturningStatement(&VersionEntity{}, md, driverMysql, false)
+	expected = "INSERT INTO `version` (`id`, `name`, `version`) VALUES (:id, :name, :version) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `version` = `version` + 1"
+	require.Equal(t, expected, stmt)
+
+	db := newTestDB(t, `CREATE TABLE version (id INTEGER PRIMARY KEY, name TEXT, version INTEGER)`)
+	ctx := context.Background()
+
+	ent := &VersionEntity{ID: 1, Name: "foo", Version: 1}
+	require.NoError(t, Upsert(ctx, ent, db))
+	require.Equal(t, 1, ent.Version)
+
+	stale := &VersionEntity{ID: 1, Name: "bar", Version: 1}
+	require.NoError(t, Upsert(ctx, stale, db))
+	require.Equal(t, 2, stale.Version)
+
+	var version int
+	require.NoError(t, db.Get(&version, `SELECT version FROM version WHERE id = 1`))
+	require.Equal(t, 2, version)
+
+	// 旧版本号的entity不能再覆盖记录
+	ent.Name = "baz"
+	require.True(t, errors.Is(Update(ctx, ent, db), ErrVersionMismatch))
+}
+
+// 自增主键为零值时插入新记录，而不是把0作为主键写入
+func TestUpsertAutoIncrement(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE users (user_id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`)
+	ctx := context.Background()
+
+	alice := &AutoIncrementEntity{Name: "alice"}
+	require.NoError(t, Upsert(ctx, alice, db))
+	bob := &AutoIncrementEntity{Name: "bob"}
+	require.NoError(t, Upsert(ctx, bob, db))
+	require.NotZero(t, alice.UserID)
+	require.NotZero(t, bob.UserID)
+	require.NotEqual(t, alice.UserID, bob.UserID)
+
+	carol := &AutoIncrementEntity{Name: "carol"}
+	inserted, err := UpsertReturningAll(ctx, carol, db)
+	require.NoError(t, err)
+	require.True(t, inserted)
+	require.NotZero(t, carol.UserID)
+
+	var names []string
+	require.NoError(t, db.Select(&names, `SELECT name FROM users ORDER BY user_id`))
+	require.Equal(t, []string{"alice", "bob", "carol"}, names)
+
+	// 主键不为零值时仍然按主键冲突更新
+	bob.Name = "robert"
+	require.NoError(t, Upsert(ctx, bob, db))
+	names = nil
+	require.NoError(t, db.Select(&names, `SELECT name FROM users ORDER BY user_id`))
+	require.Equal(t, []string{"alice", "robert", "carol"}, names)
+}